@@ -0,0 +1,240 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// banner heads the help output
+const banner = "ipmap v2.0 (github.com/sercanarga/ipmap)"
+
+// Exit codes of the commands
+const (
+	exitOK          = 0   // success, a scan found sites
+	exitError       = 1   // network or runtime error
+	exitUsage       = 2   // invalid command, flag or argument
+	exitNoResults   = 3   // nothing was found
+	exitDomainFound = 4   // scan -d found the origin of the domain
+	exitInterrupted = 130 // the scan was interrupted
+)
+
+// example is a described command line shown in the help of a command
+type example struct {
+	description string
+	command     string
+}
+
+// command is an ipmap subcommand with its own flags and help
+type command struct {
+	name     string
+	aliases  []string
+	args     string // positional arguments shown after [flags]
+	summary  string
+	details  string // optional paragraph below the summary
+	examples []example
+	run      func(cmd *command, args []string) int
+}
+
+// commands lists the subcommands in the order of the help
+var commands = []*command{
+	scanCommand,
+	{
+		name:    "asn",
+		args:    "<asn>...",
+		summary: "List the IP blocks announced by an ASN without scanning them",
+		examples: []example{
+			{"List the prefixes of an ASN", "ipmap asn AS13335"},
+			{"List the prefixes of several ASNs as JSON", "ipmap asn -format json AS13335 AS209242"},
+		},
+		run: runASN,
+	},
+	{
+		name:    "resolve",
+		args:    "<domain>",
+		summary: "Fingerprint a domain (title, baseline, favicon hash) without scanning",
+		details: "The baseline is what scan compares every candidate with when -d is given.",
+		examples: []example{
+			{"Show the baseline of a domain", "ipmap resolve example.com"},
+			{"Get the favicon hash to search for with scan -favicon-hash", "ipmap resolve -format json example.com"},
+		},
+		run: runResolve,
+	},
+	{
+		name:    "rdns",
+		args:    "<ip|cidr>...",
+		summary: "Reverse DNS lookup of addresses and IP blocks",
+		examples: []example{
+			{"Look up a single address", "ipmap rdns 1.1.1.1"},
+			{"List the named addresses of a block", "ipmap rdns -workers 100 104.16.0.0/24"},
+		},
+		run: runRDNS,
+	},
+	{
+		name:    "vhost",
+		summary: "Find the virtual hosts an address serves from a wordlist of hostnames",
+		details: "Each hostname is sent as Host header and TLS server name, hostnames answered like random names (the catch-all) are not reported.",
+		examples: []example{
+			{"Try a list of hostnames on an address", "ipmap vhost -ip 203.0.113.10 -w hosts.txt"},
+			{"Try subdomain words of a domain on a small range", "ipmap vhost -ip 203.0.113.0/28 -w words.txt -d example.com -format json"},
+		},
+		run: runVhost,
+	},
+	{
+		name:    "report",
+		aliases: []string{"convert"},
+		args:    "<result.json|->",
+		summary: "Render an exported JSON result as a text or JSON report",
+		details: "Text results cannot be read back, export with -format json to keep them convertible.",
+		examples: []example{
+			{"Print an exported result as text", "ipmap report ipmap_ExampleDomain_1700000000.json"},
+			{"Convert a result read from stdin to a text file", "cat result.json | ipmap convert -format text -o result.txt -"},
+		},
+		run: runReport,
+	},
+	{
+		name:    "watch",
+		summary: "Re-run a scan on a schedule and report the changes between runs",
+		examples: []example{
+			{"Report new origins of a domain every 6 hours", "ipmap watch -asn AS13335 -d example.com -interval 6h"},
+			{"Send the changes to a webhook", "ipmap watch -asn AS13335 -d example.com -webhook https://hooks.example.com/ipmap"},
+		},
+		run: runWatch,
+	},
+	{
+		name:    "merge",
+		args:    "<result.json>...",
+		summary: "Combine the exported JSON results of sharded scans into one result",
+		details: "Sites are deduplicated by URL, the metadata and summaries are merged and missing shards are reported.",
+		examples: []example{
+			{"Merge the results of scan -shard 1/3, 2/3 and 3/3", "ipmap merge -o merged.json shard1.json shard2.json shard3.json"},
+			{"Print the merged result as text", "ipmap merge -format text ipmap_*.json"},
+		},
+		run: runMerge,
+	},
+	{
+		name:    "coordinator",
+		summary: "Split a scan into chunks and serve them to workers",
+		details: "Chunks whose worker stops sending heartbeats are queued again, the chunk reports are merged into one report. Listening off loopback needs a -token shared with the workers.",
+		examples: []example{
+			{"Coordinate a scan for workers on other hosts", "IPMAP_CLUSTER_TOKEN=secret ipmap coordinator -asn AS13335 -d example.com -addr 0.0.0.0:8091"},
+			{"Use smaller chunks and a shorter lease", "ipmap coordinator -ip 103.21.244.0/22 -chunk-size 64 -lease 30s"},
+		},
+		run: runCoordinator,
+	},
+	{
+		name:    "worker",
+		summary: "Probe the chunks of a coordinator with local limits",
+		examples: []example{
+			{"Join a coordinator", "IPMAP_CLUSTER_TOKEN=secret ipmap worker -coordinator http://10.0.0.1:8091"},
+			{"Run two rate limited workers on one machine", "ipmap worker -coordinator http://127.0.0.1:8091 -name w1 -rate 50 &\n  ipmap worker -coordinator http://127.0.0.1:8091 -name w2 -rate 50"},
+		},
+		run: runWorker,
+	},
+	{
+		name:    "serve",
+		summary: "Run the REST API for submitting and tracking scans",
+		examples: []example{
+			{"Serve the API on the default address", "ipmap serve -addr 127.0.0.1:8090 -data ipmap-jobs"},
+		},
+		run: runServe,
+	},
+}
+
+// findCommand returns the command named name or one of its aliases, or nil
+func findCommand(name string) *command {
+	for _, cmd := range commands {
+		if cmd.name == name {
+			return cmd
+		}
+		for _, alias := range cmd.aliases {
+			if alias == name {
+				return cmd
+			}
+		}
+	}
+	return nil
+}
+
+// newFlagSet creates the flag set of a command, -h prints the command help
+func newFlagSet(cmd *command) *flag.FlagSet {
+	fs := flag.NewFlagSet(cmd.name, flag.ContinueOnError)
+	fs.Usage = func() { printCommandHelp(fs.Output(), cmd, fs) }
+	return fs
+}
+
+// parseFlags parses the arguments of a command and returns the exit code
+// to use when parsing ended the command (-h or an invalid flag)
+func parseFlags(fs *flag.FlagSet, args []string) (int, bool) {
+	err := fs.Parse(args)
+	switch {
+	case err == nil:
+		return exitOK, true
+	case errors.Is(err, flag.ErrHelp):
+		return exitOK, false
+	}
+	return exitUsage, false
+}
+
+// printCommandHelp writes the usage, flags and examples of a command
+func printCommandHelp(w io.Writer, cmd *command, fs *flag.FlagSet) {
+	usage := "Usage: ipmap " + cmd.name + " [flags]"
+	if cmd.args != "" {
+		usage += " " + cmd.args
+	}
+	fmt.Fprintln(w, usage)
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, cmd.summary+".")
+	if cmd.details != "" {
+		fmt.Fprintln(w, cmd.details)
+	}
+	if len(cmd.aliases) > 0 {
+		fmt.Fprintln(w, "Aliases: "+strings.Join(cmd.aliases, ", "))
+	}
+
+	fmt.Fprintln(w, "\nFlags:")
+	fs.SetOutput(w)
+	fs.PrintDefaults()
+
+	if len(cmd.examples) > 0 {
+		fmt.Fprintln(w, "\nExamples:")
+		for _, ex := range cmd.examples {
+			fmt.Fprintf(w, "  %s\n  %s\n\n", ex.description, ex.command)
+		}
+	}
+}
+
+// printUsage writes the list of commands
+func printUsage(w io.Writer) {
+	fmt.Fprintln(w, banner)
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Usage: ipmap <command> [flags]")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Commands:")
+	for _, cmd := range commands {
+		fmt.Fprintf(w, "  %-12s %s\n", cmd.name, cmd.summary)
+	}
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "The scan flags also work without a command: ipmap -asn AS13335 -d example.com")
+	fmt.Fprintln(w, `Run "ipmap help <command>" for the flags and examples of a command.`)
+}
+
+// runHelp prints the help of a command, or the list of commands
+func runHelp(args []string) int {
+	if len(args) == 0 {
+		printUsage(os.Stdout)
+		return exitOK
+	}
+
+	cmd := findCommand(args[0])
+	if cmd == nil {
+		fmt.Fprintf(os.Stderr, "Unknown command %q\n\n", args[0])
+		printUsage(os.Stderr)
+		return exitUsage
+	}
+	cmd.run(cmd, []string{"-h"})
+	return exitOK
+}
@@ -0,0 +1,295 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"ipmap/cluster"
+	"ipmap/config"
+	"ipmap/modules"
+	"ipmap/scanner"
+	"ipmap/tools"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// coordinatorDrainTime keeps the coordinator up after the scan so polling workers learn it is over
+const coordinatorDrainTime = 3 * time.Second
+
+// runCoordinator splits a scan into chunks for workers:
+// ipmap coordinator -asn AS13335 -d example.com -addr 0.0.0.0:8091 -token secret
+func runCoordinator(cmd *command, args []string) int {
+	fs := newFlagSet(cmd)
+	asn := fs.String("asn", "", "ASN whose IP blocks are scanned (e.g. AS13335)")
+	ip := fs.String("ip", "", "IP blocks to scan (comma-separated CIDRs)")
+	domain := fs.String("d", "", "domain whose origin is searched (e.g. example.com)")
+	timeout := fs.String("t", "", "timeout in ms (300) or adaptive bounds (200-3000), adaptive by default")
+	con := fs.Bool("c", false, "keep scanning after a domain match")
+	addr := fs.String("addr", "127.0.0.1:8091", "listen address for the workers")
+	token := fs.String("token", os.Getenv("IPMAP_CLUSTER_TOKEN"), "shared secret of the workers, required off loopback (or IPMAP_CLUSTER_TOKEN)")
+	faviconHash := fs.String("favicon-hash", "", "favicon hash to match (mmh3 or sha256)")
+	threshold := fs.Int("threshold", 75, "similarity score (0-100) to consider a site as the domain")
+	excludeCDN := fs.Bool("exclude-cdn", false, "ignore CDN/WAF edges when matching the domain")
+	tech := fs.String("tech", "", "only show sites running these technologies (comma-separated)")
+	noRedirect := fs.Bool("no-redirect", false, "do not follow redirects, report them instead")
+	request := addRequestFlags(fs)
+	chunkSize := fs.Int("chunk-size", 256, "addresses per chunk")
+	lease := fs.Duration("lease", cluster.DefaultLeaseTimeout, "time without a heartbeat after which a chunk is queued again")
+	format := fs.String("format", "text", "output format (text/json)")
+	export := fs.Bool("export", false, "export the result without asking")
+	verbose := fs.Bool("v", false, "verbose mode")
+	if code, ok := parseFlags(fs, args); !ok {
+		return code
+	}
+
+	if (*asn == "") == (*ip == "") {
+		fmt.Fprintln(os.Stderr, "Use exactly one of -asn and -ip")
+		return exitUsage
+	}
+	if err := validateCoordinatorFlags(*asn, *ip, *domain, *timeout, *format, *chunkSize, *lease); err != nil {
+		fmt.Fprintln(os.Stderr, "Invalid parameters:", err)
+		return exitUsage
+	}
+	if host, _, err := net.SplitHostPort(*addr); err != nil || (*token == "" && !isLoopback(host)) {
+		fmt.Fprintln(os.Stderr, "Invalid parameters: -addr must be host:port, and off loopback the workers need a -token")
+		return exitUsage
+	}
+	tmpl, err := request.build()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Invalid request template:", err)
+		return exitUsage
+	}
+
+	task := cluster.Task{
+		Domain:      *domain,
+		Timeout:     *timeout,
+		Continue:    *con,
+		FaviconHash: strings.TrimSpace(*faviconHash),
+		Threshold:   *threshold,
+		ExcludeCDN:  *excludeCDN,
+		NoRedirect:  *noRedirect,
+		Request:     tmpl,
+	}
+	if *tech != "" {
+		task.Tech = strings.Split(*tech, ",")
+	}
+	// The task settings are checked the way the workers apply them
+	opts := scanner.DefaultOptions()
+	opts.Addresses = []string{"127.0.0.1"}
+	opts.Domain, opts.Timeout, opts.FaviconHash, opts.Threshold = task.Domain, task.Timeout, task.FaviconHash, task.Threshold
+	opts.FollowRedirects, opts.Request = !task.NoRedirect, task.Request
+	opts.Verbose, opts.OnLog = *verbose, modules.PrintLog
+	s, err := scanner.New(opts)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Invalid parameters:", err)
+		return exitUsage
+	}
+	config.Verbose = *verbose
+	config.Format = *format
+
+	blocks, ips, code := coordinatorTargets(*asn, *ip)
+	if code != exitOK {
+		return code
+	}
+
+	// The domain is requested once, every chunk is compared with the same response
+	if task.Domain != "" {
+		if task.Baseline, err = s.CaptureBaseline(context.Background()); err != nil {
+			fmt.Fprintln(os.Stderr, "Scan failed:", err)
+			return exitError
+		}
+	}
+
+	coordinator := cluster.NewCoordinator(task, blocks, cluster.SplitChunks(ips, *chunkSize), *lease)
+	coordinator.Token = *token
+
+	listener, err := net.Listen("tcp", *addr)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Coordinator could not listen:", err)
+		return exitError
+	}
+	server := &http.Server{Handler: coordinator.Handler()}
+	go func() { _ = server.Serve(listener) }()
+	defer server.Close()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go coordinator.Run(ctx)
+
+	status := coordinator.Status()
+	config.InfoLog("Coordinating %d addresses in %d chunks on http://%s", len(ips), status.Chunks, listener.Addr())
+
+	ticker := time.NewTicker(10 * time.Second)
+	defer ticker.Stop()
+wait:
+	for {
+		select {
+		case <-coordinator.Done():
+			break wait
+		case <-ctx.Done():
+			fmt.Println("\n\n[!] Scan interrupted by user")
+			break wait
+		case <-ticker.C:
+			s := coordinator.Status()
+			config.InfoLog("%d/%d chunks done, %d leased, %d hits, %d workers", s.Done, s.Chunks, s.Leased, s.Hits, len(s.Workers))
+		}
+	}
+
+	if ctx.Err() == nil {
+		// Workers polling for work learn that the scan is over
+		time.Sleep(coordinatorDrainTime)
+	}
+
+	if err := coordinator.Err(); err != nil {
+		fmt.Fprintln(os.Stderr, "Scan failed:", err)
+		return exitError
+	}
+
+	report := coordinator.Report()
+	modules.PrintReport(report, *export)
+	switch {
+	case ctx.Err() != nil:
+		return exitInterrupted
+	case report.Method == "Search Domain by ASN" || hasDomainMatch(report):
+		return exitDomainFound
+	case len(report.FoundedWebsites) == 0:
+		return exitNoResults
+	}
+	return exitOK
+}
+
+// validateCoordinatorFlags checks the coordinator inputs before any lookup
+func validateCoordinatorFlags(asn, ip, domain, timeout, format string, chunkSize int, lease time.Duration) error {
+	if asn != "" && !modules.ValidateASN(asn) {
+		return fmt.Errorf("invalid ASN %q, use the AS prefix and number (e.g. AS13335)", asn)
+	}
+	if ip != "" {
+		if _, err := modules.ValidateCIDRList(ip); err != nil {
+			return fmt.Errorf("invalid IP block: %v, use CIDR notation (e.g. 103.21.244.0/22)", err)
+		}
+	}
+	if domain != "" {
+		if err := modules.ValidateHostname(domain); err != nil {
+			return err
+		}
+	}
+	if timeout != "" {
+		if err := modules.ValidateTimeoutRange(timeout); err != nil {
+			return fmt.Errorf("invalid timeout: %v", err)
+		}
+	}
+	if format != "text" && format != "json" {
+		return fmt.Errorf("invalid format %q, use text or json", format)
+	}
+	if chunkSize < 1 {
+		return fmt.Errorf("invalid chunk size %d, it must be at least 1", chunkSize)
+	}
+	if lease < 3*time.Second {
+		return fmt.Errorf("invalid lease %v, it must be at least 3s", lease)
+	}
+	return nil
+}
+
+// coordinatorTargets returns the scanned IP blocks and their addresses
+func coordinatorTargets(asn, ip string) ([]string, []string, int) {
+	blocks, _ := modules.ValidateCIDRList(ip)
+	if asn != "" {
+		var err error
+		if blocks, err = tools.ASNBlocks(asn); err != nil {
+			fmt.Fprintf(os.Stderr, "IP blocks of %s could not be queried: %v\n", asn, err)
+			return nil, nil, exitError
+		}
+		if len(blocks) == 0 {
+			fmt.Fprintln(os.Stderr, "Nothing to scan: no IP blocks found for", asn)
+			return nil, nil, exitNoResults
+		}
+	}
+
+	ips, err := tools.ExpandBlocks(blocks)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Invalid IP block:", err)
+		return nil, nil, exitUsage
+	}
+	return blocks, ips, exitOK
+}
+
+// isLoopback reports whether a listen host only accepts local connections
+func isLoopback(host string) bool {
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// hasDomainMatch reports whether a site of the report matched the domain
+func hasDomainMatch(report modules.ResultData) bool {
+	for _, d := range report.Details {
+		if d.DomainMatch {
+			return true
+		}
+	}
+	return false
+}
+
+// runWorker probes the chunks of a coordinator:
+// ipmap worker -coordinator http://10.0.0.1:8091 -workers 200 -rate 100
+func runWorker(cmd *command, args []string) int {
+	fs := newFlagSet(cmd)
+	url := fs.String("coordinator", "", "coordinator URL (e.g. http://127.0.0.1:8091)")
+	name := fs.String("name", "", "worker name reported to the coordinator (default host-pid)")
+	token := fs.String("token", os.Getenv("IPMAP_CLUSTER_TOKEN"), "shared secret of the coordinator (or IPMAP_CLUSTER_TOKEN)")
+	workers := fs.Int("workers", 100, "number of concurrent workers (1-1000)")
+	rate := fs.Int("rate", 0, "requests per second of this worker (0 = unlimited)")
+	retries := fs.Int("retries", 2, "retries for timeouts and 429/503 responses (0-10)")
+	preScan := fs.Bool("prescan", false, "TCP connect check on ports 443/80 before HTTP probing")
+	wait := fs.Duration("wait", time.Minute, "how long the coordinator may be unreachable")
+	verbose := fs.Bool("v", false, "verbose mode")
+	if code, ok := parseFlags(fs, args); !ok {
+		return code
+	}
+
+	if *url == "" || !modules.ValidateWebhookURL(*url) {
+		fmt.Fprintln(os.Stderr, "Invalid parameters: -coordinator must be an http(s) URL (e.g. http://127.0.0.1:8091)")
+		return exitUsage
+	}
+	config.Verbose = *verbose
+
+	opts := scanner.DefaultOptions()
+	opts.Workers, opts.Rate, opts.Retries, opts.PreScan = *workers, *rate, *retries, *preScan
+	opts.Verbose, opts.OnLog = *verbose, modules.PrintLog
+	// The limits are checked with a placeholder target, the chunks bring the real ones
+	check := opts
+	check.Addresses = []string{"127.0.0.1"}
+	if _, err := scanner.New(check); err != nil {
+		fmt.Fprintln(os.Stderr, "Invalid parameters:", err)
+		return exitUsage
+	}
+
+	worker := cluster.NewWorker(*url, opts)
+	if n := strings.TrimSpace(*name); n != "" {
+		worker.Name = n
+	}
+	worker.Wait = *wait
+	worker.Token = *token
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	config.InfoLog("Worker %s pulling chunks from %s", worker.Name, worker.URL)
+	err := worker.Run(ctx)
+	switch {
+	case errors.Is(err, context.Canceled):
+		return exitInterrupted
+	case err != nil:
+		fmt.Fprintln(os.Stderr, "Worker stopped:", err)
+		return exitError
+	}
+	config.InfoLog("Scan is over, worker %s exiting", worker.Name)
+	return exitOK
+}
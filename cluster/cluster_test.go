@@ -0,0 +1,351 @@
+package cluster
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"ipmap/modules"
+	"ipmap/scanner"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// addresses returns n test addresses
+func addresses(n int) []string {
+	var ips []string
+	for i := 1; i <= n; i++ {
+		ips = append(ips, fmt.Sprintf("10.0.0.%d", i))
+	}
+	return ips
+}
+
+// newTestCoordinator serves a coordinator for the addresses in chunks of size
+func newTestCoordinator(t *testing.T, task Task, ips []string, size int, lease time.Duration) (*Coordinator, string) {
+	t.Helper()
+
+	c := NewCoordinator(task, []string{"10.0.0.0/24"}, SplitChunks(ips, size), lease)
+	ctx, cancel := context.WithCancel(context.Background())
+	go c.Run(ctx)
+
+	ts := httptest.NewServer(c.Handler())
+	t.Cleanup(func() {
+		ts.Close()
+		cancel()
+	})
+	return c, ts.URL
+}
+
+// newTestWorker creates a worker reporting one site per address with scan
+func newTestWorker(url, name string, scan ScanFunc) *Worker {
+	w := NewWorker(url, scanner.DefaultOptions())
+	w.Name = name
+	w.Wait = 2 * time.Second
+	w.poll = 10 * time.Millisecond
+	if scan == nil {
+		scan = stubScan
+	}
+	w.scan = scan
+	return w
+}
+
+func stubScan(ctx context.Context, task Task, chunk Chunk) (modules.ResultData, error) {
+	report := modules.ResultData{
+		Method:  "Search All ASN/IP",
+		Summary: &modules.ScanSummary{Elapsed: "1s", Addresses: int64(len(chunk.Addresses)), Scanned: int64(len(chunk.Addresses))},
+	}
+	for _, ip := range chunk.Addresses {
+		report.FoundedWebsites = append(report.FoundedWebsites, []string{"200", "http://" + ip, "Site " + ip})
+	}
+	return report, nil
+}
+
+// runWorkers runs the workers until the coordinator closes the scan
+func runWorkers(t *testing.T, workers ...*Worker) {
+	t.Helper()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	errs := make([]error, len(workers))
+	for i, w := range workers {
+		wg.Add(1)
+		go func(i int, w *Worker) {
+			defer wg.Done()
+			errs[i] = w.Run(ctx)
+		}(i, w)
+	}
+	wg.Wait()
+
+	for i, err := range errs {
+		if err != nil {
+			t.Errorf("Worker %s: %v", workers[i].Name, err)
+		}
+	}
+}
+
+func TestSplitChunks(t *testing.T) {
+	tests := []struct {
+		n, size int
+		want    []int
+	}{
+		{10, 3, []int{3, 3, 3, 1}},
+		{6, 3, []int{3, 3}},
+		{2, 5, []int{2}},
+		{0, 5, nil},
+	}
+
+	for _, tt := range tests {
+		chunks := SplitChunks(addresses(tt.n), tt.size)
+		var sizes []int
+		for i, chunk := range chunks {
+			if chunk.ID != i {
+				t.Errorf("SplitChunks(%d, %d) chunk %d has ID %d", tt.n, tt.size, i, chunk.ID)
+			}
+			sizes = append(sizes, len(chunk.Addresses))
+		}
+		if fmt.Sprint(sizes) != fmt.Sprint(tt.want) {
+			t.Errorf("SplitChunks(%d, %d) sizes = %v, want %v", tt.n, tt.size, sizes, tt.want)
+		}
+	}
+}
+
+func TestDistributedScan(t *testing.T) {
+	ips := addresses(10)
+	c, url := newTestCoordinator(t, Task{}, ips, 3, time.Minute)
+
+	runWorkers(t, newTestWorker(url, "a", nil), newTestWorker(url, "b", nil))
+
+	select {
+	case <-c.Done():
+	default:
+		t.Fatal("Coordinator is not done after the workers exited")
+	}
+
+	report := c.Report()
+	if len(report.FoundedWebsites) != len(ips) {
+		t.Fatalf("Report has %d sites, want %d", len(report.FoundedWebsites), len(ips))
+	}
+	for i, site := range report.FoundedWebsites {
+		if site[1] != "http://"+ips[i] {
+			t.Errorf("Site %d = %v, want the chunk order", i, site)
+		}
+	}
+	if report.Summary == nil || report.Summary.Addresses != 10 || report.Summary.Hits != 10 {
+		t.Errorf("Report summary = %+v", report.Summary)
+	}
+
+	status := c.Status()
+	chunks := 0
+	for _, w := range status.Workers {
+		chunks += w.Chunks
+	}
+	if status.Done != 4 || chunks != 4 || len(status.Workers) != 2 {
+		t.Errorf("Status = %+v", status)
+	}
+}
+
+func TestWorkerLossRequeuesChunk(t *testing.T) {
+	c, url := newTestCoordinator(t, Task{}, addresses(4), 2, 200*time.Millisecond)
+
+	// A worker leases a chunk and dies without reporting it
+	body, _ := json.Marshal(WorkRequest{Worker: "dead"})
+	resp, err := http.Post(url+"/work", "application/json", bytes.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Lease status = %d", resp.StatusCode)
+	}
+
+	runWorkers(t, newTestWorker(url, "alive", nil))
+
+	status := c.Status()
+	if status.Done != 2 || status.Requeue != 1 {
+		t.Errorf("Status = %+v, want 2 chunks done and 1 requeued", status)
+	}
+	if sites := len(c.Report().FoundedWebsites); sites != 4 {
+		t.Errorf("Report has %d sites, want 4", sites)
+	}
+}
+
+func TestLostLeaseIsNotReported(t *testing.T) {
+	c, url := newTestCoordinator(t, Task{}, addresses(2), 2, time.Second)
+
+	// The first lease expires while the slow worker is probing
+	slow := newTestWorker(url, "slow", func(ctx context.Context, task Task, chunk Chunk) (modules.ResultData, error) {
+		c.mu.Lock()
+		for _, l := range c.leases {
+			l.expires = time.Now().Add(-time.Second)
+		}
+		c.requeueExpired(time.Now())
+		c.mu.Unlock()
+
+		<-ctx.Done()
+		return modules.ResultData{}, ctx.Err()
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() { _ = slow.Run(ctx) }()
+
+	runWorkers(t, newTestWorker(url, "fast", nil))
+
+	for _, w := range c.Status().Workers {
+		if w.Name == "slow" && w.Chunks != 0 {
+			t.Errorf("The worker that lost its lease reported %d chunks", w.Chunks)
+		}
+	}
+	if sites := len(c.Report().FoundedWebsites); sites != 2 {
+		t.Errorf("Report has %d sites, want 2", sites)
+	}
+}
+
+func TestDomainMatchStopsScan(t *testing.T) {
+	c, url := newTestCoordinator(t, Task{Domain: "example.com"}, addresses(9), 3, time.Minute)
+
+	runWorkers(t, newTestWorker(url, "a", func(ctx context.Context, task Task, chunk Chunk) (modules.ResultData, error) {
+		report, _ := stubScan(ctx, task, chunk)
+		if chunk.ID == 0 {
+			report.Method = "Search Domain by ASN"
+		}
+		return report, nil
+	}))
+
+	status := c.Status()
+	if !status.Matched || status.Done != 1 || status.Pending != 2 {
+		t.Errorf("Status = %+v, want the scan stopped after the first chunk", status)
+	}
+	if report := c.Report(); report.Method != "Search Domain by ASN" || report.Summary.Addresses != 9 {
+		t.Errorf("Report = %+v", report)
+	}
+}
+
+func TestChunkFailures(t *testing.T) {
+	c, url := newTestCoordinator(t, Task{}, addresses(2), 2, time.Minute)
+
+	attempts := 0
+	runWorkers(t, newTestWorker(url, "a", func(ctx context.Context, task Task, chunk Chunk) (modules.ResultData, error) {
+		attempts++
+		return modules.ResultData{}, errors.New("domain could not be resolved")
+	}))
+
+	if err := c.Err(); err == nil || !strings.Contains(err.Error(), "domain could not be resolved") {
+		t.Errorf("Err() = %v", err)
+	}
+	if attempts != maxChunkFailures {
+		t.Errorf("Chunk was attempted %d times, want %d", attempts, maxChunkFailures)
+	}
+}
+
+func TestWorkerScansChunk(t *testing.T) {
+	var ips []string
+	for _, title := range []string{"Chunk One", "Chunk Two"} {
+		title := title
+		site := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, _ = w.Write([]byte("<title>" + title + "</title>"))
+		}))
+		defer site.Close()
+		ips = append(ips, strings.TrimPrefix(site.URL, "http://"))
+	}
+
+	c, url := newTestCoordinator(t, Task{Timeout: "2000"}, ips, 1, time.Minute)
+	w := NewWorker(url, scanner.DefaultOptions())
+	w.poll = 10 * time.Millisecond
+	runWorkers(t, w)
+
+	report := c.Report()
+	if len(report.FoundedWebsites) != 2 || report.FoundedWebsites[1][2] != "Chunk Two" {
+		t.Errorf("Report sites = %v", report.FoundedWebsites)
+	}
+}
+
+func TestWorkerUsesTaskBaseline(t *testing.T) {
+	site := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("<title>Origin</title>"))
+	}))
+	defer site.Close()
+
+	// The domain does not resolve, the workers must not request it
+	baseline := &scanner.Baseline{
+		Title:        "Origin",
+		ResponseTime: 100,
+		Fingerprint:  &modules.Fingerprint{URL: "https://origin.invalid", StatusCode: 200, Title: "Origin"},
+		Sample:       modules.PageSample{Title: "Origin", Body: "<title>Origin</title>"},
+	}
+	task := Task{Domain: "origin.invalid", Timeout: "2000", Baseline: baseline}
+	c, url := newTestCoordinator(t, task, []string{strings.TrimPrefix(site.URL, "http://")}, 1, time.Minute)
+	w := NewWorker(url, scanner.DefaultOptions())
+	w.poll = 10 * time.Millisecond
+	runWorkers(t, w)
+
+	if err := c.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if report := c.Report(); report.SearchSite != "Origin" || len(report.FoundedWebsites) != 1 {
+		t.Errorf("Report = %q with %v", report.SearchSite, report.FoundedWebsites)
+	}
+}
+
+func TestReportNeedsLease(t *testing.T) {
+	c, url := newTestCoordinator(t, Task{}, addresses(2), 2, time.Minute)
+
+	post := func(path string, v interface{}, out interface{}) *http.Response {
+		body, _ := json.Marshal(v)
+		resp, err := http.Post(url+path, "application/json", bytes.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		if out != nil {
+			_ = json.NewDecoder(resp.Body).Decode(out)
+		}
+		return resp
+	}
+	var a Assignment
+	post("/work", WorkRequest{Worker: "a"}, &a)
+
+	report, _ := stubScan(context.Background(), a.Task, a.Chunk)
+	for _, forged := range []ChunkResult{
+		{Worker: "b", Chunk: a.Chunk.ID, Lease: a.Lease, Report: report},
+		{Worker: "a", Chunk: a.Chunk.ID, Lease: "guessed", Report: report},
+	} {
+		if resp := post("/results", forged, nil); resp.StatusCode != http.StatusConflict {
+			t.Errorf("Report by %s with lease %s status = %d, want 409", forged.Worker, forged.Lease, resp.StatusCode)
+		}
+	}
+	if status := c.Status(); status.Done != 0 {
+		t.Fatalf("Status = %+v, want no chunk done", status)
+	}
+
+	if resp := post("/results", ChunkResult{Worker: "a", Chunk: a.Chunk.ID, Lease: a.Lease, Report: report}, nil); resp.StatusCode != http.StatusNoContent {
+		t.Errorf("Report of the lease holder status = %d, want 204", resp.StatusCode)
+	}
+	if status := c.Status(); status.Done != 1 {
+		t.Errorf("Status = %+v, want the chunk done", status)
+	}
+}
+
+func TestCoordinatorToken(t *testing.T) {
+	c := NewCoordinator(Task{}, nil, SplitChunks(addresses(2), 2), time.Minute)
+	c.Token = "secret"
+	ts := httptest.NewServer(c.Handler())
+	defer ts.Close()
+
+	w := newTestWorker(ts.URL, "a", nil)
+	if err := w.Run(context.Background()); err == nil || !strings.Contains(err.Error(), "token") {
+		t.Errorf("Run() without the token = %v, want a token error", err)
+	}
+
+	w.Token = "secret"
+	runWorkers(t, w)
+	if status := c.Status(); status.Done != 1 {
+		t.Errorf("Status = %+v, want the chunk done", status)
+	}
+}
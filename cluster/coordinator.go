@@ -0,0 +1,394 @@
+package cluster
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"ipmap/config"
+	"ipmap/modules"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultLeaseTimeout is how long a chunk stays leased without a heartbeat
+	DefaultLeaseTimeout = time.Minute
+	// maxChunkFailures is how many times a chunk may fail before the scan fails
+	maxChunkFailures = 3
+)
+
+// Coordinator hands out the chunks of a scan and collects their reports
+type Coordinator struct {
+	// Token is the shared secret the workers must send, empty accepts any worker
+	Token string
+
+	task   Task
+	blocks []string
+	chunks []Chunk
+	lease  time.Duration
+	start  time.Time
+
+	mu       sync.Mutex
+	pending  []int // chunk IDs waiting for a worker, in order
+	leases   map[int]*lease
+	issued   map[string]*lease // every lease handed out, by ID
+	results  map[int]modules.ResultData
+	workers  map[string]*WorkerStatus
+	requeued int
+	failures map[int]int
+	err      error
+	matched  bool
+	done     chan struct{}
+	finished bool
+	end      time.Time
+}
+
+// lease is a chunk handed to a worker
+type lease struct {
+	id      string
+	chunk   int
+	worker  string
+	expires time.Time
+}
+
+// NewCoordinator creates a coordinator for the chunks of the scanned IP blocks
+func NewCoordinator(task Task, blocks []string, chunks []Chunk, leaseTimeout time.Duration) *Coordinator {
+	if leaseTimeout <= 0 {
+		leaseTimeout = DefaultLeaseTimeout
+	}
+	c := &Coordinator{
+		task:     task,
+		blocks:   blocks,
+		chunks:   chunks,
+		lease:    leaseTimeout,
+		start:    time.Now(),
+		leases:   map[int]*lease{},
+		issued:   map[string]*lease{},
+		results:  map[int]modules.ResultData{},
+		workers:  map[string]*WorkerStatus{},
+		failures: map[int]int{},
+		done:     make(chan struct{}),
+	}
+	for _, chunk := range chunks {
+		c.pending = append(c.pending, chunk.ID)
+	}
+	if len(chunks) == 0 {
+		c.finish()
+	}
+	return c
+}
+
+// Done is closed once every chunk is reported, a domain match ended the scan
+// or a chunk failed on every attempt
+func (c *Coordinator) Done() <-chan struct{} {
+	return c.done
+}
+
+// Err returns why the scan failed, or nil
+func (c *Coordinator) Err() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.err
+}
+
+// Run queues the chunks of expired leases again until the scan is done or ctx ends
+func (c *Coordinator) Run(ctx context.Context) {
+	ticker := time.NewTicker(c.lease / 4)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			c.mu.Lock()
+			c.requeueExpired(time.Now())
+			c.mu.Unlock()
+		case <-c.done:
+			return
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// requeueExpired puts the chunks of expired leases back in front of the queue
+func (c *Coordinator) requeueExpired(now time.Time) {
+	var expired []int
+	for id, l := range c.leases {
+		if now.After(l.expires) {
+			config.WarnLog("Worker %s lost chunk %d, queued again", l.worker, id)
+			expired = append(expired, id)
+			delete(c.leases, id)
+		}
+	}
+	sort.Ints(expired)
+	c.pending = append(expired, c.pending...)
+	c.requeued += len(expired)
+}
+
+// next leases the next pending chunk to worker
+func (c *Coordinator) next(worker string) (*Assignment, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.seen(worker)
+	if c.finished {
+		return nil, false
+	}
+	c.requeueExpired(time.Now())
+	if len(c.pending) == 0 {
+		return nil, true
+	}
+
+	id := c.pending[0]
+	c.pending = c.pending[1:]
+	l := &lease{id: newLeaseID(), chunk: id, worker: worker, expires: time.Now().Add(c.lease)}
+	c.leases[id] = l
+	c.issued[l.id] = l
+	config.VerboseLog("Chunk %d leased to %s", id, worker)
+
+	return &Assignment{
+		Task:         c.task,
+		Chunk:        c.chunks[id],
+		Lease:        l.id,
+		LeaseSeconds: int(c.lease.Seconds()),
+	}, true
+}
+
+// renew extends a lease, it fails when the lease expired and the chunk was queued again
+func (c *Coordinator) renew(hb Heartbeat) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.seen(hb.Worker)
+	l, ok := c.leases[hb.Chunk]
+	if !ok || l.id != hb.Lease || l.worker != hb.Worker {
+		return false
+	}
+	l.expires = time.Now().Add(c.lease)
+	return true
+}
+
+// complete records the report of a chunk, it fails when the worker was never
+// given the chunk under the reported lease. A report arriving after its lease
+// expired is still used if the chunk was not reported by another worker.
+func (c *Coordinator) complete(result ChunkResult) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if l, ok := c.issued[result.Lease]; !ok || l.chunk != result.Chunk || l.worker != result.Worker {
+		config.WarnLog("Report of chunk %d by %s ignored, the worker does not hold its lease", result.Chunk, result.Worker)
+		return false
+	}
+	c.seen(result.Worker)
+	if _, ok := c.results[result.Chunk]; ok || c.finished {
+		return true
+	}
+
+	if result.Error != "" {
+		c.fail(result)
+		return true
+	}
+
+	c.results[result.Chunk] = result.Report
+	delete(c.leases, result.Chunk)
+	for i, id := range c.pending {
+		if id == result.Chunk {
+			c.pending = append(c.pending[:i], c.pending[i+1:]...)
+			break
+		}
+	}
+	c.workers[result.Worker].Chunks++
+	config.InfoLog("Chunk %d/%d done by %s (%d sites)", len(c.results), len(c.chunks), result.Worker, len(result.Report.FoundedWebsites))
+
+	if !c.task.Continue && result.Report.Method == "Search Domain by ASN" {
+		c.matched = true
+		config.InfoLog("Domain matched in chunk %d, stopping the scan", result.Chunk)
+	}
+	if c.matched || len(c.results) == len(c.chunks) {
+		c.finish()
+	}
+	return true
+}
+
+// fail queues a failed chunk again, or fails the scan after maxChunkFailures attempts
+func (c *Coordinator) fail(result ChunkResult) {
+	if l, ok := c.leases[result.Chunk]; !ok || l.id != result.Lease {
+		// The chunk was queued again already
+		return
+	}
+	delete(c.leases, result.Chunk)
+
+	c.failures[result.Chunk]++
+	config.WarnLog("Chunk %d failed on %s: %s", result.Chunk, result.Worker, result.Error)
+	if c.failures[result.Chunk] >= maxChunkFailures {
+		c.err = fmt.Errorf("chunk %d failed %d times, last error: %s", result.Chunk, maxChunkFailures, result.Error)
+		c.finish()
+		return
+	}
+	c.pending = append(c.pending, result.Chunk)
+}
+
+// seen records the last contact with a worker
+func (c *Coordinator) seen(worker string) {
+	w, ok := c.workers[worker]
+	if !ok {
+		w = &WorkerStatus{Name: worker}
+		c.workers[worker] = w
+		config.InfoLog("Worker %s joined", worker)
+	}
+	w.LastSeen = time.Now().UTC()
+}
+
+func (c *Coordinator) finish() {
+	if !c.finished {
+		c.finished = true
+		c.end = time.Now()
+		close(c.done)
+	}
+}
+
+// Status returns the progress of the scan
+func (c *Coordinator) Status() Status {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	s := Status{
+		Chunks:  len(c.chunks),
+		Pending: len(c.pending),
+		Leased:  len(c.leases),
+		Done:    len(c.results),
+		Requeue: c.requeued,
+		Matched: c.matched,
+		Workers: []WorkerStatus{},
+	}
+	for _, r := range c.results {
+		s.Hits += len(r.FoundedWebsites)
+	}
+	for _, w := range c.workers {
+		s.Workers = append(s.Workers, *w)
+	}
+	sort.Slice(s.Workers, func(i, j int) bool { return s.Workers[i].Name < s.Workers[j].Name })
+	return s
+}
+
+// Report merges the chunk reports in chunk order
+func (c *Coordinator) Report() modules.ResultData {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	reports := make([]modules.ResultData, 0, len(c.results))
+	for _, chunk := range c.chunks {
+		if r, ok := c.results[chunk.ID]; ok {
+			reports = append(reports, r)
+		}
+	}
+
+	// The chunks of a scan all search the coordinator's domain
+	merged, _ := modules.MergeResults(reports...)
+	merged.IPBlocks = c.blocks
+	if merged.Summary != nil {
+		// The chunks ran on several workers, the scan took the coordinator's wall time
+		elapsed := time.Since(c.start)
+		if c.finished {
+			elapsed = c.end.Sub(c.start)
+		}
+		summary := modules.MergeSummaries(elapsed, merged.Summary)
+		var total int64
+		for _, chunk := range c.chunks {
+			total += int64(len(chunk.Addresses))
+		}
+		summary.Addresses = total
+		merged.Summary = summary
+	}
+	return merged
+}
+
+// Handler returns the HTTP handler used by the workers:
+//
+//	POST /work        lease a chunk (200), none free yet (204), scan over (410)
+//	POST /heartbeat   renew a lease (204), lease lost (409)
+//	POST /results     report a chunk (204), lease not held (409)
+//	GET  /status      progress of the scan
+//
+// With a Token, requests without "Authorization: Bearer <token>" get a 401.
+func (c *Coordinator) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/work", func(w http.ResponseWriter, r *http.Request) {
+		var req WorkRequest
+		if !decode(w, r, &req) {
+			return
+		}
+		assignment, open := c.next(req.Worker)
+		switch {
+		case !open:
+			writeError(w, http.StatusGone, "the scan is over")
+		case assignment == nil:
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			writeJSON(w, http.StatusOK, assignment)
+		}
+	})
+	mux.HandleFunc("/heartbeat", func(w http.ResponseWriter, r *http.Request) {
+		var hb Heartbeat
+		if !decode(w, r, &hb) {
+			return
+		}
+		if !c.renew(hb) {
+			writeError(w, http.StatusConflict, "lease expired")
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+	mux.HandleFunc("/results", func(w http.ResponseWriter, r *http.Request) {
+		var result ChunkResult
+		if !decode(w, r, &result) {
+			return
+		}
+		if !c.complete(result) {
+			writeError(w, http.StatusConflict, "lease not held")
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+	mux.HandleFunc("/status", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, c.Status())
+	})
+
+	if c.Token == "" {
+		return mux
+	}
+	want := []byte("Bearer " + c.Token)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), want) != 1 {
+			writeError(w, http.StatusUnauthorized, "invalid token")
+			return
+		}
+		mux.ServeHTTP(w, r)
+	})
+}
+
+// decode reads the JSON body of a POST request with a worker name
+func decode(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return false
+	}
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 64<<20)).Decode(v); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body: "+err.Error())
+		return false
+	}
+	return true
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, map[string]string{"error": message})
+}
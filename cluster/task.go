@@ -0,0 +1,107 @@
+// Package cluster spreads a scan over several ipmap processes.
+//
+// A Coordinator splits the target addresses into chunks and serves them over
+// HTTP. Workers lease a chunk, probe it with their own limits, renew the lease
+// while probing and push the chunk report back. Chunks whose lease expires
+// (a worker died or lost the network) are queued again, and the chunk reports
+// are merged into a single report once every chunk is done.
+package cluster
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"ipmap/modules"
+	"ipmap/scanner"
+	"time"
+)
+
+// Task holds the scan settings shared by every worker
+type Task struct {
+	Domain      string                   `json:"domain,omitempty"`
+	Timeout     string                   `json:"timeout,omitempty"` // "300" or "200-3000", adaptive when empty
+	Continue    bool                     `json:"continue,omitempty"`
+	Baseline    *scanner.Baseline        `json:"baseline,omitempty"` // domain response captured by the coordinator
+	FaviconHash string                   `json:"favicon_hash,omitempty"`
+	Threshold   int                      `json:"threshold,omitempty"`
+	ExcludeCDN  bool                     `json:"exclude_cdn,omitempty"`
+	Tech        []string                 `json:"tech,omitempty"`
+	NoRedirect  bool                     `json:"no_redirect,omitempty"`
+	Request     *modules.RequestTemplate `json:"request,omitempty"`
+}
+
+// Chunk is a part of the target addresses probed by one worker
+type Chunk struct {
+	ID        int      `json:"id"`
+	Addresses []string `json:"addresses"`
+}
+
+// SplitChunks splits the addresses into chunks of at most size addresses
+func SplitChunks(addresses []string, size int) []Chunk {
+	if size < 1 {
+		size = 1
+	}
+	var chunks []Chunk
+	for start := 0; start < len(addresses); start += size {
+		end := start + size
+		if end > len(addresses) {
+			end = len(addresses)
+		}
+		chunks = append(chunks, Chunk{ID: len(chunks), Addresses: addresses[start:end]})
+	}
+	return chunks
+}
+
+// Assignment is a chunk leased to a worker
+type Assignment struct {
+	Task         Task   `json:"task"`
+	Chunk        Chunk  `json:"chunk"`
+	Lease        string `json:"lease"`
+	LeaseSeconds int    `json:"lease_seconds"` // the lease expires unless renewed within this time
+}
+
+// WorkRequest asks the coordinator for a chunk
+type WorkRequest struct {
+	Worker string `json:"worker"`
+}
+
+// Heartbeat renews the lease of a chunk
+type Heartbeat struct {
+	Worker string `json:"worker"`
+	Chunk  int    `json:"chunk"`
+	Lease  string `json:"lease"`
+}
+
+// ChunkResult is the report of a probed chunk
+type ChunkResult struct {
+	Worker string             `json:"worker"`
+	Chunk  int                `json:"chunk"`
+	Lease  string             `json:"lease"`
+	Report modules.ResultData `json:"report"`
+	Error  string             `json:"error,omitempty"` // the chunk could not be probed
+}
+
+// Status describes the progress of a distributed scan
+type Status struct {
+	Chunks  int            `json:"chunks"`
+	Pending int            `json:"pending"`
+	Leased  int            `json:"leased"`
+	Done    int            `json:"done"`
+	Requeue int            `json:"requeued"` // leases that expired
+	Hits    int            `json:"hits"`
+	Matched bool           `json:"matched,omitempty"`
+	Workers []WorkerStatus `json:"workers"`
+}
+
+// WorkerStatus describes a worker seen by the coordinator
+type WorkerStatus struct {
+	Name     string    `json:"name"`
+	LastSeen time.Time `json:"last_seen"`
+	Chunks   int       `json:"chunks"` // chunks reported by the worker
+}
+
+// newLeaseID returns a random lease ID
+func newLeaseID() string {
+	b := make([]byte, 8)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
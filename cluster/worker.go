@@ -0,0 +1,229 @@
+package cluster
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"ipmap/config"
+	"ipmap/modules"
+	"ipmap/scanner"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// pollInterval is how long a worker waits when no chunk is free
+const pollInterval = time.Second
+
+// ScanFunc probes a chunk and returns its report
+type ScanFunc func(ctx context.Context, task Task, chunk Chunk) (modules.ResultData, error)
+
+// Worker leases chunks from a coordinator and probes them
+type Worker struct {
+	URL     string          // coordinator URL, e.g. http://10.0.0.1:8091
+	Name    string          // worker name reported to the coordinator
+	Token   string          // shared secret of the coordinator, empty for none
+	Options scanner.Options // limits of this worker (workers, rate, retries, pre-scan)
+	Wait    time.Duration   // how long the coordinator may be unreachable before Run fails
+	Client  *http.Client
+
+	scan ScanFunc
+	poll time.Duration
+}
+
+// NewWorker creates a worker for the coordinator at url probing with opts
+func NewWorker(url string, opts scanner.Options) *Worker {
+	w := &Worker{
+		URL:     strings.TrimRight(url, "/"),
+		Name:    DefaultWorkerName(),
+		Options: opts,
+		Wait:    time.Minute,
+		Client:  &http.Client{Timeout: 30 * time.Second},
+		poll:    pollInterval,
+	}
+	w.scan = w.scanChunk
+	return w
+}
+
+// DefaultWorkerName returns host-pid
+func DefaultWorkerName() string {
+	host, err := os.Hostname()
+	if err != nil {
+		host = "worker"
+	}
+	return fmt.Sprintf("%s-%d", host, os.Getpid())
+}
+
+// Run probes chunks until the coordinator reports the scan is over or ctx ends
+func (w *Worker) Run(ctx context.Context) error {
+	var unreachable time.Time
+	for {
+		var assignment Assignment
+		status, err := w.post(ctx, "/work", WorkRequest{Worker: w.Name}, &assignment)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		switch {
+		case err != nil:
+			// The coordinator may not be up yet or be restarting
+			if unreachable.IsZero() {
+				unreachable = time.Now()
+			}
+			if time.Since(unreachable) > w.Wait {
+				return fmt.Errorf("coordinator unreachable: %w", err)
+			}
+			config.VerboseLog("Coordinator unreachable: %v", err)
+		case status == http.StatusGone:
+			return nil
+		case status == http.StatusUnauthorized:
+			return errors.New("the coordinator refused the token")
+		case status == http.StatusOK:
+			unreachable = time.Time{}
+			w.process(ctx, assignment)
+			continue
+		default:
+			unreachable = time.Time{}
+		}
+
+		select {
+		case <-time.After(w.poll):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// process probes a leased chunk, renewing the lease until the report is sent
+func (w *Worker) process(ctx context.Context, a Assignment) {
+	chunkCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	config.InfoLog("Probing chunk %d (%d addresses)", a.Chunk.ID, len(a.Chunk.Addresses))
+	lost := make(chan struct{})
+	go w.heartbeat(chunkCtx, a, func() {
+		close(lost)
+		cancel()
+	})
+
+	report, err := w.scan(chunkCtx, a.Task, a.Chunk)
+	select {
+	case <-lost:
+		config.WarnLog("Lease of chunk %d expired, the chunk was handed to another worker", a.Chunk.ID)
+		return
+	default:
+	}
+	if ctx.Err() != nil {
+		return
+	}
+
+	result := ChunkResult{Worker: w.Name, Chunk: a.Chunk.ID, Lease: a.Lease, Report: report}
+	if err != nil {
+		result.Error = err.Error()
+		config.ErrorLog("Chunk %d failed: %v", a.Chunk.ID, err)
+	}
+
+	// The report is retried while the coordinator is unreachable
+	deadline := time.Now().Add(w.Wait)
+	for {
+		_, err := w.post(ctx, "/results", result, nil)
+		if err == nil || ctx.Err() != nil {
+			return
+		}
+		if time.Now().After(deadline) {
+			config.ErrorLog("Report of chunk %d could not be sent: %v", a.Chunk.ID, err)
+			return
+		}
+		select {
+		case <-time.After(w.poll):
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// heartbeat renews the lease three times per lease period, calling lost when it expired
+func (w *Worker) heartbeat(ctx context.Context, a Assignment, lost func()) {
+	interval := time.Duration(a.LeaseSeconds) * time.Second / 3
+	if interval <= 0 {
+		interval = time.Second
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			status, err := w.post(ctx, "/heartbeat", Heartbeat{Worker: w.Name, Chunk: a.Chunk.ID, Lease: a.Lease}, nil)
+			if err == nil && status == http.StatusConflict {
+				lost()
+				return
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// scanChunk probes the chunk addresses with the worker's scanner options
+func (w *Worker) scanChunk(ctx context.Context, task Task, chunk Chunk) (modules.ResultData, error) {
+	opts := w.Options
+	opts.ASN, opts.IPBlocks, opts.Addresses = "", nil, chunk.Addresses
+	opts.Domain = task.Domain
+	opts.Timeout = task.Timeout
+	opts.Continue = task.Continue
+	opts.Baseline = task.Baseline
+	opts.FaviconHash = task.FaviconHash
+	opts.ExcludeCDN = task.ExcludeCDN
+	if task.Threshold > 0 {
+		opts.Threshold = task.Threshold
+	}
+	opts.Tech = task.Tech
+	opts.FollowRedirects = !task.NoRedirect
+	opts.Request = task.Request
+
+	s, err := scanner.New(opts)
+	if err != nil {
+		return modules.ResultData{}, err
+	}
+	result, err := s.Scan(ctx)
+	if err != nil {
+		return modules.ResultData{}, err
+	}
+	return result.Report, nil
+}
+
+// post sends v as JSON to the coordinator and decodes a 200 response into out
+func (w *Worker) post(ctx context.Context, path string, v interface{}, out interface{}) (int, error) {
+	body, err := json.Marshal(v)
+	if err != nil {
+		return 0, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.URL+path, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if w.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+w.Token)
+	}
+
+	resp, err := w.Client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusOK && out != nil:
+		return resp.StatusCode, json.NewDecoder(resp.Body).Decode(out)
+	case resp.StatusCode >= 500:
+		data, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return resp.StatusCode, fmt.Errorf("coordinator error %d: %s", resp.StatusCode, strings.TrimSpace(string(data)))
+	}
+	return resp.StatusCode, nil
+}
@@ -12,6 +12,16 @@ var (
 	ProxyURL   string       // HTTP/HTTPS/SOCKS5 proxy URL
 	RateLimit  int      = 0 // Requests per second (0 = unlimited)
 	DNSServers []string     // Custom DNS servers
+
+	FaviconHash    string        // Favicon hash (mmh3 or sha256) to match on found sites
+	MatchThreshold int      = 75 // Similarity score (0-100) to consider a site as the domain
+	ExcludeEdges   bool          // Ignore CDN/WAF edges when deciding domain matches
+	TechFilter     []string      // Only report sites running one of these technologies
+
+	FollowRedirects bool = true // Follow redirects (up to 10 hops)
+
+	PreScan        bool       // TCP connect check before HTTP probing
+	PreScanTimeout int  = 500 // TCP connect timeout of the pre-scan in milliseconds
 )
 
 // VerboseLog prints message only if verbose mode is enabled
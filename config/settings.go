@@ -0,0 +1,38 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// Settings are the values of a -config file. They are applied at startup and
+// the rate and worker settings again on SIGHUP, so a running scan can be tuned.
+type Settings struct {
+	Workers *int `json:"workers,omitempty"`
+	Rate    *int `json:"rate,omitempty"`
+	Retries *int `json:"retries,omitempty"`
+}
+
+// LoadSettings reads a JSON settings file
+func LoadSettings(path string) (*Settings, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	settings := &Settings{}
+	if err := json.Unmarshal(data, settings); err != nil {
+		return nil, fmt.Errorf("invalid config file: %v", err)
+	}
+	if settings.Workers != nil && (*settings.Workers < 1 || *settings.Workers > 1000) {
+		return nil, fmt.Errorf("workers must be between 1 and 1000, got %d", *settings.Workers)
+	}
+	if settings.Rate != nil && *settings.Rate < 0 {
+		return nil, fmt.Errorf("rate must not be negative, got %d", *settings.Rate)
+	}
+	if settings.Retries != nil && (*settings.Retries < 0 || *settings.Retries > 10) {
+		return nil, fmt.Errorf("retries must be between 0 and 10, got %d", *settings.Retries)
+	}
+	return settings, nil
+}
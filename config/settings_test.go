@@ -0,0 +1,43 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadSettings(t *testing.T) {
+	dir := t.TempDir()
+
+	tests := []struct {
+		name    string
+		content string
+		wantErr bool
+	}{
+		{"valid", `{"workers": 50, "rate": 20, "retries": 1}`, false},
+		{"partial", `{"rate": 5}`, false},
+		{"invalid json", `{"workers": }`, true},
+		{"too many workers", `{"workers": 5000}`, true},
+		{"negative rate", `{"rate": -1}`, true},
+		{"too many retries", `{"retries": 11}`, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(dir, tt.name+".json")
+			_ = os.WriteFile(path, []byte(tt.content), 0o600)
+
+			settings, err := LoadSettings(path)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("LoadSettings() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.name == "partial" && (settings.Workers != nil || settings.Rate == nil || *settings.Rate != 5) {
+				t.Errorf("Partial settings = %+v", settings)
+			}
+		})
+	}
+
+	if _, err := LoadSettings(filepath.Join(dir, "missing.json")); err == nil {
+		t.Error("Expected error for missing file")
+	}
+}
@@ -3,13 +3,26 @@ module ipmap
 go 1.19
 
 require (
+	github.com/andybalholm/brotli v1.0.6
 	github.com/corpix/uarand v0.2.0
+	github.com/klauspost/compress v1.17.4
+	github.com/prometheus/client_golang v1.17.0
 	github.com/schollz/progressbar/v3 v3.14.1
+	golang.org/x/net v0.17.0
+	golang.org/x/term v0.14.0
 )
 
 require (
+	github.com/beorn7/perks v1.0.1 // indirect
+	github.com/cespare/xxhash/v2 v2.2.0 // indirect
+	github.com/golang/protobuf v1.5.3 // indirect
+	github.com/matttproud/golang_protobuf_extensions v1.0.4 // indirect
 	github.com/mitchellh/colorstring v0.0.0-20190213212951-d06e56a500db // indirect
+	github.com/prometheus/client_model v0.4.1-0.20230718164431-9a2bf3000d16 // indirect
+	github.com/prometheus/common v0.44.0 // indirect
+	github.com/prometheus/procfs v0.11.1 // indirect
 	github.com/rivo/uniseg v0.4.4 // indirect
 	golang.org/x/sys v0.14.0 // indirect
-	golang.org/x/term v0.14.0 // indirect
+	golang.org/x/text v0.13.0 // indirect
+	google.golang.org/protobuf v1.31.0 // indirect
 )
@@ -0,0 +1,223 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"ipmap/config"
+	"ipmap/modules"
+	"ipmap/tools"
+	"os"
+	"strings"
+	"sync"
+)
+
+// validFormat reports a -format value other than text and json
+func validFormat(format string) bool {
+	if format == "text" || format == "json" {
+		return true
+	}
+	fmt.Fprintln(os.Stderr, "Invalid format. Use text or json.")
+	return false
+}
+
+// writeJSON writes v as indented JSON
+func writeJSON(w io.Writer, v interface{}) {
+	data, _ := json.MarshalIndent(v, "", "  ")
+	fmt.Fprintln(w, string(data))
+}
+
+// runASN lists the IP blocks of ASNs: ipmap asn AS13335
+func runASN(cmd *command, args []string) int {
+	fs := newFlagSet(cmd)
+	format := fs.String("format", "text", "output format (text/json)")
+	if code, ok := parseFlags(fs, args); !ok {
+		return code
+	}
+	if fs.NArg() == 0 || !validFormat(*format) {
+		fs.Usage()
+		return exitUsage
+	}
+
+	type asnBlocks struct {
+		ASN      string   `json:"asn"`
+		IPBlocks []string `json:"ip_blocks"`
+	}
+
+	for _, asn := range fs.Args() {
+		if !modules.ValidateASN(asn) {
+			fmt.Fprintf(os.Stderr, "Invalid ASN %q, use the AS prefix and number (e.g. AS13335)\n", asn)
+			return exitUsage
+		}
+	}
+
+	var results []asnBlocks
+	found := false
+	for _, asn := range fs.Args() {
+		blocks, err := tools.ASNBlocks(asn)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "IP blocks of %s could not be queried: %v\n", asn, err)
+			return exitError
+		}
+		if len(blocks) == 0 {
+			fmt.Fprintln(os.Stderr, "[WARN] No IP blocks found for "+asn)
+			blocks = []string{}
+		}
+		found = found || len(blocks) > 0
+		results = append(results, asnBlocks{ASN: asn, IPBlocks: blocks})
+	}
+
+	if *format == "json" {
+		writeJSON(os.Stdout, results)
+	} else {
+		for _, result := range results {
+			for _, block := range result.IPBlocks {
+				fmt.Println(block)
+			}
+		}
+	}
+	if !found {
+		return exitNoResults
+	}
+	return exitOK
+}
+
+// runResolve prints the baseline a scan compares candidates with: ipmap resolve example.com
+func runResolve(cmd *command, args []string) int {
+	fs := newFlagSet(cmd)
+	format := fs.String("format", "text", "output format (text/json)")
+	verbose := fs.Bool("v", false, "verbose mode")
+	if code, ok := parseFlags(fs, args); !ok {
+		return code
+	}
+	if fs.NArg() != 1 || !validFormat(*format) {
+		fs.Usage()
+		return exitUsage
+	}
+	config.Verbose = *verbose
+
+	domain := fs.Arg(0)
+	if err := modules.ValidateHostname(domain); err != nil {
+		fmt.Fprintln(os.Stderr, "Invalid parameters:", err)
+		return exitUsage
+	}
+	engine := modules.NewEngine(modules.EngineSettings{
+		Retries:         config.MaxRetries,
+		FollowRedirects: config.FollowRedirects,
+		Verbose:         config.Verbose,
+		Log:             modules.PrintLog,
+	})
+	result := engine.GetDomainTitle(domain)
+	baseline := engine.DomainBaseline()
+	if len(result) == 0 || baseline == nil {
+		return exitError
+	}
+
+	if *format == "json" {
+		writeJSON(os.Stdout, struct {
+			Domain       string               `json:"domain"`
+			Title        string               `json:"title"`
+			ResponseTime string               `json:"response_time_ms"`
+			Baseline     *modules.Fingerprint `json:"baseline"`
+		}{domain, result[0], result[1], baseline})
+		return exitOK
+	}
+
+	fmt.Println("Domain:        " + domain)
+	fmt.Println("Title:         " + result[0])
+	fmt.Println("Response Time: " + result[1] + "ms")
+	fmt.Println("URL:           " + baseline.URL)
+	fmt.Printf("Status:        %d\n", baseline.StatusCode)
+	fmt.Println("Body SHA256:   " + baseline.BodySHA256)
+	if baseline.Server != "" {
+		fmt.Println("Server:        " + baseline.Server)
+	}
+	if len(baseline.CookieNames) > 0 {
+		fmt.Println("Cookies:       " + strings.Join(baseline.CookieNames, ", "))
+	}
+	if cert := baseline.Certificate; cert != nil {
+		fmt.Println("Certificate:   " + cert.Subject + " (issuer " + cert.Issuer + ", expires " + cert.NotAfter + ")")
+	}
+	if baseline.FaviconMMH3 != "" {
+		fmt.Println("Favicon:       " + baseline.FaviconMMH3 + " (sha256: " + baseline.FaviconSHA256 + ")")
+	}
+	if baseline.RedirectTarget != "" {
+		fmt.Println("Redirect:      " + baseline.RedirectTarget)
+	}
+	return exitOK
+}
+
+// runRDNS looks up the names of addresses and IP blocks: ipmap rdns 1.1.1.0/24
+func runRDNS(cmd *command, args []string) int {
+	fs := newFlagSet(cmd)
+	workers := fs.Int("workers", 50, "number of concurrent lookups")
+	all := fs.Bool("all", false, "also list the addresses without a name")
+	format := fs.String("format", "text", "output format (text/json)")
+	if code, ok := parseFlags(fs, args); !ok {
+		return code
+	}
+	if fs.NArg() == 0 || !validFormat(*format) {
+		fs.Usage()
+		return exitUsage
+	}
+
+	var ips []string
+	for _, arg := range fs.Args() {
+		if !modules.ValidateIP(arg) {
+			fmt.Fprintf(os.Stderr, "Invalid address %q, use an IP address or a CIDR block (e.g. 1.1.1.0/24)\n", arg)
+			return exitUsage
+		}
+		if !strings.Contains(arg, "/") {
+			ips = append(ips, arg)
+			continue
+		}
+		expanded, err := tools.ExpandBlocks([]string{arg})
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Invalid IP block:", err)
+			return exitUsage
+		}
+		ips = append(ips, expanded...)
+	}
+
+	// Lookups run in parallel, the names keep the order of the addresses
+	names := make([]string, len(ips))
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < modules.ValidateWorkerCount(*workers); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				names[i] = strings.TrimSuffix(modules.ReverseDNS(ips[i]), ".")
+			}
+		}()
+	}
+	for i := range ips {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	type record struct {
+		IP       string `json:"ip"`
+		Hostname string `json:"hostname"`
+	}
+	records := []record{}
+	for i, ip := range ips {
+		if names[i] != "" || *all {
+			records = append(records, record{ip, names[i]})
+		}
+	}
+
+	if *format == "json" {
+		writeJSON(os.Stdout, records)
+	} else {
+		for _, r := range records {
+			fmt.Println(r.IP + "\t" + r.Hostname)
+		}
+	}
+	if len(records) == 0 {
+		return exitNoResults
+	}
+	return exitOK
+}
@@ -0,0 +1,262 @@
+package modules
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Bounds used when -t is not given
+const (
+	DefaultMinTimeout = 300
+	DefaultMaxTimeout = 10000
+)
+
+const (
+	calibrationSamples = 20   // samples taken at the initial timeout before it adapts
+	latencyWindow      = 1000 // most recent samples kept for percentiles
+	timeoutMultiplier  = 2.0  // applied to the p95 latency
+)
+
+// AdaptiveTimeout tracks response latencies and derives the per-request
+// timeout from them. The first calibrationSamples samples are taken at the
+// initial timeout, then the timeout follows twice the p95 latency. Requests
+// that time out on a connected host count at the timeout they had, so slow
+// hosts keep the timeout from shrinking below them.
+type AdaptiveTimeout struct {
+	mu       sync.Mutex
+	min      int
+	max      int
+	initial  int
+	samples  []int
+	next     int
+	total    int
+	timeouts int
+	current  int
+	log      func(format string, args ...interface{}) // verbose logger of the engine, may be nil
+}
+
+// TimeoutStats reports the effective timeout values of a scan
+type TimeoutStats struct {
+	Mode     string `json:"mode"`
+	Min      int    `json:"min_ms"`
+	Max      int    `json:"max_ms"`
+	Current  int    `json:"current_ms"`
+	Samples  int    `json:"samples"`
+	Timeouts int    `json:"timeouts,omitempty"` // samples of connected hosts that timed out
+	P50      int    `json:"p50_ms,omitempty"`
+	P90      int    `json:"p90_ms,omitempty"`
+	P99      int    `json:"p99_ms,omitempty"`
+}
+
+// SetAdaptiveTimeout enables (or with nil disables) adaptive probe timeouts
+func (e *Engine) SetAdaptiveTimeout(at *AdaptiveTimeout) {
+	if e == nil {
+		return
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.timeout = at
+}
+
+// AdaptiveTimeout returns the active adaptive timeout, or nil
+func (e *Engine) AdaptiveTimeout() *AdaptiveTimeout {
+	if e == nil {
+		return nil
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.timeout
+}
+
+// NewAdaptiveTimeout creates an adaptive timeout bounded by min and max (ms).
+// initial is used until enough responses have been observed.
+func NewAdaptiveTimeout(min int, max int, initial int) *AdaptiveTimeout {
+	if max < min {
+		min, max = max, min
+	}
+	at := &AdaptiveTimeout{
+		min:     min,
+		max:     max,
+		samples: make([]int, 0, latencyWindow),
+	}
+	at.initial = at.clamp(initial)
+	at.current = at.initial
+	return at
+}
+
+// ParseTimeoutRange parses "-t" values: "300" for a fixed timeout or "200-3000" for bounds
+func ParseTimeoutRange(s string) (int, int, error) {
+	s = strings.TrimSpace(s)
+	parse := func(p string) (int, error) {
+		v, err := strconv.Atoi(strings.TrimSpace(p))
+		if err != nil || v <= 0 {
+			return 0, fmt.Errorf("invalid timeout %q, use 300 or 200-3000", s)
+		}
+		return v, nil
+	}
+
+	// A range needs both bounds, "300-" and "-3000" are rejected
+	lo, hi, ranged := strings.Cut(s, "-")
+	if !ranged {
+		lo, hi, ranged = strings.Cut(s, ":")
+	}
+	min, err := parse(lo)
+	if err != nil {
+		return 0, 0, err
+	}
+	if !ranged {
+		return min, min, nil
+	}
+	max, err := parse(hi)
+	if err != nil {
+		return 0, 0, err
+	}
+	if min > max {
+		return 0, 0, fmt.Errorf("invalid timeout %q, minimum is greater than maximum", s)
+	}
+	return min, max, nil
+}
+
+// Observe records the latency of a successful response in milliseconds
+func (at *AdaptiveTimeout) Observe(ms int64) {
+	if at == nil {
+		return
+	}
+
+	at.mu.Lock()
+	defer at.mu.Unlock()
+	at.add(int(ms))
+}
+
+// ObserveTimeout records a request to a connected host that timed out after
+// ms milliseconds. Its latency is at least the timeout, leaving it out would
+// let the timeout shrink below the slow hosts.
+func (at *AdaptiveTimeout) ObserveTimeout(ms int) {
+	if at == nil {
+		return
+	}
+
+	at.mu.Lock()
+	defer at.mu.Unlock()
+	at.timeouts++
+	at.add(ms)
+}
+
+// add records a sample and adapts the timeout once calibrated, must be called with the lock held
+func (at *AdaptiveTimeout) add(ms int) {
+	if len(at.samples) < latencyWindow {
+		at.samples = append(at.samples, ms)
+	} else {
+		at.samples[at.next] = ms
+		at.next = (at.next + 1) % latencyWindow
+	}
+	at.total++
+
+	if at.total == calibrationSamples && at.log != nil {
+		at.log("Adaptive timeout calibrated over %d samples (%d timed out)", at.total, at.timeouts)
+	}
+	if at.total >= calibrationSamples {
+		p95 := percentile(at.samples, 95)
+		at.current = at.clamp(int(float64(p95) * timeoutMultiplier))
+	}
+}
+
+// Timeout returns the timeout for the next request in milliseconds
+func (at *AdaptiveTimeout) Timeout() int {
+	at.mu.Lock()
+	defer at.mu.Unlock()
+	return at.current
+}
+
+// Calibrated reports whether enough samples were taken to adapt the timeout
+func (at *AdaptiveTimeout) Calibrated() bool {
+	at.mu.Lock()
+	defer at.mu.Unlock()
+	return at.total >= calibrationSamples
+}
+
+// Stats returns the current timeout and latency percentiles
+func (at *AdaptiveTimeout) Stats() *TimeoutStats {
+	at.mu.Lock()
+	defer at.mu.Unlock()
+
+	stats := &TimeoutStats{
+		Mode:     "adaptive",
+		Min:      at.min,
+		Max:      at.max,
+		Current:  at.current,
+		Samples:  at.total,
+		Timeouts: at.timeouts,
+	}
+	if len(at.samples) > 0 {
+		stats.P50 = percentile(at.samples, 50)
+		stats.P90 = percentile(at.samples, 90)
+		stats.P99 = percentile(at.samples, 99)
+	}
+	return stats
+}
+
+func (at *AdaptiveTimeout) clamp(v int) int {
+	if v < at.min {
+		return at.min
+	}
+	if v > at.max {
+		return at.max
+	}
+	return v
+}
+
+// ProbeTimeout returns the timeout to use for the next probe, falling back to the fixed value
+func (e *Engine) ProbeTimeout(fixed int) int {
+	if at := e.AdaptiveTimeout(); at != nil {
+		return at.Timeout()
+	}
+	return fixed
+}
+
+// percentile returns the p-th percentile (nearest rank) of the values
+func percentile(values []int, p int) int {
+	if len(values) == 0 {
+		return 0
+	}
+
+	sorted := append([]int(nil), values...)
+	sort.Ints(sorted)
+
+	rank := (p*len(sorted) + 99) / 100
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1]
+}
+
+// ConfigureTimeout applies a -t value and returns the initial probe timeout.
+// A single value is a fixed timeout; a range or an empty value enables the
+// adaptive timeout, starting from twice the domain response time (domainMs,
+// 0 if unknown) or 3000ms.
+func (e *Engine) ConfigureTimeout(spec string, domainMs int) (int, error) {
+	min, max := DefaultMinTimeout, DefaultMaxTimeout
+	if spec != "" {
+		var err error
+		if min, max, err = ParseTimeoutRange(spec); err != nil {
+			return 0, err
+		}
+		if min == max {
+			e.SetAdaptiveTimeout(nil)
+			return min, nil
+		}
+	}
+
+	initial := 3000
+	if domainMs > 0 {
+		initial = domainMs * 2
+	}
+	at := NewAdaptiveTimeout(min, max, initial)
+	at.log = e.verbose
+	e.SetAdaptiveTimeout(at)
+	e.info("Adaptive timeout: %d-%dms, starting at %dms for the first %d samples", min, max, at.Timeout(), calibrationSamples)
+	return at.Timeout(), nil
+}
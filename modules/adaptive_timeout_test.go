@@ -0,0 +1,166 @@
+package modules
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestParseTimeoutRange(t *testing.T) {
+	tests := []struct {
+		input   string
+		min     int
+		max     int
+		wantErr bool
+	}{
+		{"300", 300, 300, false},
+		{"200-3000", 200, 3000, false},
+		{"200:3000", 200, 3000, false},
+		{" 500 ", 500, 500, false},
+		{"", 0, 0, true},
+		{"abc", 0, 0, true},
+		{"0", 0, 0, true},
+		{"3000-200", 0, 0, true},
+		{"1-2-3", 0, 0, true},
+		{"300-", 0, 0, true},
+		{"-3000", 0, 0, true},
+		{"300:", 0, 0, true},
+		{":3000", 0, 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			min, max, err := ParseTimeoutRange(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseTimeoutRange(%q) error = %v, wantErr %v", tt.input, err, tt.wantErr)
+			}
+			if min != tt.min || max != tt.max {
+				t.Errorf("ParseTimeoutRange(%q) = (%d, %d), want (%d, %d)", tt.input, min, max, tt.min, tt.max)
+			}
+		})
+	}
+}
+
+func TestAdaptiveTimeoutCalibration(t *testing.T) {
+	at := NewAdaptiveTimeout(300, 5000, 3000)
+	if at.Timeout() != 3000 {
+		t.Fatalf("Initial timeout = %d, want 3000", at.Timeout())
+	}
+
+	for i := 0; i < calibrationSamples-1; i++ {
+		at.Observe(100)
+	}
+	if at.Calibrated() || at.Timeout() != 3000 {
+		t.Errorf("Timeout should not adapt before %d samples, got %d", calibrationSamples, at.Timeout())
+	}
+
+	at.Observe(100)
+	if !at.Calibrated() {
+		t.Error("Expected calibrated timeout")
+	}
+	// p95 of 100ms * 2 is below the minimum, so it is clamped
+	if at.Timeout() != 300 {
+		t.Errorf("Timeout = %d, want 300", at.Timeout())
+	}
+
+	for i := 0; i < latencyWindow; i++ {
+		at.Observe(1000)
+	}
+	if at.Timeout() != 2000 {
+		t.Errorf("Timeout = %d, want 2000", at.Timeout())
+	}
+
+	for i := 0; i < latencyWindow; i++ {
+		at.Observe(9000)
+	}
+	if at.Timeout() != 5000 {
+		t.Errorf("Timeout should be clamped to max, got %d", at.Timeout())
+	}
+}
+
+func TestAdaptiveTimeoutSlowHosts(t *testing.T) {
+	at := NewAdaptiveTimeout(100, 8000, 1000)
+
+	// One host in ten is slower than any timeout, the others answer in 50ms
+	for i := 0; i < 200; i++ {
+		if i%10 == 0 {
+			at.ObserveTimeout(at.Timeout())
+		} else {
+			at.Observe(50)
+		}
+	}
+	if at.Timeout() < 1000 {
+		t.Errorf("Timeout shrank to %d with slow hosts present, want at least 1000", at.Timeout())
+	}
+	if stats := at.Stats(); stats.Timeouts != 20 || stats.Samples != 200 {
+		t.Errorf("Stats = %+v, want 20 timeouts in 200 samples", stats)
+	}
+
+	// Once the slow hosts are gone the timeout follows the fast ones again
+	for i := 0; i < latencyWindow; i++ {
+		at.Observe(50)
+	}
+	if at.Timeout() != 100 {
+		t.Errorf("Timeout = %d without slow hosts, want 100", at.Timeout())
+	}
+}
+
+func TestRequestTimeoutsFeedAdaptiveTimeout(t *testing.T) {
+	release := make(chan struct{})
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	defer slow.Close()
+	defer close(release)
+
+	closed := httptest.NewServer(http.NotFoundHandler())
+	closedURL := closed.URL
+	closed.Close()
+
+	e := NewEngine(EngineSettings{})
+	at := NewAdaptiveTimeout(100, 5000, 200)
+	e.SetAdaptiveTimeout(at)
+	if resp := e.doTemplateRequest(slow.URL, "", 200, 0, nil); resp != nil {
+		t.Fatalf("Slow host answered: %+v", resp)
+	}
+	_ = e.doTemplateRequest(closedURL, "", 200, 0, nil)
+
+	// Only the connected host that timed out is a sample
+	if stats := at.Stats(); stats.Timeouts != 1 || stats.Samples != 1 {
+		t.Errorf("Stats = %+v, want the slow host as the only timeout sample", stats)
+	}
+}
+
+func TestAdaptiveTimeoutStats(t *testing.T) {
+	at := NewAdaptiveTimeout(100, 1000, 50)
+	if at.Timeout() != 100 {
+		t.Errorf("Initial timeout should be clamped to min, got %d", at.Timeout())
+	}
+
+	for i := 1; i <= 100; i++ {
+		at.Observe(int64(i))
+	}
+	stats := at.Stats()
+	if stats.Mode != "adaptive" || stats.Samples != 100 {
+		t.Errorf("Stats = %+v", stats)
+	}
+	if stats.P50 != 50 || stats.P90 != 90 || stats.P99 != 99 {
+		t.Errorf("Percentiles = %d/%d/%d, want 50/90/99", stats.P50, stats.P90, stats.P99)
+	}
+}
+
+func TestProbeTimeout(t *testing.T) {
+	e := NewEngine(EngineSettings{})
+	if e.ProbeTimeout(700) != 700 {
+		t.Error("Fixed timeout should be used without adaptive timeout")
+	}
+	e.AdaptiveTimeout().Observe(100) // nil-safe
+
+	e.SetAdaptiveTimeout(NewAdaptiveTimeout(300, 5000, 1200))
+	if e.ProbeTimeout(700) != 1200 {
+		t.Errorf("ProbeTimeout = %d, want 1200", e.ProbeTimeout(700))
+	}
+}
@@ -0,0 +1,83 @@
+package modules
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/zstd"
+)
+
+// Limits applied to response bodies
+const (
+	maxBodySize    = 1024 * 1024      // bytes read from the connection
+	maxDecodedSize = 10 * 1024 * 1024 // bytes kept after decompression
+)
+
+// ErrDecodedTooLarge is returned when a decoded body exceeds the size limit
+var ErrDecodedTooLarge = errors.New("decoded body exceeds size limit")
+
+// DecodeContent decodes a body according to its Content-Encoding header.
+// Stacked encodings ("gzip, br") are removed in reverse order. When the decoded
+// body would exceed limit, the first limit bytes are returned with ErrDecodedTooLarge.
+func DecodeContent(body []byte, contentEncoding string, limit int64) ([]byte, error) {
+	var encodings []string
+	for _, enc := range strings.Split(contentEncoding, ",") {
+		if enc = strings.ToLower(strings.TrimSpace(enc)); enc != "" && enc != "identity" {
+			encodings = append(encodings, enc)
+		}
+	}
+
+	for i := len(encodings) - 1; i >= 0; i-- {
+		reader, err := newDecoder(encodings[i], body)
+		if err != nil {
+			return body, err
+		}
+
+		decoded, err := io.ReadAll(io.LimitReader(reader, limit+1))
+		if closer, ok := reader.(io.Closer); ok {
+			_ = closer.Close()
+		}
+		if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) {
+			return body, fmt.Errorf("%s: %v", encodings[i], err)
+		}
+
+		// Guard against decompression bombs
+		if int64(len(decoded)) > limit {
+			return decoded[:limit], ErrDecodedTooLarge
+		}
+		body = decoded
+	}
+
+	return body, nil
+}
+
+// newDecoder returns a reader decoding data with the given content coding
+func newDecoder(encoding string, data []byte) (io.Reader, error) {
+	switch encoding {
+	case "gzip", "x-gzip":
+		return gzip.NewReader(bytes.NewReader(data))
+	case "deflate":
+		// Servers send both zlib wrapped and raw deflate streams as "deflate"
+		if zr, err := zlib.NewReader(bytes.NewReader(data)); err == nil {
+			return zr, nil
+		}
+		return flate.NewReader(bytes.NewReader(data)), nil
+	case "br":
+		return brotli.NewReader(bytes.NewReader(data)), nil
+	case "zstd":
+		zr, err := zstd.NewReader(bytes.NewReader(data), zstd.WithDecoderMaxMemory(maxDecodedSize))
+		if err != nil {
+			return nil, err
+		}
+		return zr.IOReadCloser(), nil
+	default:
+		return nil, fmt.Errorf("unsupported content encoding: %s", encoding)
+	}
+}
@@ -0,0 +1,135 @@
+package modules
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/zstd"
+)
+
+func compress(t *testing.T, encoding string, data []byte) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	var w interface {
+		Write([]byte) (int, error)
+		Close() error
+	}
+
+	switch encoding {
+	case "gzip":
+		w = gzip.NewWriter(&buf)
+	case "deflate":
+		w = zlib.NewWriter(&buf)
+	case "raw-deflate":
+		fw, _ := flate.NewWriter(&buf, flate.DefaultCompression)
+		w = fw
+	case "br":
+		w = brotli.NewWriter(&buf)
+	case "zstd":
+		zw, err := zstd.NewWriter(&buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w = zw
+	default:
+		t.Fatalf("unknown encoding %s", encoding)
+	}
+
+	if _, err := w.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestDecodeContent(t *testing.T) {
+	page := []byte("<html><title>Compressed</title></html>")
+
+	tests := []struct {
+		name     string
+		encoding string
+		body     []byte
+	}{
+		{"gzip", "gzip", compress(t, "gzip", page)},
+		{"deflate zlib", "deflate", compress(t, "deflate", page)},
+		{"deflate raw", "deflate", compress(t, "raw-deflate", page)},
+		{"brotli", "br", compress(t, "br", page)},
+		{"zstd", "zstd", compress(t, "zstd", page)},
+		{"stacked", "gzip, br", compress(t, "br", compress(t, "gzip", page))},
+		{"identity", "identity", page},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := DecodeContent(tt.body, tt.encoding, maxDecodedSize)
+			if err != nil {
+				t.Fatalf("DecodeContent() error: %v", err)
+			}
+			if !bytes.Equal(got, page) {
+				t.Errorf("DecodeContent() = %q, want %q", got, page)
+			}
+		})
+	}
+}
+
+func TestDecodeContentLimit(t *testing.T) {
+	bomb := compress(t, "gzip", bytes.Repeat([]byte("A"), 1024*1024))
+
+	got, err := DecodeContent(bomb, "gzip", 1024)
+	if !errors.Is(err, ErrDecodedTooLarge) {
+		t.Fatalf("Expected ErrDecodedTooLarge, got %v", err)
+	}
+	if len(got) != 1024 {
+		t.Errorf("Decoded length = %d, want 1024", len(got))
+	}
+}
+
+func TestDecodeContentUnsupported(t *testing.T) {
+	body := []byte("data")
+	got, err := DecodeContent(body, "compress", maxDecodedSize)
+	if err == nil {
+		t.Error("Expected error for unsupported encoding")
+	}
+	if !bytes.Equal(got, body) {
+		t.Error("Body should be returned unchanged on error")
+	}
+}
+
+func TestDoRequestDecodesBody(t *testing.T) {
+	page := []byte("<html><title>Gzipped Site</title></html>")
+	gz := compress(t, "gzip", page)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.Contains(r.Header.Get("Accept-Encoding"), "gzip") {
+			t.Errorf("Accept-Encoding = %q, want gzip", r.Header.Get("Accept-Encoding"))
+		}
+		w.Header().Set("Content-Encoding", "gzip")
+		_, _ = w.Write(gz)
+	}))
+	defer server.Close()
+
+	resp := DoRequest(server.URL, "", 5000, 0)
+	if resp == nil {
+		t.Fatal("Request to test server failed")
+	}
+	if !bytes.Equal(resp.Body, page) {
+		t.Errorf("Body = %q, want decoded page", resp.Body)
+	}
+	if resp.Header.Get("Content-Encoding") != "" {
+		t.Error("Content-Encoding should be removed after decoding")
+	}
+	if title, _ := ExtractTitle(resp.Body, ""); title != "Gzipped Site" {
+		t.Errorf("Title = %q, want %q", title, "Gzipped Site")
+	}
+}
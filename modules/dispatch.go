@@ -0,0 +1,197 @@
+package modules
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Dispatcher hands out worker slots in ScanSites. Unlike a buffered channel
+// its limit can change during the scan, and dispatching can be paused.
+type Dispatcher struct {
+	mu     sync.Mutex
+	cond   *sync.Cond
+	limit  int
+	active int
+	paused bool
+}
+
+// NewDispatcher creates a dispatcher running at most limit workers
+func NewDispatcher(limit int) *Dispatcher {
+	d := &Dispatcher{limit: ValidateWorkerCount(limit)}
+	d.cond = sync.NewCond(&d.mu)
+	return d
+}
+
+// Acquire blocks until dispatching is not paused and a worker slot is free
+func (d *Dispatcher) Acquire() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for d.paused || d.active >= d.limit {
+		d.cond.Wait()
+	}
+	d.active++
+}
+
+// AcquireContext is like Acquire but gives up when ctx is done, also while paused.
+// It reports whether a slot was acquired.
+func (d *Dispatcher) AcquireContext(ctx context.Context) bool {
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			// Wake the waiters under the lock so the wakeup can't be missed
+			d.mu.Lock()
+			d.cond.Broadcast()
+			d.mu.Unlock()
+		case <-done:
+		}
+	}()
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for (d.paused || d.active >= d.limit) && ctx.Err() == nil {
+		d.cond.Wait()
+	}
+	if ctx.Err() != nil {
+		return false
+	}
+	d.active++
+	return true
+}
+
+// Release frees a worker slot
+func (d *Dispatcher) Release() {
+	d.mu.Lock()
+	d.active--
+	d.mu.Unlock()
+	d.cond.Broadcast()
+}
+
+// SetLimit changes the number of concurrent workers. Running workers above
+// a lower limit finish their address, no new ones are started until below it.
+func (d *Dispatcher) SetLimit(limit int) {
+	d.mu.Lock()
+	d.limit = ValidateWorkerCount(limit)
+	d.mu.Unlock()
+	d.cond.Broadcast()
+}
+
+// Limit returns the number of concurrent workers
+func (d *Dispatcher) Limit() int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.limit
+}
+
+// SetPaused pauses or resumes dispatching. Addresses already being probed are finished.
+func (d *Dispatcher) SetPaused(paused bool) {
+	d.mu.Lock()
+	d.paused = paused
+	d.mu.Unlock()
+	d.cond.Broadcast()
+}
+
+// Paused reports whether dispatching is paused
+func (d *Dispatcher) Paused() bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.paused
+}
+
+// SetRuntimeSettings updates the worker count and rate limit of the running scan
+func (e *Engine) SetRuntimeSettings(workers int, rate int) {
+	e.dispatcher.SetLimit(workers)
+	e.limiter.SetRate(rate)
+}
+
+// RuntimeSettings returns the worker count and rate limit in effect
+func (e *Engine) RuntimeSettings() (workers int, rate int) {
+	return e.dispatcher.Limit(), e.limiter.GetRate()
+}
+
+// SetPaused pauses or resumes dispatching
+func (e *Engine) SetPaused(paused bool) {
+	e.dispatcher.SetPaused(paused)
+	e.logPauseState(paused)
+}
+
+// Paused reports whether dispatching is paused
+func (e *Engine) Paused() bool {
+	return e.dispatcher.Paused()
+}
+
+// TogglePause pauses a running scan or resumes a paused one and returns the new state
+func (e *Engine) TogglePause() bool {
+	paused := !e.dispatcher.Paused()
+	e.SetPaused(paused)
+	return paused
+}
+
+func (e *Engine) logPauseState(paused bool) {
+	if paused {
+		e.info("Scan paused, in-flight addresses are finished")
+	} else {
+		e.info("Scan resumed")
+	}
+}
+
+// WatchControlFile calls pause with true when the file at path is created and
+// with false when it is removed. The file is checked every interval.
+func WatchControlFile(path string, interval time.Duration, pause func(paused bool)) func() {
+	quit := make(chan struct{})
+	var once sync.Once
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		exists := false
+		for {
+			select {
+			case <-ticker.C:
+				_, err := os.Stat(path)
+				// Only follow changes, so a signal can still toggle in between
+				if now := err == nil; now != exists {
+					exists = now
+					pause(exists)
+				}
+			case <-quit:
+				return
+			}
+		}
+	}()
+
+	return func() { once.Do(func() { close(quit) }) }
+}
+
+// PrintStatus writes the progress of the running scan and the hits so far
+func (e *Engine) PrintStatus(w io.Writer, websites [][]string) {
+	state := "running"
+	if e.Paused() {
+		state = "paused"
+	}
+
+	workers, rate := e.RuntimeSettings()
+	fmt.Fprintf(w, "\n[STATUS] %s, %d workers, rate %d/s\n", state, workers, rate)
+	if summary := e.scanSummary(); summary != nil {
+		fmt.Fprintln(w, "[STATUS] "+summary.String())
+	}
+	fmt.Fprintf(w, "[STATUS] %d hits\n", len(websites))
+	for _, site := range websites {
+		fmt.Fprintln(w, "  "+formatSite(site))
+	}
+}
+
+// formatSite formats a site as "status, url, title [hostname]"
+func formatSite(site []string) string {
+	if len(site) >= 4 {
+		return site[0] + ", " + site[1] + ", " + site[2] + " [" + site[3] + "]"
+	}
+	return strings.Join(site, ", ")
+}
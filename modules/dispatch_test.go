@@ -0,0 +1,128 @@
+package modules
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestDispatcherLimit(t *testing.T) {
+	d := NewDispatcher(2)
+
+	var running, peak int32
+	done := make(chan struct{}, 6)
+	for i := 0; i < 6; i++ {
+		d.Acquire()
+		go func() {
+			defer d.Release()
+			n := atomic.AddInt32(&running, 1)
+			for {
+				p := atomic.LoadInt32(&peak)
+				if n <= p || atomic.CompareAndSwapInt32(&peak, p, n) {
+					break
+				}
+			}
+			time.Sleep(10 * time.Millisecond)
+			atomic.AddInt32(&running, -1)
+			done <- struct{}{}
+		}()
+	}
+	for i := 0; i < 6; i++ {
+		<-done
+	}
+
+	if peak > 2 {
+		t.Errorf("Peak workers = %d, want at most 2", peak)
+	}
+}
+
+func TestDispatcherPause(t *testing.T) {
+	d := NewDispatcher(5)
+	d.SetPaused(true)
+
+	acquired := make(chan struct{})
+	go func() {
+		d.Acquire()
+		close(acquired)
+	}()
+
+	select {
+	case <-acquired:
+		t.Fatal("Acquire should block while paused")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	d.SetPaused(false)
+	select {
+	case <-acquired:
+	case <-time.After(time.Second):
+		t.Fatal("Acquire should continue after resume")
+	}
+}
+
+func TestDispatcherSetLimit(t *testing.T) {
+	d := NewDispatcher(1)
+	d.Acquire()
+
+	acquired := make(chan struct{})
+	go func() {
+		d.Acquire()
+		close(acquired)
+	}()
+
+	select {
+	case <-acquired:
+		t.Fatal("Acquire should block while the only slot is taken")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	d.SetLimit(2)
+	select {
+	case <-acquired:
+	case <-time.After(time.Second):
+		t.Fatal("Raising the limit should start a waiting worker")
+	}
+	if d.Limit() != 2 {
+		t.Errorf("Limit = %d, want 2", d.Limit())
+	}
+}
+
+func TestWatchControlFile(t *testing.T) {
+	e := NewEngine(EngineSettings{Workers: 1})
+	path := filepath.Join(t.TempDir(), "pause")
+	stop := WatchControlFile(path, 10*time.Millisecond, e.SetPaused)
+	defer stop()
+
+	waitFor := func(paused bool) {
+		t.Helper()
+		deadline := time.Now().Add(time.Second)
+		for e.Paused() != paused {
+			if time.Now().After(deadline) {
+				t.Fatalf("Paused = %v, want %v", !paused, paused)
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+	}
+
+	_ = os.WriteFile(path, nil, 0o600)
+	waitFor(true)
+	_ = os.Remove(path)
+	waitFor(false)
+}
+
+func TestPrintStatus(t *testing.T) {
+	e := NewEngine(EngineSettings{Workers: 8, Rate: 20})
+	var buf bytes.Buffer
+	e.PrintStatus(&buf, [][]string{{"200", "https://1.1.1.1", "Example", "one.one.one.one"}})
+
+	out := buf.String()
+	for _, part := range []string{"[STATUS] running, 8 workers, rate 20/s", "1 hits", "https://1.1.1.1, Example [one.one.one.one]"} {
+		if !strings.Contains(out, part) {
+			t.Errorf("Status output %q does not contain %q", out, part)
+		}
+	}
+}
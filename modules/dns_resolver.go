@@ -2,14 +2,38 @@ package modules
 
 import (
 	"context"
-	"ipmap/config"
 	"net"
+	"sync/atomic"
 	"time"
 )
 
+// NewResolver returns a resolver that queries the DNS servers ("ip" or
+// "ip:port") in turn, or the system ones when none are given
+func NewResolver(servers []string, timeout time.Duration) *net.Resolver {
+	var next uint32
+	return &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, address string) (net.Conn, error) {
+			if len(servers) > 0 {
+				address = servers[int(atomic.AddUint32(&next, 1))%len(servers)]
+				if _, _, err := net.SplitHostPort(address); err != nil {
+					address = net.JoinHostPort(address, "53")
+				}
+			}
+			d := net.Dialer{Timeout: timeout}
+			return d.DialContext(ctx, network, address)
+		},
+	}
+}
+
 // ReverseDNS performs reverse DNS lookup for an IP address
 func ReverseDNS(ip string) string {
-	config.VerboseLog("Performing reverse DNS lookup for: %s", ip)
+	return (*Engine)(nil).reverseDNS(ip)
+}
+
+// reverseDNS is ReverseDNS logged by the engine
+func (e *Engine) reverseDNS(ip string) string {
+	e.verbose("Performing reverse DNS lookup for: %s", ip)
 
 	// Set timeout for DNS lookup
 	resolver := &net.Resolver{
@@ -26,13 +50,14 @@ func ReverseDNS(ip string) string {
 	defer cancel()
 
 	names, err := resolver.LookupAddr(ctx, ip)
+	dnsLookupsTotal.WithLabelValues(dnsResult(names, err)).Inc()
 	if err != nil {
-		config.VerboseLog("Reverse DNS lookup failed for %s: %v", ip, err)
+		e.verbose("Reverse DNS lookup failed for %s: %v", ip, err)
 		return ""
 	}
 
 	if len(names) > 0 {
-		config.VerboseLog("Reverse DNS found for %s: %s", ip, names[0])
+		e.verbose("Reverse DNS found for %s: %s", ip, names[0])
 		return names[0]
 	}
 
@@ -0,0 +1,196 @@
+package modules
+
+import (
+	"net"
+	"strings"
+)
+
+// Response classes reported by DetectEdge
+const (
+	EdgeCDN    = "cdn"
+	EdgeWAF    = "waf"
+	EdgeOrigin = "origin"
+)
+
+// EdgeInfo describes whether a response came from a CDN edge, a WAF or the origin
+type EdgeInfo struct {
+	Class    string // EdgeCDN, EdgeWAF or EdgeOrigin
+	Provider string // e.g. Cloudflare, empty for origin
+	Reason   string // signal that triggered the classification
+}
+
+// IsEdge reports whether the response was served by a CDN or WAF
+func (e EdgeInfo) IsEdge() bool {
+	return e.Class == EdgeCDN || e.Class == EdgeWAF
+}
+
+type headerSignature struct {
+	header   string // header name (lowercase)
+	contains string // substring of the value, empty matches any value
+	provider string
+	class    string
+}
+
+var edgeHeaderSignatures = []headerSignature{
+	{"cf-ray", "", "Cloudflare", EdgeCDN},
+	{"cf-cache-status", "", "Cloudflare", EdgeCDN},
+	{"server", "cloudflare", "Cloudflare", EdgeCDN},
+	{"x-amz-cf-id", "", "Amazon CloudFront", EdgeCDN},
+	{"x-amz-cf-pop", "", "Amazon CloudFront", EdgeCDN},
+	{"via", "cloudfront", "Amazon CloudFront", EdgeCDN},
+	{"server", "akamaighost", "Akamai", EdgeCDN},
+	{"x-akamai-transformed", "", "Akamai", EdgeCDN},
+	{"akamai-grn", "", "Akamai", EdgeCDN},
+	{"x-fastly-request-id", "", "Fastly", EdgeCDN},
+	{"x-served-by", "cache-", "Fastly", EdgeCDN},
+	{"fastly-debug-digest", "", "Fastly", EdgeCDN},
+	{"x-azure-ref", "", "Azure Front Door", EdgeCDN},
+	{"x-cdn", "imperva", "Imperva", EdgeWAF},
+	{"x-iinfo", "", "Imperva", EdgeWAF},
+	{"x-sucuri-id", "", "Sucuri", EdgeWAF},
+	{"server", "sucuri", "Sucuri", EdgeWAF},
+	{"server", "ddos-guard", "DDoS-Guard", EdgeWAF},
+	{"x-cdn", "stackpath", "StackPath", EdgeCDN},
+	{"server", "bunnycdn", "BunnyCDN", EdgeCDN},
+}
+
+type bodySignature struct {
+	contains string // lowercase substring of the body
+	provider string
+}
+
+var blockPageSignatures = []bodySignature{
+	{"attention required! | cloudflare", "Cloudflare"},
+	{"cf-error-details", "Cloudflare"},
+	{"just a moment...", "Cloudflare"},
+	{"sucuri website firewall", "Sucuri"},
+	{"incapsula incident id", "Imperva"},
+	{"access denied - akamai", "Akamai"},
+	{"reference&#32;&#35;", "Akamai"},
+	{"the request could not be satisfied", "Amazon CloudFront"},
+	{"ddos-guard", "DDoS-Guard"},
+}
+
+// Address ranges of the larger CDN/WAF providers. Akamai publishes no list,
+// its entries are the main blocks of AS20940 and miss smaller allocations;
+// providers not listed here are only recognized by their response headers.
+var edgeRanges = map[string][]string{
+	"Cloudflare": {
+		"173.245.48.0/20", "103.21.244.0/22", "103.22.200.0/22", "103.31.4.0/22",
+		"141.101.64.0/18", "108.162.192.0/18", "190.93.240.0/20", "188.114.96.0/20",
+		"197.234.240.0/22", "198.41.128.0/17", "162.158.0.0/15", "104.16.0.0/13",
+		"104.24.0.0/14", "172.64.0.0/13", "131.0.72.0/22",
+		"2400:cb00::/32", "2606:4700::/32", "2803:f800::/32", "2405:b500::/32",
+		"2405:8100::/32", "2a06:98c0::/29", "2c0f:f248::/32",
+	},
+	"Fastly": {
+		"23.235.32.0/20", "43.249.72.0/22", "103.244.50.0/24", "103.245.222.0/23",
+		"103.245.224.0/24", "104.156.80.0/20", "140.248.64.0/18", "140.248.128.0/17",
+		"146.75.0.0/17", "151.101.0.0/16", "157.52.64.0/18", "167.82.0.0/17",
+		"172.111.64.0/18", "185.31.16.0/22", "199.27.72.0/21", "199.232.0.0/16",
+	},
+	"Imperva": {
+		"199.83.128.0/21", "198.143.32.0/19", "149.126.72.0/21", "103.28.248.0/22",
+		"45.64.64.0/22", "185.11.124.0/22", "192.230.64.0/18", "107.154.0.0/16",
+		"45.60.0.0/16", "45.223.0.0/16",
+	},
+	"Sucuri": {
+		"192.88.134.0/23", "185.93.228.0/22", "66.248.200.0/22",
+	},
+	"Amazon CloudFront": {
+		"3.160.0.0/14", "13.32.0.0/15", "13.35.0.0/16", "13.224.0.0/14", "15.158.0.0/16",
+		"18.64.0.0/14", "18.68.0.0/16", "18.154.0.0/15", "18.160.0.0/15", "18.164.0.0/15",
+		"18.172.0.0/15", "18.238.0.0/15", "18.244.0.0/15", "52.46.0.0/18", "52.84.0.0/15",
+		"52.124.128.0/17", "52.222.128.0/17", "54.182.0.0/16", "54.192.0.0/16", "54.230.0.0/17",
+		"54.230.128.0/18", "54.230.200.0/21", "54.230.208.0/20", "54.230.224.0/19",
+		"54.239.128.0/18", "54.239.192.0/19", "54.240.128.0/18", "64.252.64.0/18",
+		"64.252.128.0/18", "65.8.0.0/16", "65.9.0.0/17", "65.9.128.0/18", "70.132.0.0/18",
+		"71.152.0.0/17", "99.84.0.0/16", "99.86.0.0/16", "108.138.0.0/15", "108.156.0.0/14",
+		"130.176.0.0/17", "130.176.128.0/18", "130.176.192.0/19", "130.176.224.0/20",
+		"143.204.0.0/16", "144.220.0.0/16", "204.246.164.0/22", "204.246.168.0/22",
+		"204.246.172.0/23", "204.246.174.0/23", "204.246.176.0/20", "205.251.200.0/21",
+		"205.251.208.0/20", "205.251.249.0/24", "205.251.250.0/23", "205.251.252.0/23",
+		"205.251.254.0/24", "216.137.32.0/19",
+		"2600:9000::/28",
+	},
+	"Akamai": {
+		"2.16.0.0/13", "23.0.0.0/12", "23.32.0.0/11", "23.64.0.0/14", "23.192.0.0/11",
+		"72.246.0.0/15", "88.221.0.0/16", "92.122.0.0/15", "95.100.0.0/15", "96.6.0.0/15",
+		"96.16.0.0/15", "104.64.0.0/10", "173.222.0.0/15", "184.24.0.0/13", "184.50.0.0/15",
+		"184.84.0.0/14",
+		"2600:1400::/24", "2a02:26f0::/29",
+	},
+}
+
+var edgeNets map[string][]*net.IPNet
+
+func init() {
+	edgeNets = make(map[string][]*net.IPNet, len(edgeRanges))
+	for provider, ranges := range edgeRanges {
+		for _, cidr := range ranges {
+			_, ipnet, err := net.ParseCIDR(cidr)
+			if err == nil {
+				edgeNets[provider] = append(edgeNets[provider], ipnet)
+			}
+		}
+	}
+}
+
+// EdgeProviderForIP returns the CDN/WAF provider owning the address (ip or
+// ip:port), or an empty string
+func EdgeProviderForIP(ip string) string {
+	if host, _, err := net.SplitHostPort(ip); err == nil {
+		ip = host
+	}
+	parsed := net.ParseIP(strings.Trim(ip, "[]"))
+	if parsed == nil {
+		return ""
+	}
+
+	for provider, nets := range edgeNets {
+		for _, ipnet := range nets {
+			if ipnet.Contains(parsed) {
+				return provider
+			}
+		}
+	}
+	return ""
+}
+
+// DetectEdge classifies a response as CDN edge, WAF or direct origin
+func DetectEdge(resp *HTTPResponse, ip string) EdgeInfo {
+	if resp != nil {
+		body := strings.ToLower(string(resp.Body))
+		if len(body) > 64*1024 {
+			body = body[:64*1024]
+		}
+
+		// Block pages are the strongest signal that a WAF answered instead of the site
+		if resp.StatusCode == 403 || resp.StatusCode == 406 || resp.StatusCode == 429 || resp.StatusCode == 503 {
+			for _, sig := range blockPageSignatures {
+				if strings.Contains(body, sig.contains) {
+					return EdgeInfo{Class: EdgeWAF, Provider: sig.provider, Reason: "block page: " + sig.contains}
+				}
+			}
+		}
+
+		for _, sig := range edgeHeaderSignatures {
+			for name, values := range resp.Header {
+				if strings.ToLower(name) != sig.header {
+					continue
+				}
+				for _, v := range values {
+					if sig.contains == "" || strings.Contains(strings.ToLower(v), sig.contains) {
+						return EdgeInfo{Class: sig.class, Provider: sig.provider, Reason: "header: " + name}
+					}
+				}
+			}
+		}
+	}
+
+	if provider := EdgeProviderForIP(ip); provider != "" {
+		return EdgeInfo{Class: EdgeCDN, Provider: provider, Reason: "address range"}
+	}
+
+	return EdgeInfo{Class: EdgeOrigin}
+}
@@ -0,0 +1,120 @@
+package modules
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestDetectEdge(t *testing.T) {
+	tests := []struct {
+		name     string
+		resp     *HTTPResponse
+		ip       string
+		class    string
+		provider string
+	}{
+		{
+			name:     "Cloudflare header",
+			resp:     &HTTPResponse{StatusCode: 200, Header: http.Header{"Cf-Ray": {"8a1b2c3d4e5f-IST"}}},
+			ip:       "203.0.113.10",
+			class:    EdgeCDN,
+			provider: "Cloudflare",
+		},
+		{
+			name:     "CloudFront header",
+			resp:     &HTTPResponse{StatusCode: 200, Header: http.Header{"X-Amz-Cf-Id": {"abc"}}},
+			ip:       "203.0.113.10",
+			class:    EdgeCDN,
+			provider: "Amazon CloudFront",
+		},
+		{
+			name:     "Akamai server value",
+			resp:     &HTTPResponse{StatusCode: 200, Header: http.Header{"Server": {"AkamaiGHost"}}},
+			ip:       "203.0.113.10",
+			class:    EdgeCDN,
+			provider: "Akamai",
+		},
+		{
+			name:     "Sucuri WAF header",
+			resp:     &HTTPResponse{StatusCode: 200, Header: http.Header{"X-Sucuri-Id": {"11005"}}},
+			ip:       "203.0.113.10",
+			class:    EdgeWAF,
+			provider: "Sucuri",
+		},
+		{
+			name: "Cloudflare block page",
+			resp: &HTTPResponse{
+				StatusCode: 403,
+				Header:     http.Header{},
+				Body:       []byte("<title>Attention Required! | Cloudflare</title>"),
+			},
+			ip:       "203.0.113.10",
+			class:    EdgeWAF,
+			provider: "Cloudflare",
+		},
+		{
+			name:     "Known CDN range",
+			resp:     &HTTPResponse{StatusCode: 200, Header: http.Header{"Server": {"nginx"}}},
+			ip:       "104.16.1.1",
+			class:    EdgeCDN,
+			provider: "Cloudflare",
+		},
+		{
+			name: "Origin ModSecurity page",
+			resp: &HTTPResponse{
+				StatusCode: 403,
+				Header:     http.Header{"Server": {"Apache"}},
+				Body:       []byte("<p>This error was generated by Mod_Security.</p>"),
+			},
+			ip:    "203.0.113.10",
+			class: EdgeOrigin,
+		},
+		{
+			name:  "Direct origin",
+			resp:  &HTTPResponse{StatusCode: 200, Header: http.Header{"Server": {"nginx"}}},
+			ip:    "203.0.113.10",
+			class: EdgeOrigin,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			edge := DetectEdge(tt.resp, tt.ip)
+			if edge.Class != tt.class {
+				t.Errorf("Class = %s, want %s", edge.Class, tt.class)
+			}
+			if edge.Provider != tt.provider {
+				t.Errorf("Provider = %s, want %s", edge.Provider, tt.provider)
+			}
+			if edge.IsEdge() != (tt.class != EdgeOrigin) {
+				t.Errorf("IsEdge() = %v for class %s", edge.IsEdge(), tt.class)
+			}
+		})
+	}
+}
+
+func TestEdgeProviderForIP(t *testing.T) {
+	tests := []struct {
+		ip   string
+		want string
+	}{
+		{"104.16.0.1", "Cloudflare"},
+		{"2606:4700::1111", "Cloudflare"},
+		{"151.101.1.69", "Fastly"},
+		{"192.88.134.5", "Sucuri"},
+		{"104.16.0.1:8443", "Cloudflare"},
+		{"[2606:4700::1111]:443", "Cloudflare"},
+		{"13.32.10.1", "Amazon CloudFront"},
+		{"23.45.1.1", "Akamai"},
+		{"8.8.8.8", ""},
+		{"invalid", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.ip, func(t *testing.T) {
+			if got := EdgeProviderForIP(tt.ip); got != tt.want {
+				t.Errorf("EdgeProviderForIP(%q) = %q, want %q", tt.ip, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,177 @@
+package modules
+
+import (
+	"fmt"
+	"ipmap/config"
+	"sync"
+)
+
+// EngineSettings configure the probes of an Engine
+type EngineSettings struct {
+	Workers         int              // concurrent workers (1-1000)
+	Rate            int              // requests per second, 0 for unlimited
+	Retries         int              // retries for timeouts and 429/503 responses
+	RetryPolicy     RetryPolicy      // delays between the retries, DefaultRetryPolicy when zero
+	PreScan         bool             // TCP connect check on the probe ports before probing
+	PreScanTimeout  int              // TCP connect timeout of the pre-scan in ms
+	FaviconHash     string           // favicon hash (mmh3 or sha256) to match, none when ""
+	Threshold       int              // similarity score (0-100) of a domain match
+	ExcludeEdges    bool             // CDN/WAF edges are never domain matches
+	TechFilter      []string         // only report sites running one of these technologies
+	TechSignatures  []*TechSignature // technology signatures, the built-in ones when nil
+	FollowRedirects bool             // follow redirects instead of reporting them
+	Template        *RequestTemplate // probe requests, GET / when nil
+	DNSServers      []string         // servers of the subdomain lookups, the system ones when empty
+	Notifier        *Notifier        // webhooks notified of the hits and the scan end, none when nil
+	Verbose         bool             // also log the verbose messages
+	Log             LogFunc          // receives the log messages, they are dropped when nil
+}
+
+// LogLevel is the severity of a log message
+type LogLevel string
+
+// Log levels, named like the prefixes of the command output
+const (
+	LogVerbose LogLevel = "VERBOSE"
+	LogInfo    LogLevel = "INFO"
+	LogWarn    LogLevel = "WARN"
+	LogError   LogLevel = "ERROR"
+)
+
+// LogFunc receives the log messages of an engine
+type LogFunc func(level LogLevel, msg string)
+
+// PrintLog writes a log message to stdout like the config loggers, the command output
+func PrintLog(level LogLevel, msg string) {
+	fmt.Printf("[%s] %s\n", level, msg)
+}
+
+// Engine probes the addresses of one scan. It owns the settings and the
+// state of the scan (site details, domain baseline, timeouts, statistics,
+// workers and rate limit), so engines can run side by side in a process.
+//
+// The request, domain and state methods (GetDomainTitle, the favicon, DNS
+// and site detail lookups and their getters and setters) also work on a nil
+// Engine: the requests then take the config settings, are not limited and
+// log through the config loggers, and the setters do nothing. Scanning
+// (GetSites, ScanSites, DiscoverSubdomains) and the runtime controls need
+// an Engine from NewEngine.
+type Engine struct {
+	settings   EngineSettings
+	template   *RequestTemplate
+	dispatcher *Dispatcher
+	limiter    *RateLimiter
+
+	detailsMu    sync.Mutex
+	details      map[string]*SiteDetails
+	detailsOrder []string
+
+	mu          sync.Mutex
+	faviconHash string
+	baseline    *Fingerprint
+	timeout     *AdaptiveTimeout
+	openPorts   map[string][]int
+	stats       *ScanStats
+}
+
+// NewEngine creates an engine for one scan
+func NewEngine(settings EngineSettings) *Engine {
+	tmpl := settings.Template
+	if tmpl == nil {
+		tmpl = &RequestTemplate{}
+	}
+	return &Engine{
+		settings:    settings,
+		template:    tmpl,
+		dispatcher:  NewDispatcher(settings.Workers),
+		limiter:     NewRateLimiter(settings.Rate, 0),
+		details:     map[string]*SiteDetails{},
+		faviconHash: settings.FaviconHash,
+	}
+}
+
+// Settings returns the settings the engine was created with
+func (e *Engine) Settings() EngineSettings {
+	return e.settings
+}
+
+// FaviconHash returns the favicon hash the sites are matched with, "" for none
+func (e *Engine) FaviconHash() string {
+	if e == nil {
+		return ""
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.faviconHash
+}
+
+// SetFaviconHash sets the favicon hash the sites are matched with, e.g. the
+// one of the domain baseline when none was given
+func (e *Engine) SetFaviconHash(hash string) {
+	if e == nil {
+		return
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.faviconHash = hash
+}
+
+// ProbeTemplate returns the template of the probe requests
+func (e *Engine) ProbeTemplate() *RequestTemplate {
+	if e == nil {
+		return &RequestTemplate{}
+	}
+	return e.template
+}
+
+// retries returns the retry count of the requests
+func (e *Engine) retries() int {
+	if e == nil {
+		return config.MaxRetries
+	}
+	return e.settings.Retries
+}
+
+// followRedirects reports whether redirects are followed
+func (e *Engine) followRedirects() bool {
+	if e == nil {
+		return config.FollowRedirects
+	}
+	return e.settings.FollowRedirects
+}
+
+func (e *Engine) logf(level LogLevel, format string, args ...interface{}) {
+	if e == nil {
+		switch level {
+		case LogVerbose:
+			config.VerboseLog(format, args...)
+		case LogInfo:
+			config.InfoLog(format, args...)
+		case LogWarn:
+			config.WarnLog(format, args...)
+		default:
+			config.ErrorLog(format, args...)
+		}
+		return
+	}
+	if e.settings.Log == nil || (level == LogVerbose && !e.settings.Verbose) {
+		return
+	}
+	e.settings.Log(level, fmt.Sprintf(format, args...))
+}
+
+func (e *Engine) verbose(format string, args ...interface{}) {
+	e.logf(LogVerbose, format, args...)
+}
+
+func (e *Engine) info(format string, args ...interface{}) {
+	e.logf(LogInfo, format, args...)
+}
+
+func (e *Engine) warn(format string, args ...interface{}) {
+	e.logf(LogWarn, format, args...)
+}
+
+func (e *Engine) errorf(format string, args ...interface{}) {
+	e.logf(LogError, format, args...)
+}
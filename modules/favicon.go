@@ -0,0 +1,221 @@
+package modules
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"math/bits"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// FaviconHash holds the fingerprints of a favicon
+type FaviconHash struct {
+	URL    string // URL the favicon was fetched from
+	MMH3   int32  // Shodan-compatible murmur3 hash of the base64 encoded icon
+	SHA256 string // hex encoded SHA-256 of the raw icon bytes
+}
+
+// MMH3String returns the murmur3 hash in the signed decimal form used by search engines
+func (fh *FaviconHash) MMH3String() string {
+	return strconv.FormatInt(int64(fh.MMH3), 10)
+}
+
+// Matches reports whether the favicon matches the given hash (mmh3 or sha256)
+func (fh *FaviconHash) Matches(hash string) bool {
+	if fh == nil {
+		return false
+	}
+
+	hash = strings.TrimSpace(hash)
+	if hash == "" {
+		return false
+	}
+
+	return hash == fh.MMH3String() || strings.EqualFold(hash, fh.SHA256)
+}
+
+var iconLinkRe = regexp.MustCompile(`(?is)<link\b[^>]*>`)
+var iconRelRe = regexp.MustCompile(`(?is)\brel\s*=\s*["']?([^"'>]*)`)
+var iconHrefRe = regexp.MustCompile(`(?is)\bhref\s*=\s*(?:"([^"]*)"|'([^']*)'|([^\s>]+))`)
+
+// FindIconLinks returns the favicon URLs declared with <link rel="icon"> in the page
+func FindIconLinks(html string) []string {
+	var links []string
+	for _, tag := range iconLinkRe.FindAllString(html, -1) {
+		rel := iconRelRe.FindStringSubmatch(tag)
+		if len(rel) < 2 || !strings.Contains(strings.ToLower(rel[1]), "icon") {
+			continue
+		}
+
+		href := iconHrefRe.FindStringSubmatch(tag)
+		if len(href) < 4 {
+			continue
+		}
+
+		for _, h := range href[1:] {
+			if h = strings.TrimSpace(h); h != "" {
+				links = append(links, h)
+				break
+			}
+		}
+	}
+
+	return links
+}
+
+// GetFavicon fetches the favicon of the site at baseURL and returns its hashes.
+// Icons declared in the page html are tried before /favicon.ico.
+// Returns nil if no favicon could be fetched.
+func GetFavicon(baseURL string, host string, html string, timeout int) *FaviconHash {
+	return (*Engine)(nil).getFavicon(baseURL, host, html, timeout)
+}
+
+// getFavicon is GetFavicon with the requests of the engine
+func (e *Engine) getFavicon(baseURL string, host string, html string, timeout int) *FaviconHash {
+	base, err := url.Parse(baseURL)
+	if err != nil {
+		return nil
+	}
+
+	var candidates []string
+	for _, link := range FindIconLinks(html) {
+		ref, err := url.Parse(link)
+		if err != nil || strings.HasPrefix(link, "data:") {
+			continue
+		}
+
+		resolved := base.ResolveReference(ref)
+		if resolved.Scheme != "http" && resolved.Scheme != "https" {
+			continue
+		}
+
+		// Absolute links to the virtual host are fetched from the scanned address,
+		// icons on other hosts (CDNs) would match for every candidate and are skipped
+		if host != "" && strings.EqualFold(resolved.Hostname(), host) {
+			resolved.Host = base.Host
+		}
+		if resolved.Host != base.Host {
+			continue
+		}
+		candidates = append(candidates, resolved.String())
+	}
+	candidates = append(candidates, base.ResolveReference(&url.URL{Path: "/favicon.ico"}).String())
+
+	for _, candidate := range candidates {
+		e.verbose("Fetching favicon: %s", candidate)
+		resp := e.doTemplateRequest(candidate, host, timeout, e.retries(), nil)
+		if resp == nil || resp.StatusCode != 200 {
+			continue
+		}
+
+		body := string(resp.Body)
+		if len(body) == 0 || looksLikeHTML(body) {
+			continue
+		}
+
+		fh := HashFavicon([]byte(body))
+		fh.URL = candidate
+		e.verbose("Favicon hash for %s: mmh3=%s sha256=%s", candidate, fh.MMH3String(), fh.SHA256)
+		return fh
+	}
+
+	return nil
+}
+
+// HashFavicon computes the mmh3 and SHA-256 hashes of raw favicon bytes
+func HashFavicon(data []byte) *FaviconHash {
+	sum := sha256.Sum256(data)
+	return &FaviconHash{
+		MMH3:   int32(murmur3(encodeBase64Lines(data), 0)),
+		SHA256: hex.EncodeToString(sum[:]),
+	}
+}
+
+// SplitRawResponse splits a raw response dump into its header block and body
+func SplitRawResponse(raw string) (string, string) {
+	idx := strings.Index(raw, "\r\n\r\n")
+	if idx == -1 {
+		return raw, ""
+	}
+	return raw[:idx], raw[idx+4:]
+}
+
+// looksLikeHTML detects soft-404 pages served in place of an icon
+func looksLikeHTML(body string) bool {
+	head := strings.ToLower(strings.TrimSpace(body))
+	if len(head) > 512 {
+		head = head[:512]
+	}
+	return strings.HasPrefix(head, "<!doctype html") || strings.HasPrefix(head, "<html") ||
+		strings.Contains(head, "<head") || strings.Contains(head, "<body")
+}
+
+// encodeBase64Lines encodes data like Python's base64.encodebytes,
+// with a newline after every 76 characters and at the end
+func encodeBase64Lines(data []byte) []byte {
+	encoded := base64.StdEncoding.EncodeToString(data)
+
+	var sb strings.Builder
+	for len(encoded) > 76 {
+		sb.WriteString(encoded[:76])
+		sb.WriteByte('\n')
+		encoded = encoded[76:]
+	}
+	sb.WriteString(encoded)
+	sb.WriteByte('\n')
+
+	return []byte(sb.String())
+}
+
+// murmur3 implements the 32-bit MurmurHash3 (x86 variant)
+func murmur3(data []byte, seed uint32) uint32 {
+	const (
+		c1 = 0xcc9e2d51
+		c2 = 0x1b873593
+	)
+
+	h := seed
+	length := len(data)
+	blocks := length / 4
+
+	for i := 0; i < blocks; i++ {
+		k := binary.LittleEndian.Uint32(data[i*4:])
+		k *= c1
+		k = bits.RotateLeft32(k, 15)
+		k *= c2
+
+		h ^= k
+		h = bits.RotateLeft32(h, 13)
+		h = h*5 + 0xe6546b64
+	}
+
+	tail := data[blocks*4:]
+	var k uint32
+	switch len(tail) {
+	case 3:
+		k ^= uint32(tail[2]) << 16
+		fallthrough
+	case 2:
+		k ^= uint32(tail[1]) << 8
+		fallthrough
+	case 1:
+		k ^= uint32(tail[0])
+		k *= c1
+		k = bits.RotateLeft32(k, 15)
+		k *= c2
+		h ^= k
+	}
+
+	h ^= uint32(length)
+	h ^= h >> 16
+	h *= 0x85ebca6b
+	h ^= h >> 13
+	h *= 0xc2b2ae35
+	h ^= h >> 16
+
+	return h
+}
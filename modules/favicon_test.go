@@ -0,0 +1,123 @@
+package modules
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestMurmur3(t *testing.T) {
+	tests := []struct {
+		input string
+		want  uint32
+	}{
+		{"", 0},
+		{"hello", 0x248bfa47},
+		{"The quick brown fox jumps over the lazy dog", 0x2e4ff723},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			if got := murmur3([]byte(tt.input), 0); got != tt.want {
+				t.Errorf("murmur3(%q) = %#x, want %#x", tt.input, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEncodeBase64Lines(t *testing.T) {
+	data := make([]byte, 100)
+	encoded := string(encodeBase64Lines(data))
+
+	lines := strings.Split(strings.TrimSuffix(encoded, "\n"), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("Expected 2 lines, got %d", len(lines))
+	}
+	if len(lines[0]) != 76 {
+		t.Errorf("First line length = %d, want 76", len(lines[0]))
+	}
+	if !strings.HasSuffix(encoded, "\n") {
+		t.Error("Encoded data should end with a newline")
+	}
+}
+
+func TestFaviconHashMatches(t *testing.T) {
+	fh := HashFavicon([]byte("icon"))
+
+	tests := []struct {
+		name string
+		hash string
+		want bool
+	}{
+		{"mmh3", fh.MMH3String(), true},
+		{"sha256", fh.SHA256, true},
+		{"sha256 uppercase", strings.ToUpper(fh.SHA256), true},
+		{"different", "12345", false},
+		{"empty", "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := fh.Matches(tt.hash); got != tt.want {
+				t.Errorf("Matches(%q) = %v, want %v", tt.hash, got, tt.want)
+			}
+		})
+	}
+
+	var nilHash *FaviconHash
+	if nilHash.Matches(fh.MMH3String()) {
+		t.Error("nil favicon should not match")
+	}
+}
+
+func TestFindIconLinks(t *testing.T) {
+	html := `<html><head>
+		<link rel="stylesheet" href="/style.css">
+		<LINK REL="shortcut icon" HREF="/static/fav.ico">
+		<link href='/apple.png' rel='apple-touch-icon'>
+	</head></html>`
+
+	links := FindIconLinks(html)
+	if len(links) != 2 {
+		t.Fatalf("Expected 2 icon links, got %d: %v", len(links), links)
+	}
+	if links[0] != "/static/fav.ico" {
+		t.Errorf("First link = %s, want /static/fav.ico", links[0])
+	}
+	if links[1] != "/apple.png" {
+		t.Errorf("Second link = %s, want /apple.png", links[1])
+	}
+}
+
+func TestGetFavicon(t *testing.T) {
+	icon := []byte{0x00, 0x00, 0x01, 0x00, 0x01, 0x00, 0x10, 0x10}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/static/icon.png":
+			_, _ = w.Write(icon)
+		case "/favicon.ico":
+			_, _ = w.Write([]byte("<html><body>not found</body></html>"))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	html := `<link rel="icon" href="http://example.com/static/icon.png">`
+	fh := GetFavicon(server.URL, "example.com", html, 2000)
+	if fh == nil {
+		t.Fatal("Expected favicon to be found")
+	}
+
+	want := HashFavicon(icon)
+	if fh.MMH3 != want.MMH3 || fh.SHA256 != want.SHA256 {
+		t.Errorf("Favicon hash mismatch: got %s/%s, want %s/%s", fh.MMH3String(), fh.SHA256, want.MMH3String(), want.SHA256)
+	}
+
+	// Soft-404 HTML pages must not be hashed as icons
+	if fh := GetFavicon(server.URL, "example.com", "", 2000); fh != nil {
+		t.Errorf("Expected no favicon, got %s", fh.URL)
+	}
+}
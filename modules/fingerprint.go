@@ -0,0 +1,192 @@
+package modules
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CertInfo holds the identifying fields of a TLS leaf certificate
+type CertInfo struct {
+	Subject     string   `json:"subject"`
+	Issuer      string   `json:"issuer"`
+	DNSNames    []string `json:"dns_names,omitempty"`
+	NotAfter    string   `json:"not_after"`
+	Fingerprint string   `json:"sha256"`
+}
+
+// Fingerprint describes a response in enough detail to compare it with others
+type Fingerprint struct {
+	URL            string     `json:"url"`
+	StatusCode     int        `json:"status_code"`
+	Title          string     `json:"title"`
+	BodySHA256     string     `json:"body_sha256"`
+	NormalizedHash string     `json:"normalized_body_sha256"`
+	BodySimhash    string     `json:"body_simhash"`
+	BodyLength     int        `json:"body_length"`
+	Server         string     `json:"server,omitempty"`
+	PoweredBy      string     `json:"powered_by,omitempty"`
+	HeaderNames    []string   `json:"header_names,omitempty"`
+	CookieNames    []string   `json:"cookie_names,omitempty"`
+	Certificate    *CertInfo  `json:"certificate,omitempty"`
+	FaviconMMH3    string     `json:"favicon_mmh3,omitempty"`
+	FaviconSHA256  string     `json:"favicon_sha256,omitempty"`
+	RedirectTarget string     `json:"redirect_target,omitempty"`
+	ResponseTime   int64      `json:"response_time_ms"`
+	Sample         PageSample `json:"-"`
+}
+
+// NewFingerprint builds the fingerprint of a response
+func NewFingerprint(resp *HTTPResponse) *Fingerprint {
+	sample := ParsePageSample(resp.Raw())
+	text := pageText(sample.Body)
+
+	bodySum := sha256.Sum256(resp.Body)
+	normSum := sha256.Sum256([]byte(text))
+
+	fp := &Fingerprint{
+		URL:            resp.URL,
+		StatusCode:     resp.StatusCode,
+		Title:          strings.TrimSpace(sample.Title),
+		BodySHA256:     hex.EncodeToString(bodySum[:]),
+		NormalizedHash: hex.EncodeToString(normSum[:]),
+		BodySimhash:    fmt.Sprintf("%016x", Simhash(text)),
+		BodyLength:     len(resp.Body),
+		Server:         resp.Header.Get("Server"),
+		PoweredBy:      resp.Header.Get("X-Powered-By"),
+		ResponseTime:   resp.Elapsed,
+		Sample:         sample,
+	}
+
+	for name := range resp.Header {
+		if !volatileHeaders[strings.ToLower(name)] {
+			fp.HeaderNames = append(fp.HeaderNames, strings.ToLower(name))
+		}
+	}
+	sort.Strings(fp.HeaderNames)
+	fp.CookieNames = cookieNames(resp.Header.Values("Set-Cookie"))
+
+	if resp.FinalURL != "" && resp.FinalURL != resp.URL {
+		fp.RedirectTarget = resp.FinalURL
+	}
+
+	if resp.TLS != nil && len(resp.TLS.PeerCertificates) > 0 {
+		cert := resp.TLS.PeerCertificates[0]
+		certSum := sha256.Sum256(cert.Raw)
+		fp.Certificate = &CertInfo{
+			Subject:     cert.Subject.CommonName,
+			Issuer:      cert.Issuer.CommonName,
+			DNSNames:    cert.DNSNames,
+			NotAfter:    cert.NotAfter.Format(time.RFC3339),
+			Fingerprint: hex.EncodeToString(certSum[:]),
+		}
+	}
+
+	return fp
+}
+
+// SetFavicon stores the favicon hashes in the fingerprint
+func (fp *Fingerprint) SetFavicon(fh *FaviconHash) {
+	if fh == nil {
+		return
+	}
+	fp.FaviconMMH3 = fh.MMH3String()
+	fp.FaviconSHA256 = fh.SHA256
+}
+
+// Compare scores the candidate against the fingerprint and explains which signals matched
+func (fp *Fingerprint) Compare(candidate *Fingerprint) (int, []string) {
+	score := SimilarityScore(fp.Sample, candidate.Sample)
+
+	var reasons []string
+	if fp.BodySHA256 == candidate.BodySHA256 && fp.BodyLength > 0 {
+		reasons = append(reasons, "identical body")
+	} else if fp.NormalizedHash == candidate.NormalizedHash && fp.BodyLength > 0 {
+		reasons = append(reasons, "identical normalized body")
+	} else if sim := BodySimilarity(pageText(fp.Sample.Body), pageText(candidate.Sample.Body)); sim >= 0.8 {
+		reasons = append(reasons, "similar body ("+strconv.Itoa(int(sim*100))+"%)")
+	}
+
+	if fp.Title != "" && fp.Title == candidate.Title {
+		reasons = append(reasons, "same title")
+	} else if sim := TitleSimilarity(fp.Title, candidate.Title); sim >= 0.7 {
+		reasons = append(reasons, "similar title ("+strconv.Itoa(int(sim*100))+"%)")
+	}
+
+	if fp.StatusCode == candidate.StatusCode {
+		reasons = append(reasons, "same status "+strconv.Itoa(fp.StatusCode))
+	}
+	if fp.Server != "" && fp.Server == candidate.Server {
+		reasons = append(reasons, "same server header ("+fp.Server+")")
+	}
+	if common := intersect(fp.CookieNames, candidate.CookieNames); len(common) > 0 {
+		reasons = append(reasons, "shared cookies ("+strings.Join(common, ",")+")")
+	}
+
+	if fp.Certificate != nil && candidate.Certificate != nil {
+		if fp.Certificate.Fingerprint == candidate.Certificate.Fingerprint {
+			reasons = append(reasons, "same certificate")
+		} else if fp.Certificate.Subject != "" && fp.Certificate.Subject == candidate.Certificate.Subject {
+			reasons = append(reasons, "same certificate subject ("+fp.Certificate.Subject+")")
+		}
+	}
+
+	if fp.FaviconMMH3 != "" && fp.FaviconMMH3 == candidate.FaviconMMH3 {
+		reasons = append(reasons, "same favicon")
+	}
+
+	if fp.RedirectTarget != "" && redirectHost(fp.RedirectTarget) == redirectHost(candidate.RedirectTarget) {
+		reasons = append(reasons, "same redirect target host")
+	}
+
+	return score, reasons
+}
+
+// cookieNames returns the sorted, unique cookie names of Set-Cookie values
+func cookieNames(setCookies []string) []string {
+	seen := map[string]bool{}
+	var names []string
+	for _, v := range setCookies {
+		idx := strings.Index(v, "=")
+		if idx <= 0 {
+			continue
+		}
+		name := strings.TrimSpace(v[:idx])
+		if !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// intersect returns the values present in both sorted slices
+func intersect(a []string, b []string) []string {
+	set := map[string]bool{}
+	for _, v := range a {
+		set[v] = true
+	}
+
+	var common []string
+	for _, v := range b {
+		if set[v] {
+			common = append(common, v)
+		}
+	}
+	return common
+}
+
+// redirectHost returns the host name of a redirect target
+func redirectHost(target string) string {
+	u, err := url.Parse(target)
+	if err != nil {
+		return ""
+	}
+	return strings.ToLower(u.Hostname())
+}
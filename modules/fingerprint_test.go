@@ -0,0 +1,92 @@
+package modules
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestNewFingerprint(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Server", "nginx")
+		w.Header().Add("Set-Cookie", "session=abc; Path=/")
+		w.Header().Add("Set-Cookie", "lang=tr; Path=/")
+		_, _ = w.Write([]byte(samplePage))
+	}))
+	defer server.Close()
+
+	resp := DoRequest(server.URL, "", 5000, 0)
+	if resp == nil {
+		t.Fatal("Request to test server failed")
+	}
+
+	fp := NewFingerprint(resp)
+
+	if fp.StatusCode != 200 {
+		t.Errorf("StatusCode = %d, want 200", fp.StatusCode)
+	}
+	if fp.Title != "Acme Store - Home" {
+		t.Errorf("Title = %q, want %q", fp.Title, "Acme Store - Home")
+	}
+	if fp.Server != "nginx" {
+		t.Errorf("Server = %q, want nginx", fp.Server)
+	}
+	if strings.Join(fp.CookieNames, ",") != "lang,session" {
+		t.Errorf("CookieNames = %v, want [lang session]", fp.CookieNames)
+	}
+	if fp.Certificate == nil || fp.Certificate.Fingerprint == "" {
+		t.Error("Certificate should be captured for HTTPS responses")
+	}
+	if fp.RedirectTarget != "" {
+		t.Errorf("RedirectTarget = %q, want empty", fp.RedirectTarget)
+	}
+
+	score, reasons := fp.Compare(fp)
+	if score != 100 {
+		t.Errorf("Self comparison score = %d, want 100", score)
+	}
+
+	joined := strings.Join(reasons, "; ")
+	for _, want := range []string{"identical body", "same title", "same certificate", "shared cookies (lang,session)"} {
+		if !strings.Contains(joined, want) {
+			t.Errorf("Reasons %q should contain %q", joined, want)
+		}
+	}
+}
+
+func TestFingerprintRedirectTarget(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/" {
+			http.Redirect(w, r, "/home", http.StatusFound)
+			return
+		}
+		_, _ = w.Write([]byte("<title>Home</title>"))
+	}))
+	defer server.Close()
+
+	resp := DoRequest(server.URL+"/", "", 5000, 0)
+	if resp == nil {
+		t.Fatal("Request to test server failed")
+	}
+
+	fp := NewFingerprint(resp)
+	if fp.RedirectTarget != server.URL+"/home" {
+		t.Errorf("RedirectTarget = %q, want %q", fp.RedirectTarget, server.URL+"/home")
+	}
+}
+
+func TestGetDomainTitleWithoutEngine(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("<title>Origin</title>"))
+	}))
+	defer server.Close()
+
+	var e *Engine
+	if got := e.GetDomainTitle(strings.TrimPrefix(server.URL, "http://")); len(got) != 2 || got[0] != "Origin" {
+		t.Errorf("GetDomainTitle() = %v, want the title and response time", got)
+	}
+	if e.DomainBaseline() != nil || e.FaviconHash() != "" || e.AllSiteDetails() != nil {
+		t.Error("A nil engine kept state")
+	}
+}
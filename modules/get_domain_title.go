@@ -1,55 +1,85 @@
 package modules
 
-import (
-	"ipmap/config"
-	"regexp"
-)
+import "strconv"
+
+// DomainBaseline returns the fingerprint captured by GetDomainTitle, or nil
+func (e *Engine) DomainBaseline() *Fingerprint {
+	if e == nil {
+		return nil
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.baseline
+}
+
+// SetDomainBaseline replaces the fingerprint candidates are compared with
+func (e *Engine) SetDomainBaseline(fp *Fingerprint) {
+	if e == nil {
+		return
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.baseline = fp
+}
+
+// GetDomainTitle requests the domain, captures its baseline fingerprint and
+// returns its title and response time, or an empty slice when it does not answer
+func (e *Engine) GetDomainTitle(url string) []string {
+	// The baseline is taken from the first probe path so candidates are compared like for like
+	tmpl := e.ProbeTemplate()
+	path := tmpl.GetPaths()[0]
+	if path == "/" {
+		path = ""
+	}
 
-func GetDomainTitle(url string) []string {
 	// Try HTTPS first with longer timeout (30 seconds for slow CDNs)
-	config.InfoLog("Resolving domain: %s", url)
-	config.VerboseLog("Trying HTTPS for domain: %s", url)
-	getTitle := RequestFunc("https://"+url, url, 15000)
+	e.info("Resolving domain: %s", url)
+	e.verbose("Trying HTTPS for domain: %s", url)
+	resp := e.doTemplateRequest("https://"+url+path, url, 15000, e.retries(), tmpl)
 
 	// If HTTPS fails, try HTTP
-	if len(getTitle) == 0 {
-		config.VerboseLog("HTTPS failed, trying HTTP for domain: %s", url)
-		getTitle = RequestFunc("http://"+url, url, 15000)
+	if resp == nil {
+		e.verbose("HTTPS failed, trying HTTP for domain: %s", url)
+		resp = e.doTemplateRequest("http://"+url+path, url, 15000, e.retries(), tmpl)
 	}
 
 	// If still no response, try with www prefix
-	if len(getTitle) == 0 {
-		config.VerboseLog("Trying with www prefix: www.%s", url)
-		getTitle = RequestFunc("https://www."+url, url, 15000)
-		if len(getTitle) == 0 {
-			getTitle = RequestFunc("http://www."+url, url, 15000)
+	if resp == nil {
+		e.verbose("Trying with www prefix: www.%s", url)
+		resp = e.doTemplateRequest("https://www."+url+path, url, 15000, e.retries(), tmpl)
+		if resp == nil {
+			resp = e.doTemplateRequest("http://www."+url+path, url, 15000, e.retries(), tmpl)
 		}
 	}
 
 	// If still no response, return empty
-	if len(getTitle) == 0 {
-		config.ErrorLog("Failed to resolve domain: %s", url)
-		config.ErrorLog("Possible causes:")
-		config.ErrorLog("  1. Domain is down or not responding")
-		config.ErrorLog("  2. Firewall/proxy blocking the connection")
-		config.ErrorLog("  3. Network connectivity issues")
-		config.ErrorLog("  4. Domain requires authentication")
-		config.ErrorLog("\nTry running with -v flag for detailed logs")
+	if resp == nil {
+		e.errorf("Failed to resolve domain: %s", url)
+		e.errorf("Possible causes:")
+		e.errorf("  1. Domain is down or not responding")
+		e.errorf("  2. Firewall/proxy blocking the connection")
+		e.errorf("  3. Network connectivity issues")
+		e.errorf("  4. Domain requires authentication")
+		e.errorf("\nTry running with -v flag for detailed logs")
 		return []string{}
 	}
 
-	config.VerboseLog("Response received: Status=%s, Time=%sms", getTitle[0], getTitle[3])
+	elapsed := strconv.FormatInt(resp.Elapsed, 10)
+	e.verbose("Response received: Status=%s, Time=%sms", resp.Status, elapsed)
 
-	re := regexp.MustCompile(`(?s).*?<title>(.*?)</title>.*`)
-	match := re.FindStringSubmatch(getTitle[2])
+	// Capture the baseline fingerprint that every candidate is compared with
+	baseline := NewFingerprint(resp)
+	baseline.SetFavicon(e.getFavicon(resp.URL, url, string(resp.Body), 15000))
+	e.SetDomainBaseline(baseline)
+	e.verbose("Baseline captured: Status=%d, Body=%s, Server=%s", baseline.StatusCode, baseline.BodySHA256, baseline.Server)
 
-	if len(match) > 1 {
-		config.VerboseLog("Title found: %s", match[1])
-		return []string{match[1], getTitle[3]}
+	if title, found := ExtractTitle(resp.Body, resp.Header.Get("Content-Type")); found && title != "" {
+		e.verbose("Title found: %s", title)
+		return []string{title, elapsed}
 	}
 
 	// If no title found but we got a response, use domain name as title
 	// This allows the scan to continue even if title extraction fails (e.g., 403 errors)
-	config.VerboseLog("No <title> tag found, using domain as title")
-	return []string{url, getTitle[3]}
+	e.verbose("No <title> tag found, using domain as title")
+	return []string{url, elapsed}
 }
@@ -1,39 +1,202 @@
 package modules
 
 import (
-	"ipmap/config"
-	"regexp"
+	"net"
+	"net/url"
+	"strconv"
 	"strings"
 )
 
-func GetSite(ip string, domain string, timeout int) []string {
-	// Try HTTPS first (modern sites)
-	config.VerboseLog("Scanning IP: %s (HTTPS)", ip)
-	requestSite := RequestFunc("https://"+ip, domain, timeout)
-
-	// If HTTPS fails, try HTTP
-	if len(requestSite) == 0 {
-		config.VerboseLog("HTTPS failed for %s, trying HTTP", ip)
-		requestSite = RequestFunc("http://"+ip, domain, timeout)
-	}
-
-	if len(requestSite) > 0 {
-		re := regexp.MustCompile(`(?s).*?<title>(.*?)</title>.*`)
-		title := re.FindStringSubmatch(requestSite[2])
-		if len(title) > 0 {
-			explodeHttpCode := strings.Split(requestSite[0], " ")
-			config.VerboseLog("Site found on %s: %s (Status: %s)", ip, title[1], explodeHttpCode[0])
-
-			// Perform reverse DNS lookup
-			hostname := ReverseDNS(ip)
-			if hostname != "" {
-				// Return with hostname: [status, ip, title, hostname]
-				return []string{explodeHttpCode[0], requestSite[1], title[1], hostname}
+// GetSite returns the first site GetSites finds on the address, or an empty slice
+func (e *Engine) GetSite(ip string, domain string, timeout int) []string {
+	sites := e.GetSites(ip, domain, timeout)
+	if len(sites) == 0 {
+		return []string{}
+	}
+	return sites[0]
+}
+
+// GetSites probes every path of the request template on the address and
+// returns one site per path that served a page
+func (e *Engine) GetSites(ip string, domain string, timeout int) [][]string {
+	tmpl := e.ProbeTemplate()
+	var sites [][]string
+	var scheme, hostname string
+	reverseDone := false
+
+	for _, path := range tmpl.GetPaths() {
+		suffix := path
+		if suffix == "/" {
+			suffix = ""
+		}
+
+		var resp *HTTPResponse
+		if scheme == "" {
+			// Try HTTPS first (modern sites), then HTTP; the pre-scan skips closed ports
+			for _, s := range e.probeSchemes(ip) {
+				e.verbose("Scanning IP: %s%s (%s)", ip, suffix, strings.ToUpper(strings.TrimSuffix(s, "://")))
+				resp = e.doTemplateRequest(s+ip+suffix, domain, e.ProbeTimeout(timeout), e.retries(), tmpl)
+				if resp != nil {
+					break
+				}
+			}
+
+			// Nothing answers on this address, the other paths would fail too
+			if resp == nil {
+				return sites
+			}
+			scheme = "https://"
+			if strings.HasPrefix(resp.URL, "http://") {
+				scheme = "http://"
 			}
+		} else {
+			e.verbose("Scanning IP: %s%s", ip, suffix)
+			resp = e.doTemplateRequest(scheme+ip+suffix, domain, e.ProbeTimeout(timeout), e.retries(), tmpl)
+			if resp == nil {
+				continue
+			}
+		}
+
+		e.AdaptiveTimeout().Observe(resp.Elapsed)
+
+		site := e.siteFromResponse(resp, ip, domain, timeout)
+		if len(site) == 0 {
+			continue
+		}
 
-			return []string{explodeHttpCode[0], requestSite[1], title[1]}
+		// Perform reverse DNS lookup once per address
+		if !reverseDone {
+			hostname = e.reverseDNS(ip)
+			reverseDone = true
 		}
+		if hostname != "" {
+			// Return with hostname: [status, ip, title, hostname]
+			site = append(site, hostname)
+		}
+		sites = append(sites, site)
+	}
+
+	return sites
+}
+
+// siteFromResponse analyzes a probe response and returns [status, url, title],
+// or an empty slice if the response is not a site
+func (e *Engine) siteFromResponse(resp *HTTPResponse, ip string, domain string, timeout int) []string {
+	title, found := ExtractTitle(resp.Body, resp.Header.Get("Content-Type"))
+
+	// A redirect without a page is still a site, report where it points to
+	if !found && len(resp.Redirects) > 0 {
+		title, found = "[redirect] "+resp.Redirects[len(resp.Redirects)-1].Location, true
+	}
+
+	// Custom paths often serve JSON or plain text health checks without a title
+	if !found && len(e.ProbeTemplate().Paths) > 0 && resp.StatusCode < 400 {
+		title, found = "[no title] "+resp.Header.Get("Content-Type"), true
+	}
+
+	if !found {
+		return []string{}
+	}
+
+	explodeHttpCode := strings.Split(resp.Status, " ")
+	e.verbose("Site found on %s: %s (Status: %s)", resp.URL, title, explodeHttpCode[0])
+
+	if len(resp.Redirects) > 0 {
+		domains := RedirectDomains(resp.Redirects)
+		e.verbose("Redirect chain for %s: %d hops, domains: %s", ip, len(resp.Redirects), strings.Join(domains, ", "))
+		e.UpdateSiteDetails(resp.URL, func(d *SiteDetails) {
+			d.Redirects = resp.Redirects
+			d.DiscoveredDomains = domains
+		})
 	}
 
-	return []string{}
+	if technologies := DetectTechnologies(resp, e.settings.TechSignatures); len(technologies) > 0 {
+		e.verbose("Technologies on %s: %s", ip, strings.Join(technologies, ", "))
+		e.UpdateSiteDetails(resp.URL, func(d *SiteDetails) {
+			d.Technologies = technologies
+		})
+	}
+
+	edge := DetectEdge(resp, ip)
+	if edge.IsEdge() {
+		e.verbose("Edge detected on %s: %s %s (%s)", ip, edge.Provider, edge.Class, edge.Reason)
+		e.UpdateSiteDetails(resp.URL, func(d *SiteDetails) {
+			d.Edge = edge.Class
+			d.EdgeProvider = edge.Provider
+		})
+	}
+
+	e.compareSite(resp, domain, timeout, edge)
+
+	return []string{explodeHttpCode[0], resp.URL, title}
+}
+
+// compareSite fingerprints a found site and records how it compares with the domain baseline
+func (e *Engine) compareSite(resp *HTTPResponse, domain string, timeout int, edge EdgeInfo) {
+	baseline := e.DomainBaseline()
+	faviconHash := e.FaviconHash()
+	if baseline == nil && faviconHash == "" {
+		return
+	}
+
+	fp := NewFingerprint(resp)
+
+	if faviconHash != "" {
+		fh := e.getFavicon(resp.URL, domain, string(resp.Body), timeout)
+		fp.SetFavicon(fh)
+
+		if fh != nil {
+			match := fh.Matches(faviconHash)
+			e.UpdateSiteDetails(resp.URL, func(d *SiteDetails) {
+				d.FaviconURL = fh.URL
+				d.FaviconMMH3 = fh.MMH3String()
+				d.FaviconSHA256 = fh.SHA256
+				d.FaviconMatch = match
+			})
+
+			if match {
+				e.verbose("Favicon hash match on %s", resp.URL)
+			}
+		}
+	}
+
+	if baseline != nil {
+		score, reasons := baseline.Compare(fp)
+		e.verbose("Similarity score for %s: %d (%s)", resp.URL, score, strings.Join(reasons, ", "))
+		e.UpdateSiteDetails(resp.URL, func(d *SiteDetails) {
+			d.Score = score
+			// Other edges of the same CDN proxy the same page, so they are not the origin
+			d.DomainMatch = score >= e.settings.Threshold && !(e.settings.ExcludeEdges && edge.IsEdge())
+			d.Reasons = reasons
+		})
+	}
+}
+
+// RedirectDomains returns the unique host names found in the Location headers of a redirect chain
+func RedirectDomains(hops []RedirectHop) []string {
+	seen := map[string]bool{}
+	var domains []string
+	for _, hop := range hops {
+		u, err := url.Parse(hop.Location)
+		if err != nil {
+			continue
+		}
+
+		host := strings.ToLower(strings.TrimSuffix(u.Hostname(), "."))
+		if host == "" || net.ParseIP(host) != nil || seen[host] {
+			continue
+		}
+		seen[host] = true
+		domains = append(domains, host)
+	}
+	return domains
+}
+
+// FormatRedirects renders a redirect chain as "301 /a -> 302 https://b/"
+func FormatRedirects(hops []RedirectHop) string {
+	parts := make([]string, 0, len(hops))
+	for _, hop := range hops {
+		parts = append(parts, strconv.Itoa(hop.Status)+" "+hop.Location)
+	}
+	return strings.Join(parts, " -> ")
 }
@@ -0,0 +1,144 @@
+package modules
+
+import (
+	"context"
+	"errors"
+	"ipmap/config"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Scan telemetry exposed with -metrics-addr
+var (
+	metricsRegistry = prometheus.NewRegistry()
+
+	requestsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "ipmap",
+		Name:      "requests_total",
+		Help:      "Request attempts by scheme and result class (ok or the error class).",
+	}, []string{"scheme", "result"})
+
+	requestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "ipmap",
+		Name:      "request_duration_seconds",
+		Help:      "Latency of answered requests, including reading the body.",
+		Buckets:   []float64{.05, .1, .25, .5, 1, 2, 3, 5, 10, 15},
+	}, []string{"scheme"})
+
+	hitsTotal = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "ipmap",
+		Name:      "hits_total",
+		Help:      "Sites reported by the scan.",
+	})
+
+	retriesTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "ipmap",
+		Name:      "retries_total",
+		Help:      "Retried requests by error class.",
+	}, []string{"class"})
+
+	rateLimitWait = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Namespace: "ipmap",
+		Name:      "rate_limit_wait_seconds",
+		Help:      "Time requests waited for the rate limiter.",
+		Buckets:   []float64{.001, .01, .05, .1, .25, .5, 1, 2, 5},
+	})
+
+	dnsLookupsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "ipmap",
+		Name:      "dns_lookups_total",
+		Help:      "Reverse DNS lookups by outcome (found, not_found, timeout, error).",
+	}, []string{"result"})
+
+	targetsTotal = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: "ipmap",
+		Name:      "targets_total",
+		Help:      "Addresses of the current scan.",
+	})
+
+	targetsRemaining = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: "ipmap",
+		Name:      "targets_remaining",
+		Help:      "Addresses of the current scan not probed yet.",
+	})
+)
+
+func init() {
+	metricsRegistry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		requestsTotal, requestDuration, hitsTotal, retriesTotal,
+		rateLimitWait, dnsLookupsTotal, targetsTotal, targetsRemaining,
+	)
+}
+
+// MetricsHandler serves the metrics in the Prometheus exposition format
+func MetricsHandler() http.Handler {
+	return promhttp.HandlerFor(metricsRegistry, promhttp.HandlerOpts{})
+}
+
+// StartMetricsServer serves /metrics on addr in the background
+func StartMetricsServer(addr string) error {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", MetricsHandler())
+	go func() {
+		if err := http.Serve(listener, mux); err != nil {
+			config.ErrorLog("Metrics server error: %v", err)
+		}
+	}()
+
+	config.InfoLog("Metrics available at http://%s/metrics", listener.Addr())
+	return nil
+}
+
+// requestScheme returns the scheme label of a request URL
+func requestScheme(url string) string {
+	if i := strings.Index(url, "://"); i > 0 {
+		return strings.ToLower(url[:i])
+	}
+	return "unknown"
+}
+
+// observeRequest records the result of a request attempt
+func observeRequest(url string, result string, elapsed time.Duration) {
+	scheme := requestScheme(url)
+	requestsTotal.WithLabelValues(scheme, result).Inc()
+	if result == "ok" {
+		requestDuration.WithLabelValues(scheme).Observe(elapsed.Seconds())
+	}
+}
+
+// waitRateLimit waits for the rate limiter of the engine and records the wait time
+func (e *Engine) waitRateLimit() {
+	if e == nil {
+		return
+	}
+	start := time.Now()
+	e.limiter.Wait()
+	rateLimitWait.Observe(time.Since(start).Seconds())
+}
+
+// dnsResult classifies the outcome of a reverse DNS lookup
+func dnsResult(names []string, err error) string {
+	var dnsErr *net.DNSError
+	switch {
+	case err == nil && len(names) > 0:
+		return "found"
+	case err == nil, errors.As(err, &dnsErr) && dnsErr.IsNotFound:
+		return "not_found"
+	case errors.Is(err, context.DeadlineExceeded), errors.As(err, &dnsErr) && dnsErr.IsTimeout:
+		return "timeout"
+	}
+	return "error"
+}
@@ -0,0 +1,80 @@
+package modules
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func scrapeMetrics(t *testing.T) string {
+	t.Helper()
+
+	rec := httptest.NewRecorder()
+	MetricsHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	body, _ := io.ReadAll(rec.Body)
+	return string(body)
+}
+
+func TestMetricsInstrumentRequests(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("<title>Metrics</title>"))
+	}))
+	defer server.Close()
+
+	if resp := DoRequest(server.URL, "", 2000, 0); resp == nil {
+		t.Fatal("Request to test server failed")
+	}
+	_ = DoRequest("http://"+closedAddr(t), "", 2000, 0)
+
+	metrics := scrapeMetrics(t)
+	for _, want := range []string{
+		`ipmap_requests_total{result="ok",scheme="http"}`,
+		`ipmap_requests_total{result="refused",scheme="http"}`,
+		`ipmap_request_duration_seconds_bucket{scheme="http"`,
+		`ipmap_rate_limit_wait_seconds_count`,
+		`ipmap_targets_remaining`,
+	} {
+		if !strings.Contains(metrics, want) {
+			t.Errorf("Metrics do not contain %s", want)
+		}
+	}
+}
+
+func TestDNSResult(t *testing.T) {
+	tests := []struct {
+		names []string
+		err   error
+		want  string
+	}{
+		{[]string{"dns.google."}, nil, "found"},
+		{nil, nil, "not_found"},
+		{nil, &net.DNSError{Err: "no such host", IsNotFound: true}, "not_found"},
+		{nil, &net.DNSError{Err: "i/o timeout", IsTimeout: true}, "timeout"},
+		{nil, context.DeadlineExceeded, "timeout"},
+		{nil, errors.New("server misbehaving"), "error"},
+	}
+
+	for _, tt := range tests {
+		if got := dnsResult(tt.names, tt.err); got != tt.want {
+			t.Errorf("dnsResult(%v, %v) = %s, want %s", tt.names, tt.err, got, tt.want)
+		}
+	}
+}
+
+func TestRequestScheme(t *testing.T) {
+	for url, want := range map[string]string{
+		"https://1.1.1.1":      "https",
+		"HTTP://1.1.1.1/path":  "http",
+		"1.1.1.1":              "unknown",
+		"https://example.com/": "https",
+	} {
+		if got := requestScheme(url); got != want {
+			t.Errorf("requestScheme(%q) = %s, want %s", url, got, want)
+		}
+	}
+}
@@ -0,0 +1,168 @@
+package modules
+
+import (
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Ports of the probed schemes, checked by the TCP pre-scan
+const (
+	HTTPSPort = 443
+	HTTPPort  = 80
+)
+
+// SetOpenPorts stores the pre-scan results used to pick the probed schemes
+func (e *Engine) SetOpenPorts(ports map[string][]int) {
+	if e == nil {
+		return
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.openPorts = ports
+}
+
+// OpenPorts returns a copy of the pre-scan results, nil when it did not run
+func (e *Engine) OpenPorts() map[string][]int {
+	if e == nil {
+		return nil
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.openPorts == nil {
+		return nil
+	}
+	result := make(map[string][]int, len(e.openPorts))
+	for ip, ports := range e.openPorts {
+		result[ip] = append([]int(nil), ports...)
+	}
+	return result
+}
+
+// CheckPort reports whether a TCP connection to addr can be opened within timeout (ms)
+func CheckPort(addr string, timeout int) bool {
+	conn, err := net.DialTimeout("tcp", addr, time.Duration(timeout)*time.Millisecond)
+	if err != nil {
+		return false
+	}
+	conn.Close()
+	return true
+}
+
+// ScanPorts returns the open probe ports of ip. Addresses that already
+// carry a port ("10.0.0.1:8080") are checked on that port only.
+func ScanPorts(ip string, timeout int) []int {
+	if _, port, err := net.SplitHostPort(ip); err == nil {
+		if p, err := strconv.Atoi(port); err == nil && CheckPort(ip, timeout) {
+			return []int{p}
+		}
+		return nil
+	}
+
+	var open []int
+	for _, port := range []int{HTTPSPort, HTTPPort} {
+		if CheckPort(net.JoinHostPort(ip, strconv.Itoa(port)), timeout) {
+			open = append(open, port)
+		}
+	}
+	return open
+}
+
+// PreScan checks the probe ports of all addresses concurrently and returns the
+// open ports of the addresses that have any. done is called after each address.
+func PreScan(ips []string, timeout int, workers int, done func()) map[string][]int {
+	if workers < 1 {
+		workers = 1
+	}
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	sem := make(chan struct{}, workers)
+	result := make(map[string][]int)
+
+	for _, ip := range ips {
+		wg.Add(1)
+		sem <- struct{}{}
+
+		go func(ip string) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			if open := ScanPorts(ip, timeout); len(open) > 0 {
+				mu.Lock()
+				result[ip] = open
+				mu.Unlock()
+			}
+			if done != nil {
+				done()
+			}
+		}(ip)
+	}
+
+	wg.Wait()
+	return result
+}
+
+// probeSchemes returns the schemes to try on ip, HTTPS first. Without
+// pre-scan results both schemes are tried.
+func (e *Engine) probeSchemes(ip string) []string {
+	if e == nil {
+		return []string{"https://", "http://"}
+	}
+	e.mu.Lock()
+	scanned := e.openPorts != nil
+	ports, open := e.openPorts[ip]
+	e.mu.Unlock()
+
+	if !scanned {
+		return []string{"https://", "http://"}
+	}
+	if !open {
+		return nil
+	}
+
+	https, http := false, false
+	for _, port := range ports {
+		switch port {
+		case HTTPSPort:
+			https = true
+		case HTTPPort:
+			http = true
+		default:
+			// Unknown ports may speak either scheme
+			https, http = true, true
+		}
+	}
+
+	var schemes []string
+	if https {
+		schemes = append(schemes, "https://")
+	}
+	if http {
+		schemes = append(schemes, "http://")
+	}
+	return schemes
+}
+
+// FormatOpenPorts formats the open-port map as sorted "ip: 443,80" lines
+func FormatOpenPorts(ports map[string][]int) []string {
+	ips := make([]string, 0, len(ports))
+	for ip := range ports {
+		ips = append(ips, ip)
+	}
+	sort.Strings(ips)
+
+	lines := make([]string, 0, len(ips))
+	for _, ip := range ips {
+		values := make([]string, 0, len(ports[ip]))
+		for _, port := range ports[ip] {
+			values = append(values, strconv.Itoa(port))
+		}
+		lines = append(lines, ip+": "+strings.Join(values, ","))
+	}
+	return lines
+}
@@ -0,0 +1,108 @@
+package modules
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// closedAddr returns a local address nothing is listening on
+func closedAddr(t *testing.T) string {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := listener.Addr().String()
+	listener.Close()
+	return addr
+}
+
+func TestScanPorts(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	addr := listener.Addr().String()
+	port := listener.Addr().(*net.TCPAddr).Port
+	if open := ScanPorts(addr, 500); len(open) != 1 || open[0] != port {
+		t.Errorf("ScanPorts(%s) = %v, want [%d]", addr, open, port)
+	}
+	if open := ScanPorts(closedAddr(t), 500); len(open) != 0 {
+		t.Errorf("Closed port reported open: %v", open)
+	}
+}
+
+func TestPreScan(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	alive := listener.Addr().String()
+	dead := closedAddr(t)
+
+	calls := 0
+	open := PreScan([]string{alive, dead}, 500, 1, func() { calls++ })
+	if len(open) != 1 || open[alive] == nil {
+		t.Errorf("PreScan() = %v, want only %s", open, alive)
+	}
+	if calls != 2 {
+		t.Errorf("done called %d times, want 2", calls)
+	}
+}
+
+func TestProbeSchemes(t *testing.T) {
+	e := NewEngine(EngineSettings{})
+	both := []string{"https://", "http://"}
+	if got := e.probeSchemes("10.0.0.1"); !reflect.DeepEqual(got, both) {
+		t.Errorf("Without pre-scan probeSchemes() = %v, want %v", got, both)
+	}
+
+	e.SetOpenPorts(map[string][]int{
+		"10.0.0.1":      {HTTPSPort, HTTPPort},
+		"10.0.0.2":      {HTTPPort},
+		"10.0.0.3:8080": {8080},
+	})
+	tests := map[string][]string{
+		"10.0.0.1":      both,
+		"10.0.0.2":      {"http://"},
+		"10.0.0.3:8080": both,
+		"10.0.0.4":      nil,
+	}
+	for ip, want := range tests {
+		if got := e.probeSchemes(ip); !reflect.DeepEqual(got, want) {
+			t.Errorf("probeSchemes(%s) = %v, want %v", ip, got, want)
+		}
+	}
+}
+
+func TestGetSitesSkipsClosedAddresses(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		_, _ = w.Write([]byte("<title>Open</title>"))
+	}))
+	defer server.Close()
+
+	addr := strings.TrimPrefix(server.URL, "http://")
+	e := NewEngine(EngineSettings{})
+	e.SetOpenPorts(map[string][]int{})
+	if sites := e.GetSites(addr, "", 2000); len(sites) != 0 || requests != 0 {
+		t.Errorf("Address without open ports was probed: %v", sites)
+	}
+}
+
+func TestFormatOpenPorts(t *testing.T) {
+	lines := FormatOpenPorts(map[string][]int{"10.0.0.2": {80}, "10.0.0.1": {443, 80}})
+	want := []string{"10.0.0.1: 443,80", "10.0.0.2: 80"}
+	if !reflect.DeepEqual(lines, want) {
+		t.Errorf("FormatOpenPorts() = %v, want %v", lines, want)
+	}
+}
@@ -38,20 +38,25 @@ func NewRateLimiter(rate int, burst int) *RateLimiter {
 
 // Wait blocks until a token is available
 func (rl *RateLimiter) Wait() {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
 	if !rl.enabled {
 		return
 	}
 
-	rl.mu.Lock()
-	defer rl.mu.Unlock()
-
 	rl.refillTokens()
 
 	for rl.tokens <= 0 {
+		interval := time.Second / time.Duration(rl.rate)
 		rl.mu.Unlock()
 		// Wait for next token
-		time.Sleep(time.Second / time.Duration(rl.rate))
+		time.Sleep(interval)
 		rl.mu.Lock()
+		// The rate may have been changed or disabled while waiting
+		if !rl.enabled {
+			return
+		}
 		rl.refillTokens()
 	}
 
@@ -61,13 +66,13 @@ func (rl *RateLimiter) Wait() {
 // TryAcquire attempts to get a token without blocking
 // Returns true if successful, false otherwise
 func (rl *RateLimiter) TryAcquire() bool {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
 	if !rl.enabled {
 		return true
 	}
 
-	rl.mu.Lock()
-	defer rl.mu.Unlock()
-
 	rl.refillTokens()
 
 	if rl.tokens > 0 {
@@ -97,11 +102,18 @@ func (rl *RateLimiter) refillTokens() {
 
 // IsEnabled returns whether rate limiting is enabled
 func (rl *RateLimiter) IsEnabled() bool {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
 	return rl.enabled
 }
 
-// GetRate returns the current rate limit
+// GetRate returns the current rate limit, 0 when disabled
 func (rl *RateLimiter) GetRate() int {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+	if !rl.enabled {
+		return 0
+	}
 	return rl.rate
 }
 
@@ -1,6 +1,8 @@
 package modules
 
 import (
+	"net/http"
+	"net/http/httptest"
 	"sync"
 	"testing"
 	"time"
@@ -98,6 +100,9 @@ func TestRateLimiterSetRate(t *testing.T) {
 	if rl.IsEnabled() {
 		t.Error("SetRate(0) should disable the rate limiter")
 	}
+	if rl.GetRate() != 0 {
+		t.Errorf("GetRate() of a disabled limiter = %d, want 0", rl.GetRate())
+	}
 }
 
 func BenchmarkRateLimiterWait(b *testing.B) {
@@ -113,3 +118,32 @@ func BenchmarkRateLimiterTryAcquire(b *testing.B) {
 		rl.TryAcquire()
 	}
 }
+
+func TestRateLimitWaitIsNotTimedOut(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("<title>Limited</title>"))
+	}))
+	defer server.Close()
+
+	// 10 requests at 5/s wait up to a second, longer than the request timeout
+	e := NewEngine(EngineSettings{Workers: 10, Rate: 5})
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	answered := 0
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if resp := e.doTemplateRequest(server.URL, "", 300, 0, nil); resp != nil {
+				mu.Lock()
+				answered++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if answered != 10 {
+		t.Errorf("%d of 10 rate limited requests answered, the wait counted against the timeout", answered)
+	}
+}
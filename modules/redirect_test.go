@@ -0,0 +1,89 @@
+package modules
+
+import (
+	"ipmap/config"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func newRedirectServer() *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/":
+			http.Redirect(w, r, "/step", http.StatusMovedPermanently)
+		case "/step":
+			http.Redirect(w, r, "/final", http.StatusFound)
+		default:
+			_, _ = w.Write([]byte("<title>Final</title>"))
+		}
+	}))
+}
+
+func TestDoRequestRecordsRedirects(t *testing.T) {
+	server := newRedirectServer()
+	defer server.Close()
+
+	resp := DoRequest(server.URL+"/", "", 5000, 0)
+	if resp == nil {
+		t.Fatal("Request to test server failed")
+	}
+
+	if len(resp.Redirects) != 2 {
+		t.Fatalf("Expected 2 redirect hops, got %d: %v", len(resp.Redirects), resp.Redirects)
+	}
+	if resp.Redirects[0].Status != 301 || resp.Redirects[0].Location != "/step" {
+		t.Errorf("First hop = %+v, want 301 /step", resp.Redirects[0])
+	}
+	if resp.Redirects[1].Status != 302 || resp.Redirects[1].Location != "/final" {
+		t.Errorf("Second hop = %+v, want 302 /final", resp.Redirects[1])
+	}
+	if resp.StatusCode != 200 {
+		t.Errorf("Final status = %d, want 200", resp.StatusCode)
+	}
+}
+
+func TestDoRequestNoFollowRedirects(t *testing.T) {
+	original := config.FollowRedirects
+	defer func() { config.FollowRedirects = original }()
+	config.FollowRedirects = false
+
+	server := newRedirectServer()
+	defer server.Close()
+
+	resp := DoRequest(server.URL+"/", "", 5000, 0)
+	if resp == nil {
+		t.Fatal("Request to test server failed")
+	}
+
+	if resp.StatusCode != 301 {
+		t.Errorf("Status = %d, want 301", resp.StatusCode)
+	}
+	if len(resp.Redirects) != 1 || resp.Redirects[0].Location != "/step" {
+		t.Errorf("Expected the unfollowed redirect to be recorded, got %v", resp.Redirects)
+	}
+}
+
+func TestRedirectDomains(t *testing.T) {
+	hops := []RedirectHop{
+		{Status: 301, Location: "https://Secret-Origin.example.com/"},
+		{Status: 302, Location: "/login"},
+		{Status: 302, Location: "https://secret-origin.example.com/login"},
+		{Status: 302, Location: "http://192.0.2.10/"},
+		{Status: 302, Location: "https://www.example.org./home"},
+	}
+
+	got := RedirectDomains(hops)
+	want := []string{"secret-origin.example.com", "www.example.org"}
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("RedirectDomains() = %v, want %v", got, want)
+	}
+}
+
+func TestFormatRedirects(t *testing.T) {
+	hops := []RedirectHop{{Status: 301, Location: "/a"}, {Status: 302, Location: "https://b/"}}
+	if got := FormatRedirects(hops); got != "301 /a -> 302 https://b/" {
+		t.Errorf("FormatRedirects() = %q", got)
+	}
+}
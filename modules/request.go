@@ -3,12 +3,16 @@ package modules
 import (
 	"context"
 	"crypto/tls"
+	"errors"
+	"fmt"
 	"io"
 	"ipmap/config"
 	"net"
 	"net/http"
+	"net/http/httptrace"
 	"strconv"
 	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/corpix/uarand"
@@ -17,8 +21,12 @@ import (
 // Reusable HTTP client with connection pooling
 var httpClient *http.Client
 
+// Client that sends the Host header as TLS server name, see DoHostRequest
+var sniClient *http.Client
+
 func init() {
 	httpClient = createHTTPClient()
+	sniClient = createSNIClient()
 }
 
 func createHTTPClient() *http.Client {
@@ -56,7 +64,9 @@ func createHTTPClient() *http.Client {
 	return &http.Client{
 		Transport: transport,
 		CheckRedirect: func(req *http.Request, via []*http.Request) error {
-			if len(via) >= 10 {
+			recordRedirect(req)
+			follow, _ := req.Context().Value(followRedirectsKey{}).(bool)
+			if !follow || len(via) >= 10 {
 				return http.ErrUseLastResponse
 			}
 			// Preserve headers on redirect
@@ -70,30 +80,185 @@ func createHTTPClient() *http.Client {
 	}
 }
 
+// createSNIClient returns a client whose TLS connections carry the server name
+// stored in the request context. Pooled connections are bound to the name
+// they were opened with, so keep-alives are disabled. Redirects are never
+// followed, they would leave the probed address.
+func createSNIClient() *http.Client {
+	client := createHTTPClient()
+	client.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+		return http.ErrUseLastResponse
+	}
+	transport := client.Transport.(*http.Transport)
+	transport.DisableKeepAlives = true
+	transport.ForceAttemptHTTP2 = false
+
+	dialer := &net.Dialer{Timeout: 10 * time.Second}
+	tlsConfig := transport.TLSClientConfig
+	transport.DialTLSContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+		conn, err := dialer.DialContext(ctx, network, addr)
+		if err != nil {
+			return nil, err
+		}
+
+		cfg := tlsConfig.Clone()
+		cfg.ServerName, _ = ctx.Value(serverNameKey{}).(string)
+		cfg.NextProtos = []string{"http/1.1"}
+		tlsConn := tls.Client(conn, cfg)
+		if err := tlsConn.HandshakeContext(ctx); err != nil {
+			conn.Close()
+			return nil, err
+		}
+		return tlsConn, nil
+	}
+	return client
+}
+
+type serverNameKey struct{}
+
+// RedirectHop is a single redirect response seen while requesting a URL
+type RedirectHop struct {
+	Status   int    `json:"status"`
+	Location string `json:"location"`
+	Host     string `json:"host"`
+}
+
+type redirectChainKey struct{}
+
+// followRedirectsKey holds whether the redirects of a request are followed
+type followRedirectsKey struct{}
+
+// recordRedirect appends the redirect that led to req to the chain stored in its context
+func recordRedirect(req *http.Request) {
+	chain, ok := req.Context().Value(redirectChainKey{}).(*[]RedirectHop)
+	if !ok || req.Response == nil {
+		return
+	}
+
+	*chain = append(*chain, RedirectHop{
+		Status:   req.Response.StatusCode,
+		Location: req.Response.Header.Get("Location"),
+		Host:     req.URL.Hostname(),
+	})
+}
+
+// HTTPResponse holds a fully read response of a probe request
+type HTTPResponse struct {
+	URL        string               // requested URL
+	FinalURL   string               // URL of the last response after redirects
+	Proto      string               // protocol, e.g. HTTP/1.1
+	Status     string               // status line, e.g. "200 OK"
+	StatusCode int                  // numeric status code
+	Header     http.Header          // response headers
+	Body       []byte               // response body (size limited)
+	Elapsed    int64                // response time in milliseconds
+	TLS        *tls.ConnectionState // TLS state for HTTPS responses
+	Redirects  []RedirectHop        // redirect responses in the order they were seen
+}
+
+// Raw returns the response dumped similar to httputil.DumpResponse
+func (r *HTTPResponse) Raw() string {
+	var responseBuilder strings.Builder
+	responseBuilder.WriteString(r.Proto)
+	responseBuilder.WriteString(" ")
+	responseBuilder.WriteString(r.Status)
+	responseBuilder.WriteString("\r\n")
+	for key, values := range r.Header {
+		for _, value := range values {
+			responseBuilder.WriteString(key)
+			responseBuilder.WriteString(": ")
+			responseBuilder.WriteString(value)
+			responseBuilder.WriteString("\r\n")
+		}
+	}
+	responseBuilder.WriteString("\r\n")
+	responseBuilder.Write(r.Body)
+
+	return responseBuilder.String()
+}
+
 func RequestFunc(ip string, url string, timeout int) []string {
 	return RequestFuncWithRetry(ip, url, timeout, config.MaxRetries)
 }
 
 func RequestFuncWithRetry(ip string, url string, timeout int, maxRetries int) []string {
+	resp := DoRequest(ip, url, timeout, maxRetries)
+	if resp == nil {
+		return []string{}
+	}
+
+	return []string{resp.Status, ip, resp.Raw(), strconv.FormatInt(resp.Elapsed, 10)}
+}
+
+// DoRequest sends a GET request to ip with the given Host header, retrying on failure.
+// Returns nil if all attempts failed.
+func DoRequest(ip string, url string, timeout int, maxRetries int) *HTTPResponse {
+	return DoTemplateRequest(ip, url, timeout, maxRetries, nil)
+}
+
+// DoTemplateRequest is like DoRequest but takes the method, body, headers and
+// cookies from the request template (nil for a plain GET)
+func DoTemplateRequest(ip string, url string, timeout int, maxRetries int, tmpl *RequestTemplate) *HTTPResponse {
+	return (*Engine)(nil).doTemplateRequest(ip, url, timeout, maxRetries, tmpl)
+}
+
+// doTemplateRequest is DoTemplateRequest limited, counted and logged by the engine
+func (e *Engine) doTemplateRequest(ip string, url string, timeout int, maxRetries int, tmpl *RequestTemplate) *HTTPResponse {
+	return e.doRequest(httpClient, ip, url, timeout, maxRetries, tmpl)
+}
+
+// DoHostRequest is like DoRequest but also sends host as the TLS server name
+// (SNI), so HTTPS virtual hosts that are selected during the handshake answer
+func DoHostRequest(ip string, host string, timeout int, maxRetries int) *HTTPResponse {
+	return (*Engine)(nil).doHostRequest(ip, host, timeout, maxRetries)
+}
+
+// doHostRequest is DoHostRequest limited, counted and logged by the engine
+func (e *Engine) doHostRequest(ip string, host string, timeout int, maxRetries int) *HTTPResponse {
+	return e.doRequest(sniClient, ip, host, timeout, maxRetries, nil)
+}
+
+func (e *Engine) doRequest(client *http.Client, ip string, url string, timeout int, maxRetries int, tmpl *RequestTemplate) *HTTPResponse {
 	var lastErr error
+	var delay time.Duration
 
 	for attempt := 0; attempt <= maxRetries; attempt++ {
 		if attempt > 0 {
-			config.VerboseLog("Retry attempt %d/%d for %s", attempt, maxRetries, ip)
-			// Exponential backoff
-			time.Sleep(time.Duration(attempt*500) * time.Millisecond)
+			e.verbose("Retry attempt %d/%d for %s in %s", attempt, maxRetries, ip, delay)
+			time.Sleep(delay)
 		}
 
+		// The wait for the rate limit is not part of the timeout or the latency
+		e.waitRateLimit()
 		n := time.Now()
 
-		req, err := http.NewRequest("GET", ip, nil)
+		var body io.Reader
+		if tmpl != nil && tmpl.Body != "" {
+			body = strings.NewReader(tmpl.Body)
+		}
+
+		req, err := http.NewRequest(tmpl.GetMethod(), ip, body)
 		if err != nil {
 			lastErr = err
-			config.VerboseLog("Failed to create request: %v", err)
+			e.verbose("Failed to create request: %v", err)
 			continue
 		}
 
+		var redirects []RedirectHop
+		var connected atomic.Bool
 		ctx, cancel := context.WithTimeout(context.Background(), time.Duration(timeout)*time.Millisecond)
+		ctx = context.WithValue(ctx, redirectChainKey{}, &redirects)
+		ctx = context.WithValue(ctx, serverNameKey{}, url)
+		ctx = context.WithValue(ctx, followRedirectsKey{}, e.followRedirects())
+		// Dials may finish after the request gave up, so the flag is atomic
+		ctx = httptrace.WithClientTrace(ctx, &httptrace.ClientTrace{
+			ConnectDone: func(network, addr string, err error) {
+				if err == nil {
+					connected.Store(true)
+				}
+			},
+			GotConn: func(httptrace.GotConnInfo) { connected.Store(true) },
+		})
 		req = req.WithContext(ctx)
 
 		// Set Host header for virtual hosting
@@ -106,7 +271,7 @@ func RequestFuncWithRetry(ip string, url string, timeout int, maxRetries int) []
 		req.Header.Set("User-Agent", ua)
 		req.Header.Set("Accept", "text/html,application/xhtml+xml,application/xml;q=0.9,image/avif,image/webp,image/apng,*/*;q=0.8")
 		req.Header.Set("Accept-Language", "en-US,en;q=0.9,tr;q=0.8")
-		req.Header.Set("Accept-Encoding", "gzip, deflate, br")
+		req.Header.Set("Accept-Encoding", "gzip, deflate, br, zstd")
 		req.Header.Set("Connection", "keep-alive")
 		req.Header.Set("Upgrade-Insecure-Requests", "1")
 		req.Header.Set("Sec-Fetch-Dest", "document")
@@ -118,56 +283,106 @@ func RequestFuncWithRetry(ip string, url string, timeout int, maxRetries int) []
 		req.Header.Set("Sec-Ch-Ua-Mobile", "?0")
 		req.Header.Set("Sec-Ch-Ua-Platform", `"Windows"`)
 
-		resp, err := httpClient.Do(req)
+		// Template headers and cookies override the defaults above
+		tmpl.Apply(req)
+
+		e.countRequest()
+		sent := time.Now()
+		resp, err := client.Do(req)
 
 		if err != nil {
 			cancel() // Cancel on error
 			lastErr = err
-			config.VerboseLog("Request error (attempt %d): %v", attempt+1, err)
+			class := ClassifyError(err)
+			retry := class.Retryable() && attempt < maxRetries
+			e.recordError(class, retry)
+			observeRequest(ip, string(class), time.Since(sent))
+			if class == ErrTimeout && connected.Load() {
+				// The host answers slowly, unlike an address nobody listens on
+				e.AdaptiveTimeout().ObserveTimeout(timeout)
+			}
+			e.verbose("Request error (attempt %d, %s): %v", attempt+1, class, err)
+			if !retry {
+				break
+			}
+			delay = e.retryPolicy().Backoff(attempt + 1)
 			continue
 		}
 
 		// Read body with limit to prevent memory issues
-		bodyBytes, err := io.ReadAll(io.LimitReader(resp.Body, 1024*1024)) // 1MB limit
+		bodyBytes, err := io.ReadAll(io.LimitReader(resp.Body, maxBodySize)) // 1MB limit
 		resp.Body.Close()
 		cancel() // Cancel context after body is read
 
 		if err != nil {
 			lastErr = err
-			config.VerboseLog("Failed to read response body: %v", err)
+			class := ClassifyError(err)
+			retry := class.Retryable() && attempt < maxRetries
+			e.recordError(class, retry)
+			observeRequest(ip, string(class), time.Since(sent))
+			if class == ErrTimeout && connected.Load() {
+				// The host answers slowly, unlike an address nobody listens on
+				e.AdaptiveTimeout().ObserveTimeout(timeout)
+			}
+			e.verbose("Failed to read response body (%s): %v", class, err)
+			if !retry {
+				break
+			}
+			delay = e.retryPolicy().Backoff(attempt + 1)
+			continue
+		}
+
+		// 429 and 503 are retried after the delay the server asks for;
+		// the last response is still returned so the site gets reported
+		observeRequest(ip, "ok", time.Since(sent))
+		if class := ClassifyStatus(resp.StatusCode); class != "" && attempt < maxRetries {
+			lastErr = fmt.Errorf("%s", resp.Status)
+			e.recordError(class, true)
+			delay = e.retryPolicy().RetryDelay(attempt+1, resp.Header)
+			e.verbose("%s responded %s, retrying", ip, resp.Status)
 			continue
 		}
 
-		// Build response string similar to httputil.DumpResponse
-		var responseBuilder strings.Builder
-		responseBuilder.WriteString(resp.Proto)
-		responseBuilder.WriteString(" ")
-		responseBuilder.WriteString(resp.Status)
-		responseBuilder.WriteString("\r\n")
-		for key, values := range resp.Header {
-			for _, value := range values {
-				responseBuilder.WriteString(key)
-				responseBuilder.WriteString(": ")
-				responseBuilder.WriteString(value)
-				responseBuilder.WriteString("\r\n")
+		// Accept-Encoding is set by hand, so net/http leaves compressed bodies to us
+		if encoding := resp.Header.Get("Content-Encoding"); encoding != "" {
+			decoded, err := DecodeContent(bodyBytes, encoding, maxDecodedSize)
+			switch {
+			case err == nil, errors.Is(err, ErrDecodedTooLarge):
+				if err != nil {
+					e.verbose("Decoded body of %s truncated to %d bytes", ip, len(decoded))
+				}
+				bodyBytes = decoded
+				resp.Header.Del("Content-Encoding")
+				resp.Header.Del("Content-Length")
+			default:
+				e.verbose("Failed to decode %s body of %s: %v", encoding, ip, err)
 			}
 		}
-		responseBuilder.WriteString("\r\n")
-		responseBuilder.Write(bodyBytes)
 
 		// Success! Return even for non-2xx status codes (let caller decide)
 		elapsed := time.Since(n).Milliseconds()
 		if attempt > 0 {
-			config.VerboseLog("Request succeeded on retry %d for %s", attempt, ip)
+			e.verbose("Request succeeded on retry %d for %s", attempt, ip)
 		}
-		config.VerboseLog("Response: Status=%s, Size=%d bytes, Time=%dms", resp.Status, len(bodyBytes), elapsed)
+		e.verbose("Response: Status=%s, Size=%d bytes, Time=%dms", resp.Status, len(bodyBytes), elapsed)
 
-		return []string{resp.Status, ip, responseBuilder.String(), strconv.FormatInt(elapsed, 10)}
+		return &HTTPResponse{
+			URL:        ip,
+			FinalURL:   resp.Request.URL.String(),
+			Proto:      resp.Proto,
+			Status:     resp.Status,
+			StatusCode: resp.StatusCode,
+			Header:     resp.Header,
+			Body:       bodyBytes,
+			Elapsed:    elapsed,
+			TLS:        resp.TLS,
+			Redirects:  redirects,
+		}
 	}
 
 	// All retries failed
 	if lastErr != nil {
-		config.VerboseLog("Connection failed for %s: %v", url, lastErr)
+		e.verbose("Connection failed for %s: %v", url, lastErr)
 	}
-	return []string{}
+	return nil
 }
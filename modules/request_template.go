@@ -0,0 +1,156 @@
+package modules
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+)
+
+// RequestTemplate describes the probe requests sent to every address
+type RequestTemplate struct {
+	Method  string            `json:"method,omitempty"`
+	Paths   []string          `json:"paths,omitempty"`
+	Headers map[string]string `json:"headers,omitempty"`
+	Cookies map[string]string `json:"cookies,omitempty"`
+	Body    string            `json:"body,omitempty"`
+}
+
+// LoadRequestTemplate reads a JSON request template file
+func LoadRequestTemplate(path string) (*RequestTemplate, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	tmpl := &RequestTemplate{}
+	if err := json.Unmarshal(data, tmpl); err != nil {
+		return nil, fmt.Errorf("invalid request template: %v", err)
+	}
+	if err := tmpl.Validate(); err != nil {
+		return nil, err
+	}
+	return tmpl, nil
+}
+
+// Validate checks the method and paths of the template
+func (t *RequestTemplate) Validate() error {
+	if t.Method != "" && strings.ContainsAny(t.Method, " \t\r\n") {
+		return fmt.Errorf("invalid method: %q", t.Method)
+	}
+	for _, p := range t.Paths {
+		if !strings.HasPrefix(p, "/") {
+			return fmt.Errorf("path must start with /: %q", p)
+		}
+	}
+	for name := range t.Headers {
+		if name == "" || strings.ContainsAny(name, " :\t\r\n") {
+			return fmt.Errorf("invalid header name: %q", name)
+		}
+	}
+	return nil
+}
+
+// GetMethod returns the request method, GET by default
+func (t *RequestTemplate) GetMethod() string {
+	if t == nil || t.Method == "" {
+		return http.MethodGet
+	}
+	return strings.ToUpper(t.Method)
+}
+
+// GetPaths returns the request paths, "/" by default
+func (t *RequestTemplate) GetPaths() []string {
+	if t == nil || len(t.Paths) == 0 {
+		return []string{"/"}
+	}
+	return t.Paths
+}
+
+// Apply sets the template headers and cookies on the request, overriding defaults
+func (t *RequestTemplate) Apply(req *http.Request) {
+	if t == nil {
+		return
+	}
+
+	for name, value := range t.Headers {
+		if strings.EqualFold(name, "Host") {
+			req.Host = value
+			continue
+		}
+		req.Header.Set(name, value)
+	}
+
+	if len(t.Cookies) > 0 {
+		names := make([]string, 0, len(t.Cookies))
+		for name := range t.Cookies {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		pairs := make([]string, 0, len(names))
+		for _, name := range names {
+			pairs = append(pairs, name+"="+t.Cookies[name])
+		}
+		req.Header.Set("Cookie", strings.Join(pairs, "; "))
+	}
+}
+
+// Merge overrides the template fields with the non-empty fields of other
+func (t *RequestTemplate) Merge(other *RequestTemplate) {
+	if other.Method != "" {
+		t.Method = other.Method
+	}
+	if len(other.Paths) > 0 {
+		t.Paths = other.Paths
+	}
+	if other.Body != "" {
+		t.Body = other.Body
+	}
+	for name, value := range other.Headers {
+		if t.Headers == nil {
+			t.Headers = map[string]string{}
+		}
+		t.Headers[name] = value
+	}
+	for name, value := range other.Cookies {
+		if t.Cookies == nil {
+			t.Cookies = map[string]string{}
+		}
+		t.Cookies[name] = value
+	}
+}
+
+// ParseHeader parses a "Name: value" header line
+func ParseHeader(line string) (string, string, error) {
+	idx := strings.Index(line, ":")
+	if idx <= 0 {
+		return "", "", fmt.Errorf("invalid header %q, expected \"Name: value\"", line)
+	}
+
+	name := strings.TrimSpace(line[:idx])
+	if name == "" || strings.ContainsAny(name, " \t") {
+		return "", "", fmt.Errorf("invalid header name in %q", line)
+	}
+	return name, strings.TrimSpace(line[idx+1:]), nil
+}
+
+// ParseCookies parses a "name=value; name2=value2" cookie string
+func ParseCookies(s string) (map[string]string, error) {
+	cookies := map[string]string{}
+	for _, part := range strings.Split(s, ";") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+
+		idx := strings.Index(part, "=")
+		if idx <= 0 {
+			return nil, fmt.Errorf("invalid cookie %q, expected name=value", part)
+		}
+		cookies[strings.TrimSpace(part[:idx])] = strings.TrimSpace(part[idx+1:])
+	}
+	return cookies, nil
+}
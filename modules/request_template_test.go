@@ -0,0 +1,185 @@
+package modules
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseHeader(t *testing.T) {
+	tests := []struct {
+		input   string
+		name    string
+		value   string
+		wantErr bool
+	}{
+		{"X-Forwarded-For: 127.0.0.1", "X-Forwarded-For", "127.0.0.1", false},
+		{"Authorization:Bearer abc:def", "Authorization", "Bearer abc:def", false},
+		{"X-Empty:", "X-Empty", "", false},
+		{"NoColon", "", "", true},
+		{": value", "", "", true},
+		{"Bad Name: value", "", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			name, value, err := ParseHeader(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseHeader(%q) error = %v, wantErr %v", tt.input, err, tt.wantErr)
+			}
+			if name != tt.name || value != tt.value {
+				t.Errorf("ParseHeader(%q) = (%q, %q), want (%q, %q)", tt.input, name, value, tt.name, tt.value)
+			}
+		})
+	}
+}
+
+func TestParseCookies(t *testing.T) {
+	cookies, err := ParseCookies("session=abc; lang=tr;")
+	if err != nil {
+		t.Fatalf("ParseCookies error: %v", err)
+	}
+	if len(cookies) != 2 || cookies["session"] != "abc" || cookies["lang"] != "tr" {
+		t.Errorf("ParseCookies() = %v", cookies)
+	}
+
+	if _, err := ParseCookies("invalid"); err == nil {
+		t.Error("Expected error for cookie without value")
+	}
+}
+
+func TestRequestTemplateDefaults(t *testing.T) {
+	var nilTmpl *RequestTemplate
+	if nilTmpl.GetMethod() != "GET" {
+		t.Errorf("Default method = %s, want GET", nilTmpl.GetMethod())
+	}
+	if paths := nilTmpl.GetPaths(); len(paths) != 1 || paths[0] != "/" {
+		t.Errorf("Default paths = %v, want [/]", paths)
+	}
+
+	tmpl := &RequestTemplate{Method: "post"}
+	if tmpl.GetMethod() != "POST" {
+		t.Errorf("Method = %s, want POST", tmpl.GetMethod())
+	}
+}
+
+func TestRequestTemplateMerge(t *testing.T) {
+	tmpl := &RequestTemplate{
+		Method:  "GET",
+		Paths:   []string{"/"},
+		Headers: map[string]string{"X-A": "1", "X-B": "2"},
+	}
+	tmpl.Merge(&RequestTemplate{
+		Method:  "HEAD",
+		Headers: map[string]string{"X-B": "3"},
+		Cookies: map[string]string{"c": "d"},
+	})
+
+	if tmpl.Method != "HEAD" {
+		t.Errorf("Method = %s, want HEAD", tmpl.Method)
+	}
+	if len(tmpl.Paths) != 1 || tmpl.Paths[0] != "/" {
+		t.Errorf("Paths should be kept, got %v", tmpl.Paths)
+	}
+	if tmpl.Headers["X-A"] != "1" || tmpl.Headers["X-B"] != "3" {
+		t.Errorf("Headers = %v", tmpl.Headers)
+	}
+	if tmpl.Cookies["c"] != "d" {
+		t.Errorf("Cookies = %v", tmpl.Cookies)
+	}
+}
+
+func TestLoadRequestTemplate(t *testing.T) {
+	dir := t.TempDir()
+
+	valid := filepath.Join(dir, "valid.json")
+	_ = os.WriteFile(valid, []byte(`{"method": "POST", "paths": ["/health"], "headers": {"X-Test": "1"}, "body": "ping"}`), 0o600)
+	tmpl, err := LoadRequestTemplate(valid)
+	if err != nil {
+		t.Fatalf("LoadRequestTemplate error: %v", err)
+	}
+	if tmpl.Method != "POST" || tmpl.Paths[0] != "/health" || tmpl.Headers["X-Test"] != "1" || tmpl.Body != "ping" {
+		t.Errorf("Loaded template = %+v", tmpl)
+	}
+
+	invalid := filepath.Join(dir, "invalid.json")
+	_ = os.WriteFile(invalid, []byte(`{"paths": ["health"]}`), 0o600)
+	if _, err := LoadRequestTemplate(invalid); err == nil {
+		t.Error("Expected error for path without leading slash")
+	}
+}
+
+func TestDoTemplateRequest(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if r.Method != "POST" {
+			t.Errorf("Method = %s, want POST", r.Method)
+		}
+		if r.URL.Path != "/health" {
+			t.Errorf("Path = %s, want /health", r.URL.Path)
+		}
+		if r.Header.Get("X-Forwarded-For") != "127.0.0.1" {
+			t.Errorf("X-Forwarded-For = %q", r.Header.Get("X-Forwarded-For"))
+		}
+		if r.Header.Get("Accept") != "application/json" {
+			t.Errorf("Accept header should be overridden, got %q", r.Header.Get("Accept"))
+		}
+		if r.Header.Get("Cookie") != "lang=tr; session=abc" {
+			t.Errorf("Cookie = %q", r.Header.Get("Cookie"))
+		}
+		if string(body) != `{"ping":1}` {
+			t.Errorf("Body = %q", body)
+		}
+		_, _ = w.Write([]byte(`{"status":"ok"}`))
+	}))
+	defer server.Close()
+
+	tmpl := &RequestTemplate{
+		Method:  "POST",
+		Headers: map[string]string{"X-Forwarded-For": "127.0.0.1", "Accept": "application/json"},
+		Cookies: map[string]string{"session": "abc", "lang": "tr"},
+		Body:    `{"ping":1}`,
+	}
+
+	resp := DoTemplateRequest(server.URL+"/health", "", 5000, 0, tmpl)
+	if resp == nil {
+		t.Fatal("Request to test server failed")
+	}
+	if !strings.Contains(string(resp.Body), "ok") {
+		t.Errorf("Unexpected body: %s", resp.Body)
+	}
+}
+
+func TestGetSitesProbesAllPaths(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/":
+			_, _ = w.Write([]byte("<title>Root</title>"))
+		case "/health":
+			w.Header().Set("Content-Type", "application/json")
+			_, _ = w.Write([]byte(`{"status":"ok"}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	e := NewEngine(EngineSettings{Template: &RequestTemplate{Paths: []string{"/", "/health", "/missing"}}})
+
+	// The test server only speaks HTTP, so the HTTPS attempt fails and HTTP is used
+	addr := strings.TrimPrefix(server.URL, "http://")
+	sites := e.GetSites(addr, "", 2000)
+	if len(sites) != 2 {
+		t.Fatalf("Expected 2 sites, got %d: %v", len(sites), sites)
+	}
+	if sites[0][1] != server.URL || sites[0][2] != "Root" {
+		t.Errorf("First site = %v", sites[0])
+	}
+	if sites[1][1] != server.URL+"/health" || !strings.HasPrefix(sites[1][2], "[no title]") {
+		t.Errorf("Second site = %v", sites[1])
+	}
+}
@@ -1,62 +1,115 @@
 package modules
 
 import (
+	"context"
 	"fmt"
-	"ipmap/config"
+	"os"
+	"strings"
 	"sync"
+	"time"
 
 	"github.com/schollz/progressbar/v3"
 )
 
-func ResolveSite(IPAddress []string, Websites [][]string, DomainTitle string, IPBlocks []string, domain string, con bool, export bool, timeout int, interruptData *InterruptData) {
+// ScanOptions controls a ScanSites run
+type ScanOptions struct {
+	DomainTitle string                                   // title of the searched domain, "" to report all sites
+	Domain      string                                   // Host header sent to every address
+	Continue    bool                                     // keep scanning after a domain match
+	Timeout     int                                      // probe timeout in ms
+	Quiet       bool                                     // no progress bar or live statistics
+	OnHit       func(site []string, details SiteDetails) // called for every reported site, one at a time
+
+	OnProgress       func(summary *ScanSummary) // called with the statistics every ProgressInterval
+	ProgressInterval time.Duration              // interval of OnProgress, one second when 0
+}
+
+// ScanSites probes the addresses with the worker pool and returns the reported
+// sites and whether the scan stopped at a domain match. Cancelling ctx stops
+// dispatching, addresses already being probed are finished.
+func (e *Engine) ScanSites(ctx context.Context, IPAddress []string, opts ScanOptions) ([][]string, bool) {
 	var wg sync.WaitGroup
 	var mu sync.Mutex
+	var websites [][]string
+	matched := false
 
-	// Use configurable worker pool size
-	workerCount := config.Workers
-	config.VerboseLog("Starting scan with %d concurrent workers", workerCount)
-	sem := make(chan struct{}, workerCount)
+	// A domain match ends the scan unless -c is set
+	parent := ctx
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
 
-	// Create progress bar
-	bar := progressbar.NewOptions(len(IPAddress),
-		progressbar.OptionEnableColorCodes(true),
-		progressbar.OptionShowBytes(false),
-		progressbar.OptionShowCount(),
-		progressbar.OptionSetWidth(50),
-		progressbar.OptionSetDescription("[cyan][1/1][reset] Scanning IPs"),
-		progressbar.OptionSetTheme(progressbar.Theme{
-			Saucer:        "[green]=[reset]",
-			SaucerHead:    "[green]>[reset]",
-			SaucerPadding: " ",
-			BarStart:      "[",
-			BarEnd:        "]",
-		}),
-	)
+	// The worker pool size can change during the scan, see SetRuntimeSettings
+	e.verbose("Starting scan with %d concurrent workers", e.dispatcher.Limit())
+
+	// Optional first phase: only probe addresses with an open HTTP(S) port
+	step := "[1/1]"
+	if e.settings.PreScan {
+		IPAddress = e.preScanAddresses(IPAddress, opts.Quiet)
+		step = "[2/2]"
+	}
+
+	// Create progress bar, the live statistics are shown in its description
+	bar := newProgressBar(len(IPAddress), step, "Scanning IPs", opts.Quiet)
+	stats := e.StartScanStats(len(IPAddress))
+	targetsTotal.Set(float64(len(IPAddress)))
+	targetsRemaining.Set(float64(len(IPAddress)))
+	stopStats := func() {}
+	if !opts.Quiet {
+		var describe func(string)
+		if StderrIsTerminal() {
+			describe = func(line string) {
+				bar.Describe("[cyan]" + step + "[reset] Scanning IPs | " + line)
+			}
+		}
+		stopStats = ReportScanStats(stats, os.Stderr, describe)
+	}
+	if opts.OnProgress != nil {
+		interval := opts.ProgressInterval
+		if interval <= 0 {
+			interval = statsInterval
+		}
+		stopProgress := ObserveScanStats(stats, interval, opts.OnProgress)
+		defer stopProgress()
+	}
 
 	for _, ip := range IPAddress {
+		if !e.dispatcher.AcquireContext(ctx) {
+			break
+		}
 		wg.Add(1)
-		sem <- struct{}{}
 
 		go func(ip string) {
 			defer wg.Done()
-			defer func() { <-sem }()
+			defer e.dispatcher.Release()
 
-			site := GetSite(ip, domain, timeout)
-			if len(site) > 0 {
+			stats.Begin()
+			defer stats.End()
+			defer targetsRemaining.Dec()
 
-				fmt.Println("\n", site)
-				mu.Lock()
-				Websites = append(Websites, site)
-				mu.Unlock()
+			for _, site := range e.GetSites(ip, opts.Domain, opts.Timeout) {
+				details, _ := e.SiteDetails(site[1])
+				if !MatchesTechFilter(details.Technologies, e.settings.TechFilter) {
+					e.verbose("Skipping %s: no technology matches the filter", site[1])
+					e.RemoveSiteDetails(site[1])
+					continue
+				}
 
-				// Add to interrupt data for Ctrl+C handling
-				if interruptData != nil {
-					interruptData.AddWebsite(site)
+				mu.Lock()
+				websites = append(websites, site)
+				if opts.OnHit != nil {
+					opts.OnHit(site, details)
 				}
+				e.settings.Notifier.notifySite(opts.Domain, site, details)
+				stop := opts.DomainTitle != "" && details.DomainMatch && !opts.Continue
+				if stop {
+					matched = true
+				}
+				mu.Unlock()
+				stats.AddHit()
+				hitsTotal.Inc()
 
-				if DomainTitle != "" && site[2] == DomainTitle && !con {
-					_ = bar.Finish()
-					PrintResult("Search Domain by ASN", DomainTitle, timeout, IPBlocks, Websites, export)
+				if stop {
+					cancel()
 					return
 				}
 			}
@@ -68,8 +121,88 @@ func ResolveSite(IPAddress []string, Websites [][]string, DomainTitle string, IP
 	}
 
 	wg.Wait()
+	stopStats()
+	_ = bar.Finish()
+	e.logErrorStats()
+
+	// A scan cancelled by the caller is reported by the caller
+	if parent.Err() == nil || matched {
+		e.settings.Notifier.Notify(WebhookPayload{
+			Event:   EventScanComplete,
+			Domain:  opts.Domain,
+			Matched: matched,
+			Summary: stats.Summary(),
+		})
+	}
+
+	return websites, matched
+}
+
+// PrintSite prints a reported site with its findings
+func PrintSite(site []string, details SiteDetails) {
+	fmt.Println("\n", site)
+	if len(details.Technologies) > 0 {
+		fmt.Println("[*] Technologies:", strings.Join(details.Technologies, ", "))
+	}
+	if len(details.Redirects) > 0 {
+		fmt.Println("[*] Redirects:", FormatRedirects(details.Redirects))
+	}
+	if len(details.DiscoveredDomains) > 0 {
+		fmt.Println("[+] Discovered domains:", strings.Join(details.DiscoveredDomains, ", "))
+	}
+	if details.Edge != "" {
+		fmt.Printf("[~] %s edge (%s): %s\n", details.Edge, details.EdgeProvider, site[1])
+	}
+	if details.FaviconMatch {
+		fmt.Println("[+] Favicon hash match:", site[1])
+	}
+	if details.DomainMatch {
+		fmt.Printf("[+] Domain match (score %d): %s\n", details.Score, site[1])
+	}
+}
+
+// preScanAddresses runs the TCP pre-scan and returns the addresses with open ports
+func (e *Engine) preScanAddresses(IPAddress []string, quiet bool) []string {
+	bar := newProgressBar(len(IPAddress), "[1/2]", "TCP pre-scan", quiet)
+	var mu sync.Mutex
+
+	open := PreScan(IPAddress, e.settings.PreScanTimeout, e.dispatcher.Limit(), func() {
+		mu.Lock()
+		_ = bar.Add(1)
+		mu.Unlock()
+	})
 	_ = bar.Finish()
+	e.SetOpenPorts(open)
+
+	alive := make([]string, 0, len(open))
+	for _, ip := range IPAddress {
+		if _, ok := open[ip]; ok {
+			alive = append(alive, ip)
+		}
+	}
+	if !quiet && StderrIsTerminal() {
+		fmt.Fprintln(os.Stderr)
+	}
+	e.info("Pre-scan: %d/%d addresses have open ports", len(alive), len(IPAddress))
+	return alive
+}
 
-	// Process and print results
-	PrintResult("Search All ASN/IP", DomainTitle, timeout, IPBlocks, Websites, export)
+func newProgressBar(total int, step string, description string, quiet bool) *progressbar.ProgressBar {
+	return progressbar.NewOptions(total,
+		progressbar.OptionEnableColorCodes(true),
+		progressbar.OptionShowBytes(false),
+		progressbar.OptionShowCount(),
+		progressbar.OptionSetWidth(50),
+		progressbar.OptionSetWriter(os.Stderr),
+		progressbar.OptionSetVisibility(!quiet && StderrIsTerminal()),
+		progressbar.OptionSetPredictTime(false),
+		progressbar.OptionSetDescription("[cyan]"+step+"[reset] "+description),
+		progressbar.OptionSetTheme(progressbar.Theme{
+			Saucer:        "[green]=[reset]",
+			SaucerHead:    "[green]>[reset]",
+			SaucerPadding: " ",
+			BarStart:      "[",
+			BarEnd:        "]",
+		}),
+	)
 }
@@ -1,7 +1,11 @@
 package modules
 
 import (
+	"context"
 	"ipmap/config"
+	"net/http"
+	"net/http/httptest"
+	"strings"
 	"testing"
 )
 
@@ -103,3 +107,31 @@ func BenchmarkResolveSiteWorkerPool(b *testing.B) {
 		})
 	}
 }
+
+func TestScanSites(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("<title>Scan Target</title>"))
+	}))
+	defer server.Close()
+	addr := strings.TrimPrefix(server.URL, "http://")
+
+	e := NewEngine(EngineSettings{Workers: 4})
+	var hits [][]string
+	found, matched := e.ScanSites(context.Background(), []string{addr}, ScanOptions{
+		Timeout: 2000,
+		Quiet:   true,
+		OnHit:   func(site []string, _ SiteDetails) { hits = append(hits, site) },
+	})
+	if matched {
+		t.Error("Scan without a domain should not report a domain match")
+	}
+	if len(found) != 1 || len(hits) != 1 || found[0][2] != "Scan Target" {
+		t.Errorf("ScanSites() = %v, hits %v", found, hits)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if found, _ := NewEngine(EngineSettings{Workers: 4}).ScanSites(ctx, []string{addr}, ScanOptions{Timeout: 2000, Quiet: true}); len(found) != 0 {
+		t.Errorf("Cancelled scan found %v", found)
+	}
+}
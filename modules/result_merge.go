@@ -0,0 +1,226 @@
+package modules
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"time"
+)
+
+// MergeResults combines the results of scans over parts of the same targets.
+// Sites are deduplicated by URL, details by IP and IP blocks by value, in the
+// order they first appear; the summaries are added up. Results of searches
+// for different sites are refused.
+func MergeResults(results ...ResultData) (ResultData, error) {
+	for _, r := range results {
+		for _, other := range results {
+			if r.SearchSite != "" && other.SearchSite != "" && r.SearchSite != other.SearchSite {
+				return ResultData{}, fmt.Errorf("the results searched different sites (%q and %q)", r.SearchSite, other.SearchSite)
+			}
+		}
+	}
+
+	merged := ResultData{
+		Method:          "Search All ASN/IP",
+		IPBlocks:        []string{},
+		FoundedWebsites: [][]string{},
+		Timestamp:       time.Now().Format(time.RFC3339),
+	}
+
+	seenBlocks := map[string]bool{}
+	seenShards := map[string]bool{}
+	seenSites := map[string]bool{}
+	detailIndex := map[string]int{}
+	seenSubdomains := map[SubdomainRecord]bool{}
+	var summaries []*ScanSummary
+	var elapsed time.Duration
+
+	for _, r := range results {
+		if r.Method == "Search Domain by ASN" {
+			merged.Method = r.Method
+		}
+		if merged.SearchSite == "" {
+			merged.SearchSite = r.SearchSite
+		}
+		if merged.FaviconHash == "" {
+			merged.FaviconHash = r.FaviconHash
+		}
+		if merged.Baseline == nil {
+			merged.Baseline = r.Baseline
+		}
+		if r.Timeout > merged.Timeout {
+			merged.Timeout = r.Timeout
+		}
+
+		for _, block := range r.IPBlocks {
+			if !seenBlocks[block] {
+				seenBlocks[block] = true
+				merged.IPBlocks = append(merged.IPBlocks, block)
+			}
+		}
+		for _, shard := range r.Shards {
+			if !seenShards[shard] {
+				seenShards[shard] = true
+				merged.Shards = append(merged.Shards, shard)
+			}
+		}
+		for _, site := range r.FoundedWebsites {
+			if len(site) > 1 && !seenSites[site[1]] {
+				seenSites[site[1]] = true
+				merged.FoundedWebsites = append(merged.FoundedWebsites, site)
+			}
+		}
+		for _, d := range r.Details {
+			if i, ok := detailIndex[d.IP]; ok {
+				merged.Details[i] = mergeDetails(merged.Details[i], d)
+				continue
+			}
+			detailIndex[d.IP] = len(merged.Details)
+			merged.Details = append(merged.Details, d)
+		}
+		for _, record := range r.Subdomains {
+			if !seenSubdomains[record] {
+				seenSubdomains[record] = true
+				merged.Subdomains = append(merged.Subdomains, record)
+			}
+		}
+		merged.TimeoutStats = mergeTimeoutStats(merged.TimeoutStats, r.TimeoutStats)
+		for ip, ports := range r.OpenPorts {
+			if merged.OpenPorts == nil {
+				merged.OpenPorts = map[string][]int{}
+			}
+			merged.OpenPorts[ip] = mergePorts(merged.OpenPorts[ip], ports)
+		}
+
+		if r.Summary != nil {
+			summaries = append(summaries, r.Summary)
+			// The parts ran side by side, the longest one is the scan time
+			if d, err := time.ParseDuration(r.Summary.Elapsed); err == nil && d > elapsed {
+				elapsed = d
+			}
+		}
+	}
+
+	if len(summaries) > 0 {
+		merged.Summary = MergeSummaries(elapsed, summaries...)
+		merged.Summary.Hits = int64(len(merged.FoundedWebsites))
+	}
+	return merged, nil
+}
+
+// mergeDetails combines the details two scans recorded for the same site: a
+// match in either is kept, the higher score comes with its reasons
+func mergeDetails(a, b SiteDetails) SiteDetails {
+	merged := a
+	if b.Score > a.Score {
+		merged = b
+	}
+	merged.DomainMatch = a.DomainMatch || b.DomainMatch
+	merged.FaviconMatch = a.FaviconMatch || b.FaviconMatch
+	for _, d := range []SiteDetails{a, b} {
+		if merged.Edge == "" {
+			merged.Edge, merged.EdgeProvider = d.Edge, d.EdgeProvider
+		}
+	}
+	return merged
+}
+
+// mergeTimeoutStats combines the timeout statistics of two scans. The
+// percentiles of the parts cannot be added up, the highest ones are kept.
+func mergeTimeoutStats(a, b *TimeoutStats) *TimeoutStats {
+	if a == nil || b == nil {
+		if a == nil {
+			return b
+		}
+		return a
+	}
+
+	merged := *a
+	merged.Min = minInt(a.Min, b.Min)
+	merged.Max = maxInt(a.Max, b.Max)
+	merged.Current = maxInt(a.Current, b.Current)
+	merged.Samples = a.Samples + b.Samples
+	merged.Timeouts = a.Timeouts + b.Timeouts
+	merged.P50 = maxInt(a.P50, b.P50)
+	merged.P90 = maxInt(a.P90, b.P90)
+	merged.P99 = maxInt(a.P99, b.P99)
+	return &merged
+}
+
+// MissingShards returns the shards of a sharded scan that are not among the
+// shards of a result, e.g. ["3/4"] for a merge of 1/4, 2/4 and 4/4
+func MissingShards(shards []string) []string {
+	var missing []string
+	counts := map[int]map[int]bool{}
+	for _, s := range shards {
+		shard, err := ParseShard(s)
+		if err != nil || shard.Count == 0 {
+			continue
+		}
+		if counts[shard.Count] == nil {
+			counts[shard.Count] = map[int]bool{}
+		}
+		counts[shard.Count][shard.Index] = true
+	}
+
+	var totals []int
+	for n := range counts {
+		totals = append(totals, n)
+	}
+	sort.Ints(totals)
+	for _, n := range totals {
+		for i := 1; i <= n; i++ {
+			if !counts[n][i] {
+				missing = append(missing, Shard{Index: i, Count: n}.String())
+			}
+		}
+	}
+	return missing
+}
+
+// MergeSummaries adds up the statistics of scans that took elapsed in total
+func MergeSummaries(elapsed time.Duration, summaries ...*ScanSummary) *ScanSummary {
+	merged := &ScanSummary{Elapsed: formatDuration(elapsed)}
+	for _, s := range summaries {
+		merged.Addresses += s.Addresses
+		merged.Scanned += s.Scanned
+		merged.Requests += s.Requests
+		merged.Hits += s.Hits
+		merged.Errors = addCounts(merged.Errors, s.Errors)
+		merged.Retries = addCounts(merged.Retries, s.Retries)
+	}
+	if secs := elapsed.Seconds(); secs > 0 {
+		merged.RequestsPerSec = math.Round(float64(merged.Requests)/secs*10) / 10
+	}
+	return merged
+}
+
+func addCounts(total, counts map[ErrorClass]int) map[ErrorClass]int {
+	for class, n := range counts {
+		if total == nil {
+			total = map[ErrorClass]int{}
+		}
+		total[class] += n
+	}
+	return total
+}
+
+func maxInt(a int, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+func mergePorts(a, b []int) []int {
+	seen := map[int]bool{}
+	var ports []int
+	for _, p := range append(append([]int(nil), a...), b...) {
+		if !seen[p] {
+			seen[p] = true
+			ports = append(ports, p)
+		}
+	}
+	sort.Ints(ports)
+	return ports
+}
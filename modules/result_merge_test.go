@@ -0,0 +1,105 @@
+package modules
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMergeResults(t *testing.T) {
+	first := ResultData{
+		Method:          "Search All ASN/IP",
+		Timeout:         300,
+		IPBlocks:        []string{"1.1.1.0/25"},
+		Shards:          []string{"1/2"},
+		OpenPorts:       map[string][]int{"1.1.1.1": {443}},
+		Subdomains:      []SubdomainRecord{{Hostname: "direct.example.com", IP: "1.1.1.9"}},
+		FoundedWebsites: [][]string{{"200", "https://1.1.1.1", "Login"}},
+		Details:         []SiteDetails{{IP: "https://1.1.1.1", Score: 40}},
+		TimeoutStats:    &TimeoutStats{Mode: "adaptive", Min: 200, Max: 3000, Current: 600, Samples: 80, P50: 120, P90: 250, P99: 400},
+		Summary: &ScanSummary{Elapsed: "10s", Addresses: 128, Scanned: 128, Requests: 300, Hits: 1,
+			Errors: map[ErrorClass]int{ErrTimeout: 2}},
+	}
+	second := ResultData{
+		Method:          "Search Domain by ASN",
+		SearchSite:      "Example",
+		Timeout:         500,
+		IPBlocks:        []string{"1.1.1.0/25", "1.1.1.128/25"},
+		Shards:          []string{"2/2"},
+		OpenPorts:       map[string][]int{"1.1.1.1": {80, 443}},
+		Subdomains:      []SubdomainRecord{{Hostname: "direct.example.com", IP: "1.1.1.9"}, {Hostname: "mail.example.com", IP: "1.1.1.10"}},
+		FoundedWebsites: [][]string{{"200", "https://1.1.1.1", "Login"}, {"200", "https://1.1.1.200", "Example"}},
+		Details: []SiteDetails{
+			{IP: "https://1.1.1.200", Score: 95, DomainMatch: true},
+			{IP: "https://1.1.1.1", Score: 85, DomainMatch: true, Reasons: []string{"title"}},
+		},
+		TimeoutStats: &TimeoutStats{Mode: "adaptive", Min: 200, Max: 3000, Current: 900, Samples: 20, P50: 300, P90: 450, P99: 500},
+		Summary: &ScanSummary{Elapsed: "20s", Addresses: 128, Scanned: 100, Requests: 100, Hits: 2,
+			Errors: map[ErrorClass]int{ErrTimeout: 1, ErrRefused: 4}},
+	}
+
+	merged, err := MergeResults(first, second)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if merged.Method != "Search Domain by ASN" || merged.SearchSite != "Example" || merged.Timeout != 500 {
+		t.Errorf("Merged metadata = %q, %q, %d", merged.Method, merged.SearchSite, merged.Timeout)
+	}
+	if want := []string{"1.1.1.0/25", "1.1.1.128/25"}; !reflect.DeepEqual(merged.IPBlocks, want) {
+		t.Errorf("IPBlocks = %v, want %v", merged.IPBlocks, want)
+	}
+	if want := []string{"1/2", "2/2"}; !reflect.DeepEqual(merged.Shards, want) {
+		t.Errorf("Shards = %v, want %v", merged.Shards, want)
+	}
+	if len(merged.FoundedWebsites) != 2 || merged.FoundedWebsites[1][1] != "https://1.1.1.200" {
+		t.Errorf("FoundedWebsites = %v", merged.FoundedWebsites)
+	}
+	if len(merged.Subdomains) != 2 || merged.Subdomains[1].Hostname != "mail.example.com" {
+		t.Errorf("Subdomains = %+v", merged.Subdomains)
+	}
+	if len(merged.Details) != 2 {
+		t.Errorf("Details = %+v", merged.Details)
+	} else if d := merged.Details[0]; d.Score != 85 || !d.DomainMatch || len(d.Reasons) != 1 {
+		t.Errorf("Duplicate details = %+v, want the match with score 85", d)
+	}
+	want := &TimeoutStats{Mode: "adaptive", Min: 200, Max: 3000, Current: 900, Samples: 100, P50: 300, P90: 450, P99: 500}
+	if !reflect.DeepEqual(merged.TimeoutStats, want) {
+		t.Errorf("TimeoutStats = %+v, want %+v", merged.TimeoutStats, want)
+	}
+	if want := []int{80, 443}; !reflect.DeepEqual(merged.OpenPorts["1.1.1.1"], want) {
+		t.Errorf("OpenPorts = %v, want %v", merged.OpenPorts, want)
+	}
+
+	s := merged.Summary
+	if s.Elapsed != "20s" || s.Addresses != 256 || s.Scanned != 228 || s.Requests != 400 || s.Hits != 2 || s.RequestsPerSec != 20 {
+		t.Errorf("Summary = %+v", s)
+	}
+	if want := map[ErrorClass]int{ErrTimeout: 3, ErrRefused: 4}; !reflect.DeepEqual(s.Errors, want) {
+		t.Errorf("Summary errors = %v, want %v", s.Errors, want)
+	}
+}
+
+func TestMergeResultsOfOtherSites(t *testing.T) {
+	_, err := MergeResults(ResultData{SearchSite: "Example"}, ResultData{}, ResultData{SearchSite: "Other"})
+	if err == nil {
+		t.Error("MergeResults() of different sites succeeded")
+	}
+}
+
+func TestMissingShards(t *testing.T) {
+	tests := []struct {
+		shards []string
+		want   []string
+	}{
+		{[]string{"1/3", "2/3", "3/3"}, nil},
+		{[]string{"1/4", "2/4", "4/4"}, []string{"3/4"}},
+		{[]string{"2/2"}, []string{"1/2"}},
+		{nil, nil},
+	}
+
+	for _, tt := range tests {
+		if got := MissingShards(tt.shards); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("MissingShards(%v) = %v, want %v", tt.shards, got, tt.want)
+		}
+	}
+}
@@ -11,12 +11,20 @@ import (
 )
 
 type ResultData struct {
-	Method          string     `json:"method"`
-	SearchSite      string     `json:"search_site,omitempty"`
-	Timeout         int        `json:"timeout_ms"`
-	IPBlocks        []string   `json:"ip_blocks"`
-	FoundedWebsites [][]string `json:"founded_websites"`
-	Timestamp       string     `json:"timestamp"`
+	Method          string            `json:"method"`
+	SearchSite      string            `json:"search_site,omitempty"`
+	Timeout         int               `json:"timeout_ms"`
+	TimeoutStats    *TimeoutStats     `json:"timeout_stats,omitempty"`
+	IPBlocks        []string          `json:"ip_blocks"`
+	Shards          []string          `json:"shards,omitempty"` // shards (i/n) covered by the result
+	OpenPorts       map[string][]int  `json:"open_ports,omitempty"`
+	Subdomains      []SubdomainRecord `json:"subdomains,omitempty"` // addresses found through subdomains of the domain
+	FoundedWebsites [][]string        `json:"founded_websites"`
+	FaviconHash     string            `json:"favicon_hash,omitempty"`
+	Baseline        *Fingerprint      `json:"baseline,omitempty"`
+	Details         []SiteDetails     `json:"details,omitempty"`
+	Summary         *ScanSummary      `json:"summary,omitempty"`
+	Timestamp       string            `json:"timestamp"`
 }
 
 func exportFile(result string, isJSON bool, domain string) {
@@ -27,11 +35,7 @@ func exportFile(result string, isJSON bool, domain string) {
 
 	// Generate filename based on domain or timestamp
 	var fileName string
-	if domain != "" {
-		// Sanitize domain name for filename (remove special characters)
-		safeDomain := strings.ReplaceAll(domain, ".", "_")
-		safeDomain = strings.ReplaceAll(safeDomain, "/", "_")
-		safeDomain = strings.ReplaceAll(safeDomain, ":", "_")
+	if safeDomain := SanitizeFilename(domain); safeDomain != "" {
 		fileName = "ipmap_" + safeDomain + "_" + strconv.FormatInt(time.Now().Local().Unix(), 10) + ext
 	} else {
 		fileName = "ipmap_" + strconv.FormatInt(time.Now().Local().Unix(), 10) + "_export" + ext
@@ -52,90 +56,203 @@ func exportFile(result string, isJSON bool, domain string) {
 	config.InfoLog("Successfully exported: " + fileName)
 }
 
-func PrintResult(method string, title string, timeout int, ipblocks []string, founded [][]string, export bool) {
+// PrintReport prints a scan result and exports it on request
+func PrintReport(data ResultData, export bool) {
 	fmt.Println()
 
 	// Check if JSON format is requested
 	isJSON := config.Format == "json"
 
-	if isJSON {
-		// Create JSON result
-		result := ResultData{
-			Method:          method,
-			SearchSite:      title,
-			Timeout:         timeout,
-			IPBlocks:        ipblocks,
-			FoundedWebsites: founded,
-			Timestamp:       time.Now().Format(time.RFC3339),
-		}
+	result, err := data.Format(isJSON)
+	if err != nil {
+		config.ErrorLog("JSON marshal error: %v", err)
+		return
+	}
+
+	fmt.Println(result)
 
-		jsonData, err := json.MarshalIndent(result, "", "  ")
+	if export {
+		exportFile(result, isJSON, data.SearchSite)
+		return
+	}
+
+	fmt.Print("\nDo you want to export result to file? (Y/n): ")
+	var ex string
+	_, err = fmt.Scanln(&ex)
+	if err != nil {
+		return
+	}
+
+	if ex == "y" || ex == "Y" || ex == "" {
+		exportFile(result, isJSON, data.SearchSite)
+	} else {
+		fmt.Println("Export canceled")
+	}
+}
+
+// NewResultData collects the result of the scan of the engine
+func (e *Engine) NewResultData(method string, title string, timeout int, ipblocks []string, founded [][]string) ResultData {
+	return ResultData{
+		Method:          method,
+		SearchSite:      title,
+		Timeout:         timeout,
+		TimeoutStats:    e.timeoutStats(),
+		IPBlocks:        ipblocks,
+		OpenPorts:       e.OpenPorts(),
+		FoundedWebsites: founded,
+		FaviconHash:     e.FaviconHash(),
+		Baseline:        e.DomainBaseline(),
+		Details:         e.AllSiteDetails(),
+		Summary:         e.scanSummary(),
+		Timestamp:       time.Now().Format(time.RFC3339),
+	}
+}
+
+// Format renders the result as JSON or text
+func (d ResultData) Format(isJSON bool) (string, error) {
+	if isJSON {
+		jsonData, err := json.MarshalIndent(d, "", "  ")
 		if err != nil {
-			config.ErrorLog("JSON marshal error: %v", err)
-			return
+			return "", err
 		}
+		return string(jsonData), nil
+	}
 
-		fmt.Println(string(jsonData))
+	// Text format (original)
+	resultString := "==================== RESULT ===================="
+	resultString += "\nMethod:        " + d.Method
 
-		if export {
-			exportFile(string(jsonData), true, title)
-			return
-		}
+	if d.SearchSite != "" {
+		resultString += "\nSearch Site:   " + d.SearchSite
+	}
 
-		fmt.Print("\nDo you want to export result to file? (Y/n): ")
-		var ex string
-		_, err = fmt.Scanln(&ex)
-		if err != nil {
-			return
+	resultString += "\nTimeout:       " + strconv.Itoa(d.Timeout) + "ms"
+	if stats := d.TimeoutStats; stats != nil {
+		resultString += " (adaptive " + strconv.Itoa(stats.Min) + "-" + strconv.Itoa(stats.Max) + "ms, effective " +
+			strconv.Itoa(stats.Current) + "ms, p50/p90/p99 " + strconv.Itoa(stats.P50) + "/" + strconv.Itoa(stats.P90) + "/" +
+			strconv.Itoa(stats.P99) + "ms over " + strconv.Itoa(stats.Samples) + " responses"
+		if stats.Timeouts > 0 {
+			resultString += ", " + strconv.Itoa(stats.Timeouts) + " of them timed out"
 		}
+		resultString += ")"
+	}
+	resultString += "\nIP Blocks:     " + strings.Join(d.IPBlocks, ",")
+	if len(d.Shards) > 0 {
+		resultString += "\nShards:        " + strings.Join(d.Shards, ",")
+	}
+
+	if d.FaviconHash != "" {
+		resultString += "\nFavicon Hash:  " + d.FaviconHash
+	}
 
-		if ex == "y" || ex == "Y" || ex == "" {
-			exportFile(string(jsonData), true, title)
-		} else {
-			fmt.Println("Export canceled")
+	if baseline := d.Baseline; baseline != nil {
+		resultString += "\nBaseline:      " + baseline.URL + " (status " + strconv.Itoa(baseline.StatusCode) + ")"
+		resultString += "\n  Title:       " + baseline.Title
+		resultString += "\n  Body:        " + baseline.BodySHA256 + " (" + strconv.Itoa(baseline.BodyLength) + " bytes)"
+		if baseline.Server != "" {
+			resultString += "\n  Server:      " + baseline.Server
 		}
-	} else {
-		// Text format (original)
-		resultString := "==================== RESULT ===================="
-		resultString += "\nMethod:        " + method
+		if len(baseline.CookieNames) > 0 {
+			resultString += "\n  Cookies:     " + strings.Join(baseline.CookieNames, ",")
+		}
+		if baseline.Certificate != nil {
+			resultString += "\n  Certificate: " + baseline.Certificate.Subject + " (" + baseline.Certificate.Fingerprint + ")"
+		}
+		if baseline.RedirectTarget != "" {
+			resultString += "\n  Redirect:    " + baseline.RedirectTarget
+		}
+	}
 
-		if title != "" {
-			resultString += "\nSearch Site:   " + title
+	if ports := d.OpenPorts; ports != nil {
+		resultString += "\nOpen Ports (" + strconv.Itoa(len(ports)) + " addresses):"
+		for _, line := range FormatOpenPorts(ports) {
+			resultString += "\n  " + line
 		}
+	}
 
-		resultString += "\nTimeout:       " + strconv.Itoa(timeout) + "ms"
-		resultString += "\nIP Blocks:     " + strings.Join(ipblocks, ",")
-
-		resultString += "\nFounded Websites:\n"
-		if len(founded) > 0 {
-			for _, site := range founded {
-				// Format: Status, IP, Title[, Hostname]
-				if len(site) >= 4 {
-					resultString += site[0] + ", " + site[1] + ", " + site[2] + " [" + site[3] + "]\n"
-				} else {
-					resultString += strings.Join(site, ", ") + "\n"
-				}
+	if len(d.Subdomains) > 0 {
+		resultString += "\nSubdomains (" + strconv.Itoa(len(d.Subdomains)) + " addresses):"
+		for _, r := range d.Subdomains {
+			line := "\n  " + r.Hostname + ": " + r.IP
+			if r.Edge != "" {
+				line += " [" + r.Edge + "]"
 			}
+			resultString += line
 		}
-		resultString += "================================================"
-		fmt.Println(resultString)
+	}
 
-		if export {
-			exportFile(resultString, false, title)
-			return
+	resultString += "\nFounded Websites:\n"
+	if len(d.FoundedWebsites) > 0 {
+		for _, site := range d.FoundedWebsites {
+			// Format: Status, IP, Title[, Hostname]
+			if len(site) >= 4 {
+				resultString += site[0] + ", " + site[1] + ", " + site[2] + " [" + site[3] + "]\n"
+			} else {
+				resultString += strings.Join(site, ", ") + "\n"
+			}
 		}
+	}
 
-		fmt.Print("\nDo you want to export result to file? (Y/n): ")
-		var ex string
-		_, err := fmt.Scanln(&ex)
-		if err != nil {
-			return
+	var domainMatches, faviconMatches, edges, technologies, redirects []string
+	for _, details := range d.Details {
+		if len(details.Redirects) > 0 {
+			redirect := details.IP + ": " + FormatRedirects(details.Redirects)
+			if len(details.DiscoveredDomains) > 0 {
+				redirect += " [" + strings.Join(details.DiscoveredDomains, ",") + "]"
+			}
+			redirects = append(redirects, redirect)
 		}
-
-		if ex == "y" || ex == "Y" || ex == "" {
-			exportFile(resultString, false, title)
-		} else {
-			fmt.Println("Export canceled")
+		if len(details.Technologies) > 0 {
+			technologies = append(technologies, details.IP+": "+strings.Join(details.Technologies, ", "))
+		}
+		if details.Edge != "" {
+			edges = append(edges, details.IP+" ("+details.EdgeProvider+" "+details.Edge+")")
+		}
+		if details.DomainMatch {
+			match := details.IP + " (score " + strconv.Itoa(details.Score) + ")"
+			if len(details.Reasons) > 0 {
+				match += ": " + strings.Join(details.Reasons, ", ")
+			}
+			domainMatches = append(domainMatches, match)
+		}
+		if details.FaviconMatch {
+			faviconMatches = append(faviconMatches, details.IP)
 		}
 	}
+	if len(domainMatches) > 0 {
+		resultString += "Domain Matches:\n" + strings.Join(domainMatches, "\n") + "\n"
+	}
+	if len(faviconMatches) > 0 {
+		resultString += "Favicon Matches:\n" + strings.Join(faviconMatches, "\n") + "\n"
+	}
+	if len(redirects) > 0 {
+		resultString += "Redirects:\n" + strings.Join(redirects, "\n") + "\n"
+	}
+	if len(technologies) > 0 {
+		resultString += "Technologies:\n" + strings.Join(technologies, "\n") + "\n"
+	}
+	if len(edges) > 0 {
+		resultString += "CDN/WAF Edges:\n" + strings.Join(edges, "\n") + "\n"
+	}
+	if summary := d.Summary; summary != nil {
+		resultString += "Scan Summary:\n  " + strings.Join(summary.Lines(), "\n  ") + "\n"
+	}
+	resultString += "================================================"
+	return resultString, nil
+}
+
+// timeoutStats returns the adaptive timeout statistics, or nil for a fixed timeout
+func (e *Engine) timeoutStats() *TimeoutStats {
+	if at := e.AdaptiveTimeout(); at != nil {
+		return at.Stats()
+	}
+	return nil
+}
+
+// scanSummary returns the statistics of the scan, or nil if no scan ran
+func (e *Engine) scanSummary() *ScanSummary {
+	if stats := e.ScanStats(); stats != nil {
+		return stats.Summary()
+	}
+	return nil
 }
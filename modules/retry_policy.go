@@ -0,0 +1,207 @@
+package modules
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// ErrorClass groups request failures by how they should be retried
+type ErrorClass string
+
+const (
+	ErrRefused     ErrorClass = "refused"      // nothing listening, not retried
+	ErrReset       ErrorClass = "reset"        // connection reset by peer, not retried
+	ErrTimeout     ErrorClass = "timeout"      // retried with jittered exponential backoff
+	ErrTLS         ErrorClass = "tls"          // handshake, certificate or protocol mismatch failure, not retried
+	ErrDNS         ErrorClass = "dns"          // name resolution failure, not retried
+	ErrRateLimited ErrorClass = "rate-limited" // 429, retried after Retry-After
+	ErrUnavailable ErrorClass = "unavailable"  // 503, retried after Retry-After
+	ErrOther       ErrorClass = "other"        // anything else, not retried
+)
+
+// RetryPolicy controls the delays between request attempts
+type RetryPolicy struct {
+	BaseDelay     time.Duration // delay before the first retry, doubled on each attempt
+	MaxDelay      time.Duration // upper bound of the backoff delay
+	MaxRetryAfter time.Duration // upper bound of a server supplied Retry-After
+}
+
+// DefaultRetryPolicy returns the policy used by the scanner
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		BaseDelay:     250 * time.Millisecond,
+		MaxDelay:      5 * time.Second,
+		MaxRetryAfter: 30 * time.Second,
+	}
+}
+
+// retryPolicy returns the policy of the engine's requests, the default one when unset
+func (e *Engine) retryPolicy() RetryPolicy {
+	if e == nil || e.settings.RetryPolicy == (RetryPolicy{}) {
+		return DefaultRetryPolicy()
+	}
+	return e.settings.RetryPolicy
+}
+
+// Retryable reports whether a request failing with this class is worth another
+// attempt. Only timeouts and 429/503 responses are.
+func (c ErrorClass) Retryable() bool {
+	switch c {
+	case ErrTimeout, ErrRateLimited, ErrUnavailable:
+		return true
+	}
+	return false
+}
+
+// ClassifyError maps a request error to its error class
+func ClassifyError(err error) ErrorClass {
+	var netErr net.Error
+	var dnsErr *net.DNSError
+	var recordErr tls.RecordHeaderError
+	var unknownAuthErr x509.UnknownAuthorityError
+	var urlErr *url.Error
+
+	switch {
+	case errors.Is(err, syscall.ECONNREFUSED):
+		return ErrRefused
+	case errors.Is(err, syscall.ECONNRESET), errors.Is(err, syscall.EPIPE):
+		return ErrReset
+	case errors.As(err, &dnsErr):
+		return ErrDNS
+	case errors.Is(err, context.DeadlineExceeded), errors.Is(err, os.ErrDeadlineExceeded):
+		return ErrTimeout
+	case errors.As(err, &netErr) && netErr.Timeout():
+		return ErrTimeout
+	case errors.As(err, &recordErr), errors.As(err, &unknownAuthErr):
+		return ErrTLS
+	case errors.Is(err, io.EOF) && errors.As(err, &urlErr) && strings.HasPrefix(urlErr.URL, "https://"):
+		// The connection was closed during the handshake, e.g. by a plain HTTP server
+		return ErrTLS
+	}
+
+	// Fall back to the message for wrapped errors from other platforms
+	msg := strings.ToLower(err.Error())
+	switch {
+	case strings.Contains(msg, "connection refused"), strings.Contains(msg, "actively refused"):
+		return ErrRefused
+	case strings.Contains(msg, "connection reset"), strings.Contains(msg, "forcibly closed"):
+		return ErrReset
+	case strings.Contains(msg, "timeout"), strings.Contains(msg, "deadline exceeded"):
+		return ErrTimeout
+	case strings.Contains(msg, "tls:"), strings.Contains(msg, "x509:"),
+		strings.Contains(msg, "http response to https client"):
+		return ErrTLS
+	}
+	return ErrOther
+}
+
+// ClassifyStatus returns the error class of a retryable status code, or "" for other statuses
+func ClassifyStatus(code int) ErrorClass {
+	switch code {
+	case http.StatusTooManyRequests:
+		return ErrRateLimited
+	case http.StatusServiceUnavailable:
+		return ErrUnavailable
+	}
+	return ""
+}
+
+// Backoff returns the jittered exponential delay before retry number attempt (1-based)
+func (p RetryPolicy) Backoff(attempt int) time.Duration {
+	if attempt < 1 {
+		attempt = 1
+	}
+
+	delay := p.BaseDelay
+	for i := 1; i < attempt && delay < p.MaxDelay; i++ {
+		delay *= 2
+	}
+	if delay > p.MaxDelay {
+		delay = p.MaxDelay
+	}
+	if delay <= 0 {
+		return 0
+	}
+
+	// Equal jitter: half fixed, half random, so workers don't retry in lockstep
+	half := delay / 2
+	return half + time.Duration(rand.Int63n(int64(delay-half)+1))
+}
+
+// RetryDelay returns the delay before retrying a 429/503 response, honoring Retry-After
+func (p RetryPolicy) RetryDelay(attempt int, header http.Header) time.Duration {
+	if wait, ok := ParseRetryAfter(header.Get("Retry-After"), time.Now()); ok {
+		if wait > p.MaxRetryAfter {
+			wait = p.MaxRetryAfter
+		}
+		return wait
+	}
+	return p.Backoff(attempt)
+}
+
+// ParseRetryAfter parses a Retry-After value given in seconds or as an HTTP date
+func ParseRetryAfter(value string, now time.Time) (time.Duration, bool) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0, false
+	}
+
+	if secs, err := strconv.Atoi(value); err == nil {
+		if secs < 0 {
+			return 0, false
+		}
+		return time.Duration(secs) * time.Second, true
+	}
+
+	if t, err := http.ParseTime(value); err == nil {
+		if wait := t.Sub(now); wait > 0 {
+			return wait, true
+		}
+		return 0, true
+	}
+	return 0, false
+}
+
+// FormatErrorStats formats counters as "refused=12 timeout=3", sorted by class
+func FormatErrorStats(counts map[ErrorClass]int) string {
+	if len(counts) == 0 {
+		return "none"
+	}
+
+	classes := make([]string, 0, len(counts))
+	for class := range counts {
+		classes = append(classes, string(class))
+	}
+	sort.Strings(classes)
+
+	parts := make([]string, 0, len(classes))
+	for _, class := range classes {
+		parts = append(parts, fmt.Sprintf("%s=%d", class, counts[ErrorClass(class)]))
+	}
+	return strings.Join(parts, " ")
+}
+
+// logErrorStats logs the per-class error and retry counters in verbose mode
+func (e *Engine) logErrorStats() {
+	stats := e.ScanStats()
+	if stats == nil {
+		return
+	}
+	errs, retries := stats.ErrorStats()
+	e.verbose("Request errors: %s", FormatErrorStats(errs))
+	e.verbose("Retries: %s", FormatErrorStats(retries))
+}
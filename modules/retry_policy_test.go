@@ -0,0 +1,175 @@
+package modules
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestClassifyError(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want ErrorClass
+	}{
+		{"refused", &net.OpError{Op: "dial", Err: syscall.ECONNREFUSED}, ErrRefused},
+		{"reset", fmt.Errorf("read: %w", syscall.ECONNRESET), ErrReset},
+		{"deadline", fmt.Errorf("get: %w", context.DeadlineExceeded), ErrTimeout},
+		{"dns", &net.DNSError{Err: "no such host", Name: "example.invalid"}, ErrDNS},
+		{"tls message", errors.New("remote error: tls: handshake failure"), ErrTLS},
+		{"refused message", errors.New("dial tcp: connectex: No connection could be made because the target machine actively refused it."), ErrRefused},
+		{"https on http port", &url.Error{Op: "Get", URL: "https://10.0.0.1", Err: errors.New("http: server gave HTTP response to HTTPS client")}, ErrTLS},
+		{"handshake EOF", &url.Error{Op: "Get", URL: "https://10.0.0.1", Err: io.EOF}, ErrTLS},
+		{"http EOF", &url.Error{Op: "Get", URL: "http://10.0.0.1", Err: io.EOF}, ErrOther},
+		{"other", errors.New("unexpected EOF"), ErrOther},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ClassifyError(tt.err); got != tt.want {
+				t.Errorf("ClassifyError(%v) = %s, want %s", tt.err, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestErrorClassRetryable(t *testing.T) {
+	for _, class := range []ErrorClass{ErrRefused, ErrReset, ErrTLS, ErrDNS, ErrOther} {
+		if class.Retryable() {
+			t.Errorf("%s should not be retried", class)
+		}
+	}
+	for _, class := range []ErrorClass{ErrTimeout, ErrRateLimited, ErrUnavailable} {
+		if !class.Retryable() {
+			t.Errorf("%s should be retried", class)
+		}
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		value string
+		want  time.Duration
+		ok    bool
+	}{
+		{"5", 5 * time.Second, true},
+		{"0", 0, true},
+		{"Mon, 01 Jan 2024 12:00:10 GMT", 10 * time.Second, true},
+		{"Mon, 01 Jan 2024 11:00:00 GMT", 0, true},
+		{"", 0, false},
+		{"-1", 0, false},
+		{"soon", 0, false},
+	}
+
+	for _, tt := range tests {
+		got, ok := ParseRetryAfter(tt.value, now)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("ParseRetryAfter(%q) = (%s, %v), want (%s, %v)", tt.value, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestRetryPolicyBackoff(t *testing.T) {
+	p := RetryPolicy{BaseDelay: 100 * time.Millisecond, MaxDelay: time.Second, MaxRetryAfter: 2 * time.Second}
+
+	for attempt, want := range map[int]time.Duration{1: 100 * time.Millisecond, 2: 200 * time.Millisecond, 3: 400 * time.Millisecond, 10: time.Second} {
+		for i := 0; i < 20; i++ {
+			got := p.Backoff(attempt)
+			if got < want/2 || got > want {
+				t.Fatalf("Backoff(%d) = %s, want between %s and %s", attempt, got, want/2, want)
+			}
+		}
+	}
+
+	header := http.Header{"Retry-After": []string{"60"}}
+	if got := p.RetryDelay(1, header); got != 2*time.Second {
+		t.Errorf("RetryDelay should be capped at MaxRetryAfter, got %s", got)
+	}
+}
+
+func TestDoRequestDoesNotRetryRefused(t *testing.T) {
+	e := NewEngine(EngineSettings{})
+	stats := e.StartScanStats(1)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := listener.Addr().String()
+	listener.Close()
+
+	if resp := e.doTemplateRequest("http://"+addr, "", 2000, 2, nil); resp != nil {
+		t.Fatal("Expected request to a closed port to fail")
+	}
+
+	errs, retries := stats.ErrorStats()
+	if errs[ErrRefused] != 1 {
+		t.Errorf("Refused errors = %d, want 1 (%s)", errs[ErrRefused], FormatErrorStats(errs))
+	}
+	if len(retries) != 0 {
+		t.Errorf("Refused connections should not be retried, got %s", FormatErrorStats(retries))
+	}
+}
+
+func TestDoRequestHonorsRetryAfter(t *testing.T) {
+	e := NewEngine(EngineSettings{})
+	stats := e.StartScanStats(1)
+
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) == 1 {
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		_, _ = w.Write([]byte("<title>OK</title>"))
+	}))
+	defer server.Close()
+
+	resp := e.doTemplateRequest(server.URL, "", 2000, 2, nil)
+	if resp == nil || resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected 200 after retry, got %+v", resp)
+	}
+	if calls != 2 {
+		t.Errorf("Calls = %d, want 2", calls)
+	}
+
+	_, retries := stats.ErrorStats()
+	if retries[ErrRateLimited] != 1 {
+		t.Errorf("Rate limited retries = %d, want 1", retries[ErrRateLimited])
+	}
+}
+
+func TestDoRequestReturnsLastUnavailable(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "0")
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	resp := DoRequest(server.URL, "", 2000, 1)
+	if resp == nil || resp.StatusCode != http.StatusServiceUnavailable {
+		t.Fatalf("Expected the last 503 response, got %+v", resp)
+	}
+}
+
+func TestFormatErrorStats(t *testing.T) {
+	got := FormatErrorStats(map[ErrorClass]int{ErrTimeout: 3, ErrRefused: 12})
+	if got != "refused=12 timeout=3" {
+		t.Errorf("FormatErrorStats() = %q", got)
+	}
+	if FormatErrorStats(nil) != "none" {
+		t.Error("Empty counters should format as none")
+	}
+}
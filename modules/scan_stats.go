@@ -0,0 +1,244 @@
+package modules
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/term"
+)
+
+// statsInterval is how often the live statistics line is refreshed
+const statsInterval = time.Second
+
+// logStatsInterval is how often the statistics are printed when stderr is not a terminal
+const logStatsInterval = 10 * time.Second
+
+// ScanStats counts the progress of a running scan
+type ScanStats struct {
+	start    time.Time
+	total    int64
+	done     int64
+	inFlight int64
+	requests int64
+	hits     int64
+
+	// Request error and retry counters, per error class
+	errorsMu sync.Mutex
+	errors   map[ErrorClass]int
+	retries  map[ErrorClass]int
+}
+
+// ScanSummary is a snapshot of the scan statistics
+type ScanSummary struct {
+	Elapsed        string             `json:"elapsed"`
+	Addresses      int64              `json:"addresses"`
+	Scanned        int64              `json:"scanned"`
+	InFlight       int64              `json:"in_flight,omitempty"`
+	Requests       int64              `json:"requests"`
+	RequestsPerSec float64            `json:"requests_per_sec"`
+	Hits           int64              `json:"hits"`
+	Errors         map[ErrorClass]int `json:"errors,omitempty"`
+	Retries        map[ErrorClass]int `json:"retries,omitempty"`
+	ETA            string             `json:"eta,omitempty"`
+}
+
+// NewScanStats starts counting a scan over total addresses
+func NewScanStats(total int) *ScanStats {
+	return &ScanStats{
+		start:   time.Now(),
+		total:   int64(total),
+		errors:  map[ErrorClass]int{},
+		retries: map[ErrorClass]int{},
+	}
+}
+
+// StartScanStats starts counting the scan of the engine over total addresses
+func (e *Engine) StartScanStats(total int) *ScanStats {
+	stats := NewScanStats(total)
+	e.mu.Lock()
+	e.stats = stats
+	e.mu.Unlock()
+	return stats
+}
+
+// ScanStats returns the statistics of the running scan, or nil before it started
+func (e *Engine) ScanStats() *ScanStats {
+	if e == nil {
+		return nil
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.stats
+}
+
+// countRequest counts a request attempt of the running scan
+func (e *Engine) countRequest() {
+	if stats := e.ScanStats(); stats != nil {
+		atomic.AddInt64(&stats.requests, 1)
+	}
+}
+
+// recordError counts a failed attempt and whether it is retried
+func (e *Engine) recordError(class ErrorClass, retried bool) {
+	if retried {
+		retriesTotal.WithLabelValues(string(class)).Inc()
+	}
+	if stats := e.ScanStats(); stats != nil {
+		stats.recordError(class, retried)
+	}
+}
+
+func (s *ScanStats) recordError(class ErrorClass, retried bool) {
+	s.errorsMu.Lock()
+	defer s.errorsMu.Unlock()
+
+	s.errors[class]++
+	if retried {
+		s.retries[class]++
+	}
+}
+
+// ErrorStats returns copies of the error and retry counters
+func (s *ScanStats) ErrorStats() (map[ErrorClass]int, map[ErrorClass]int) {
+	s.errorsMu.Lock()
+	defer s.errorsMu.Unlock()
+
+	errs := make(map[ErrorClass]int, len(s.errors))
+	for class, n := range s.errors {
+		errs[class] = n
+	}
+	retries := make(map[ErrorClass]int, len(s.retries))
+	for class, n := range s.retries {
+		retries[class] = n
+	}
+	return errs, retries
+}
+
+// Begin marks an address as being probed
+func (s *ScanStats) Begin() {
+	atomic.AddInt64(&s.inFlight, 1)
+}
+
+// End marks an address as finished
+func (s *ScanStats) End() {
+	atomic.AddInt64(&s.inFlight, -1)
+	atomic.AddInt64(&s.done, 1)
+}
+
+// AddHit counts a reported site
+func (s *ScanStats) AddHit() {
+	atomic.AddInt64(&s.hits, 1)
+}
+
+// Summary returns a snapshot of the statistics. The ETA is derived from the
+// observed address throughput, so it already reflects the worker count.
+func (s *ScanStats) Summary() *ScanSummary {
+	elapsed := time.Since(s.start)
+	summary := &ScanSummary{
+		Addresses: atomic.LoadInt64(&s.total),
+		Scanned:   atomic.LoadInt64(&s.done),
+		InFlight:  atomic.LoadInt64(&s.inFlight),
+		Requests:  atomic.LoadInt64(&s.requests),
+		Hits:      atomic.LoadInt64(&s.hits),
+	}
+	summary.Errors, summary.Retries = s.ErrorStats()
+	summary.Elapsed = formatDuration(elapsed)
+
+	if secs := elapsed.Seconds(); secs > 0 {
+		summary.RequestsPerSec = math.Round(float64(summary.Requests)/secs*10) / 10
+	}
+	if remaining := summary.Addresses - summary.Scanned; remaining > 0 && summary.Scanned > 0 {
+		eta := time.Duration(float64(elapsed) / float64(summary.Scanned) * float64(remaining))
+		summary.ETA = formatDuration(eta)
+	}
+	return summary
+}
+
+// String formats the live statistics line
+func (s *ScanSummary) String() string {
+	eta := s.ETA
+	if eta == "" {
+		eta = "-"
+	}
+	return fmt.Sprintf("%d/%d | %.1f req/s | hits %d | errors %s | in-flight %d | elapsed %s | ETA %s",
+		s.Scanned, s.Addresses, s.RequestsPerSec, s.Hits, formatErrorTotal(s.Errors), s.InFlight, s.Elapsed, eta)
+}
+
+// Lines formats the final summary block
+func (s *ScanSummary) Lines() []string {
+	return []string{
+		"Elapsed:     " + s.Elapsed,
+		fmt.Sprintf("Scanned:     %d/%d addresses", s.Scanned, s.Addresses),
+		fmt.Sprintf("Requests:    %d (%.1f req/s)", s.Requests, s.RequestsPerSec),
+		fmt.Sprintf("Hits:        %d", s.Hits),
+		"Errors:      " + FormatErrorStats(s.Errors),
+		"Retries:     " + FormatErrorStats(s.Retries),
+	}
+}
+
+// formatErrorTotal formats error counters as "12 (refused=10 timeout=2)"
+func formatErrorTotal(counts map[ErrorClass]int) string {
+	total := 0
+	for _, n := range counts {
+		total += n
+	}
+	if total == 0 {
+		return "0"
+	}
+	return fmt.Sprintf("%d (%s)", total, FormatErrorStats(counts))
+}
+
+// formatDuration rounds d to seconds, e.g. "1m2s"
+func formatDuration(d time.Duration) string {
+	return d.Round(time.Second).String()
+}
+
+// StderrIsTerminal reports whether stderr is attached to a terminal
+func StderrIsTerminal() bool {
+	return term.IsTerminal(int(os.Stderr.Fd()))
+}
+
+// ReportScanStats refreshes the live statistics until the returned stop
+// function is called. On a terminal the line is shown through describe
+// (the progress bar description), otherwise it is logged to w periodically.
+func ReportScanStats(stats *ScanStats, w io.Writer, describe func(string)) func() {
+	if describe != nil {
+		return ObserveScanStats(stats, statsInterval, func(summary *ScanSummary) {
+			describe(summary.String())
+		})
+	}
+	return ObserveScanStats(stats, logStatsInterval, func(summary *ScanSummary) {
+		fmt.Fprintln(w, "[STATS] "+summary.String())
+	})
+}
+
+// ObserveScanStats calls fn with a snapshot of the statistics every interval
+// until the returned stop function is called
+func ObserveScanStats(stats *ScanStats, interval time.Duration, fn func(*ScanSummary)) func() {
+	ticker := time.NewTicker(interval)
+	quit := make(chan struct{})
+	var once sync.Once
+
+	go func() {
+		for {
+			select {
+			case <-ticker.C:
+				fn(stats.Summary())
+			case <-quit:
+				return
+			}
+		}
+	}()
+
+	return func() {
+		once.Do(func() {
+			ticker.Stop()
+			close(quit)
+		})
+	}
+}
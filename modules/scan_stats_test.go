@@ -0,0 +1,77 @@
+package modules
+
+import (
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestScanStatsSummary(t *testing.T) {
+	e := NewEngine(EngineSettings{})
+	stats := e.StartScanStats(10)
+
+	// Pretend the scan started two seconds ago so the rates are stable
+	stats.start = time.Now().Add(-2 * time.Second)
+
+	for i := 0; i < 4; i++ {
+		stats.Begin()
+		e.countRequest()
+		stats.End()
+	}
+	stats.Begin()
+	stats.AddHit()
+	e.recordError(ErrTimeout, true)
+
+	summary := stats.Summary()
+	if summary.Addresses != 10 || summary.Scanned != 4 || summary.InFlight != 1 || summary.Hits != 1 {
+		t.Errorf("Summary counters = %+v", summary)
+	}
+	if summary.Requests != 4 || summary.RequestsPerSec != 2 {
+		t.Errorf("Requests = %d (%.1f/s), want 4 (2.0/s)", summary.Requests, summary.RequestsPerSec)
+	}
+	// 4 addresses in 2s, 6 remaining -> 3s
+	if summary.ETA != "3s" {
+		t.Errorf("ETA = %q, want 3s", summary.ETA)
+	}
+	if summary.Errors[ErrTimeout] != 1 || summary.Retries[ErrTimeout] != 1 {
+		t.Errorf("Errors = %v, Retries = %v", summary.Errors, summary.Retries)
+	}
+
+	line := summary.String()
+	for _, part := range []string{"4/10", "2.0 req/s", "hits 1", "errors 1 (timeout=1)", "in-flight 1", "ETA 3s"} {
+		if !strings.Contains(line, part) {
+			t.Errorf("Stats line %q does not contain %q", line, part)
+		}
+	}
+}
+
+func TestScanSummaryWithoutProgress(t *testing.T) {
+	stats := NewScanStats(5)
+	summary := stats.Summary()
+	if summary.ETA != "" {
+		t.Errorf("ETA should be unknown before the first address finishes, got %q", summary.ETA)
+	}
+	if !strings.Contains(summary.String(), "ETA -") {
+		t.Errorf("Stats line = %q", summary.String())
+	}
+}
+
+func TestReportScanStats(t *testing.T) {
+	stats := NewScanStats(1)
+
+	lines := make(chan string, 10)
+	stop := ReportScanStats(stats, io.Discard, func(line string) { lines <- line })
+
+	select {
+	case line := <-lines:
+		if !strings.Contains(line, "0/1") {
+			t.Errorf("Stats line = %q", line)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatal("Statistics were not reported")
+	}
+
+	stop()
+	stop() // stopping twice is safe
+}
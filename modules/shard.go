@@ -0,0 +1,72 @@
+package modules
+
+import (
+	"fmt"
+	"hash/fnv"
+	"strconv"
+	"strings"
+)
+
+// Shard selects a deterministic part of the scanned addresses, so n
+// invocations with the same targets and shards 1/n..n/n scan disjoint parts
+type Shard struct {
+	Index int // 1-based shard number
+	Count int // number of shards, 0 when the scan is not sharded
+}
+
+// ParseShard parses the "i/n" form, e.g. 2/4
+func ParseShard(s string) (Shard, error) {
+	index, count, found := strings.Cut(strings.TrimSpace(s), "/")
+	i, errIndex := strconv.Atoi(index)
+	n, errCount := strconv.Atoi(count)
+	if !found || errIndex != nil || errCount != nil {
+		return Shard{}, fmt.Errorf("invalid shard %q, use i/n (e.g. 1/4)", s)
+	}
+
+	shard := Shard{Index: i, Count: n}
+	return shard, shard.Validate()
+}
+
+// Validate checks that the shard number is within the shard count
+func (s Shard) Validate() error {
+	if s.Count == 0 && s.Index == 0 {
+		return nil
+	}
+	if s.Count < 1 || s.Index < 1 || s.Index > s.Count {
+		return fmt.Errorf("invalid shard %d/%d, use i/n with 1 <= i <= n", s.Index, s.Count)
+	}
+	return nil
+}
+
+// String returns the "i/n" form, or "" when the scan is not sharded
+func (s Shard) String() string {
+	if s.Count == 0 {
+		return ""
+	}
+	return strconv.Itoa(s.Index) + "/" + strconv.Itoa(s.Count)
+}
+
+// Contains reports whether the address belongs to the shard. Addresses are
+// assigned by hash, so the split does not depend on the order of the targets.
+func (s Shard) Contains(addr string) bool {
+	if s.Count <= 1 {
+		return true
+	}
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(addr))
+	return int(h.Sum32()%uint32(s.Count)) == s.Index-1
+}
+
+// Filter returns the addresses of the shard in their original order
+func (s Shard) Filter(addrs []string) []string {
+	if s.Count <= 1 {
+		return addrs
+	}
+	var filtered []string
+	for _, addr := range addrs {
+		if s.Contains(addr) {
+			filtered = append(filtered, addr)
+		}
+	}
+	return filtered
+}
@@ -0,0 +1,73 @@
+package modules
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestParseShard(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    Shard
+		wantErr bool
+	}{
+		{"1/4", Shard{Index: 1, Count: 4}, false},
+		{" 4/4 ", Shard{Index: 4, Count: 4}, false},
+		{"0/4", Shard{}, true},
+		{"5/4", Shard{}, true},
+		{"1", Shard{}, true},
+		{"a/b", Shard{}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got, err := ParseShard(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseShard(%q) error = %v, wantErr %v", tt.input, err, tt.wantErr)
+			}
+			if !tt.wantErr && got != tt.want {
+				t.Errorf("ParseShard(%q) = %+v, want %+v", tt.input, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestShardFilter(t *testing.T) {
+	var addrs []string
+	for i := 0; i < 1024; i++ {
+		addrs = append(addrs, fmt.Sprintf("10.0.%d.%d", i/256, i%256))
+	}
+
+	// Every address is in exactly one shard, whatever the order of the targets
+	const n = 4
+	owner := map[string]int{}
+	for i := 1; i <= n; i++ {
+		part := Shard{Index: i, Count: n}.Filter(addrs)
+		if len(part) < len(addrs)/n/2 {
+			t.Errorf("Shard %d/%d has %d of %d addresses", i, n, len(part), len(addrs))
+		}
+		for _, addr := range part {
+			if prev, ok := owner[addr]; ok {
+				t.Fatalf("%s is in shards %d and %d", addr, prev, i)
+			}
+			owner[addr] = i
+		}
+	}
+	if len(owner) != len(addrs) {
+		t.Errorf("Shards cover %d of %d addresses", len(owner), len(addrs))
+	}
+
+	reversed := make([]string, len(addrs))
+	for i, addr := range addrs {
+		reversed[len(addrs)-1-i] = addr
+	}
+	for _, addr := range (Shard{Index: 2, Count: n}).Filter(reversed) {
+		if owner[addr] != 2 {
+			t.Errorf("%s moved from shard %d to 2 when the targets were reordered", addr, owner[addr])
+		}
+	}
+
+	if got := (Shard{}).Filter(addrs); len(got) != len(addrs) {
+		t.Errorf("Unsharded filter kept %d of %d addresses", len(got), len(addrs))
+	}
+}
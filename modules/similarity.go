@@ -0,0 +1,304 @@
+package modules
+
+import (
+	"hash/fnv"
+	"math/bits"
+	"net/http"
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+// PageSample holds the parts of a response used for similarity scoring
+type PageSample struct {
+	Title   string      `json:"title"`
+	Body    string      `json:"body"`
+	Headers http.Header `json:"headers"`
+}
+
+// Weights of the individual signals in the final score
+const (
+	titleWeight  = 0.40
+	bodyWeight   = 0.45
+	headerWeight = 0.15
+)
+
+// Titles that say nothing about which site served them
+var genericTitles = map[string]bool{
+	"login": true, "log in": true, "sign in": true, "home": true, "index": true,
+	"welcome": true, "dashboard": true, "admin": true, "untitled": true, "document": true,
+	"403 forbidden": true, "404 not found": true, "not found": true, "error": true,
+	"502 bad gateway": true, "503 service unavailable": true, "access denied": true,
+	"welcome to nginx!": true, "apache2 ubuntu default page: it works": true, "it works!": true,
+	"iis windows server": true, "test page for the apache http server": true,
+}
+
+// Headers whose values change on every response and carry no identity
+var volatileHeaders = map[string]bool{
+	"date": true, "content-length": true, "age": true, "expires": true, "last-modified": true,
+	"etag": true, "x-request-id": true, "x-runtime": true, "cf-ray": true, "x-amz-cf-id": true,
+	"connection": true, "keep-alive": true, "transfer-encoding": true,
+}
+
+var scriptStyleRe = regexp.MustCompile(`(?is)<(script|style)\b.*?</(script|style)>`)
+var tagRe = regexp.MustCompile(`(?s)<[^>]*>`)
+
+// ParsePageSample builds a page sample from a raw response dump
+func ParsePageSample(raw string) PageSample {
+	head, body := SplitRawResponse(raw)
+
+	headers := http.Header{}
+	for i, line := range strings.Split(head, "\r\n") {
+		if i == 0 {
+			continue // status line
+		}
+		if idx := strings.Index(line, ":"); idx > 0 {
+			headers.Add(strings.TrimSpace(line[:idx]), strings.TrimSpace(line[idx+1:]))
+		}
+	}
+
+	sample := PageSample{Body: DecodeBody([]byte(body), headers.Get("Content-Type")), Headers: headers}
+	sample.Title, _ = extractTitle(sample.Body)
+
+	return sample
+}
+
+// SimilarityScore compares a candidate page with the baseline and returns a 0-100 score
+func SimilarityScore(baseline PageSample, candidate PageSample) int {
+	var score, total float64
+
+	baseTitle := normalizeText(baseline.Title)
+	candTitle := normalizeText(candidate.Title)
+	if baseTitle != "" || candTitle != "" {
+		weight := titleWeight
+		// A generic title only counts a little, the body has to confirm it
+		if genericTitles[baseTitle] {
+			weight /= 4
+		}
+		score += weight * TitleSimilarity(baseTitle, candTitle)
+		total += weight
+	}
+
+	baseText := pageText(baseline.Body)
+	candText := pageText(candidate.Body)
+	if baseText != "" || candText != "" {
+		score += bodyWeight * BodySimilarity(baseText, candText)
+		total += bodyWeight
+	}
+
+	if len(baseline.Headers) > 0 || len(candidate.Headers) > 0 {
+		score += headerWeight * HeaderSimilarity(baseline.Headers, candidate.Headers)
+		total += headerWeight
+	}
+
+	if total == 0 {
+		return 0
+	}
+
+	return int(score/total*100 + 0.5)
+}
+
+// TitleSimilarity returns a 0-1 fuzzy similarity of two titles
+func TitleSimilarity(a string, b string) float64 {
+	a = normalizeText(a)
+	b = normalizeText(b)
+
+	if a == b {
+		if a == "" {
+			return 0
+		}
+		return 1
+	}
+	if a == "" || b == "" {
+		return 0
+	}
+
+	// Token overlap handles reordered and partially dynamic titles,
+	// edit distance handles small typos and localized suffixes
+	tokenScore := diceCoefficient(strings.Fields(a), strings.Fields(b))
+
+	ra, rb := []rune(a), []rune(b)
+	maxLen := len(ra)
+	if len(rb) > maxLen {
+		maxLen = len(rb)
+	}
+	editScore := 1 - float64(levenshtein(ra, rb))/float64(maxLen)
+
+	if tokenScore > editScore {
+		return tokenScore
+	}
+	return editScore
+}
+
+// BodySimilarity returns a 0-1 similarity of two page texts based on simhash
+func BodySimilarity(a string, b string) float64 {
+	if a == b {
+		if a == "" {
+			return 0
+		}
+		return 1
+	}
+	if a == "" || b == "" {
+		return 0
+	}
+
+	distance := bits.OnesCount64(Simhash(a) ^ Simhash(b))
+
+	// Unrelated documents land around 32 bits apart, so scale that to zero
+	similarity := 1 - float64(distance)/32
+	if similarity < 0 {
+		return 0
+	}
+	return similarity
+}
+
+// HeaderSimilarity returns a 0-1 overlap of the identifying headers of two responses
+func HeaderSimilarity(a http.Header, b http.Header) float64 {
+	fa, fb := headerFeatures(a), headerFeatures(b)
+	if len(fa) == 0 && len(fb) == 0 {
+		return 0
+	}
+
+	common := 0
+	for f := range fa {
+		if fb[f] {
+			common++
+		}
+	}
+
+	return float64(common) / float64(len(fa)+len(fb)-common)
+}
+
+// Simhash computes a 64-bit simhash of the text using 3-word shingles
+func Simhash(text string) uint64 {
+	words := strings.Fields(text)
+	if len(words) == 0 {
+		return 0
+	}
+
+	var vector [64]int
+	add := func(feature string) {
+		h := fnv.New64a()
+		_, _ = h.Write([]byte(feature))
+		sum := h.Sum64()
+		for i := 0; i < 64; i++ {
+			if sum&(1<<uint(i)) != 0 {
+				vector[i]++
+			} else {
+				vector[i]--
+			}
+		}
+	}
+
+	if len(words) < 3 {
+		add(strings.Join(words, " "))
+	}
+	for i := 0; i+3 <= len(words); i++ {
+		add(strings.Join(words[i:i+3], " "))
+	}
+
+	var fingerprint uint64
+	for i := 0; i < 64; i++ {
+		if vector[i] > 0 {
+			fingerprint |= 1 << uint(i)
+		}
+	}
+	return fingerprint
+}
+
+// headerFeatures extracts the header names, server value and cookie names of a response
+func headerFeatures(h http.Header) map[string]bool {
+	features := map[string]bool{}
+	for name, values := range h {
+		lower := strings.ToLower(name)
+		if volatileHeaders[lower] {
+			continue
+		}
+		features["h:"+lower] = true
+
+		switch lower {
+		case "server", "x-powered-by":
+			for _, v := range values {
+				features[lower+":"+strings.ToLower(v)] = true
+			}
+		case "set-cookie":
+			for _, v := range values {
+				if idx := strings.Index(v, "="); idx > 0 {
+					features["cookie:"+strings.TrimSpace(v[:idx])] = true
+				}
+			}
+		}
+	}
+	return features
+}
+
+// pageText strips markup from a page and returns its normalized visible text
+func pageText(body string) string {
+	text := scriptStyleRe.ReplaceAllString(body, " ")
+	text = tagRe.ReplaceAllString(text, " ")
+	return normalizeText(text)
+}
+
+// normalizeText lowercases text and collapses punctuation and whitespace
+func normalizeText(s string) string {
+	s = strings.ToLower(s)
+	s = strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) || r == '!' || r == ':' {
+			return r
+		}
+		return ' '
+	}, s)
+	return strings.Join(strings.Fields(s), " ")
+}
+
+// diceCoefficient returns the Sørensen–Dice coefficient of two token lists
+func diceCoefficient(a []string, b []string) float64 {
+	if len(a) == 0 || len(b) == 0 {
+		return 0
+	}
+
+	counts := map[string]int{}
+	for _, t := range a {
+		counts[t]++
+	}
+
+	common := 0
+	for _, t := range b {
+		if counts[t] > 0 {
+			counts[t]--
+			common++
+		}
+	}
+
+	return 2 * float64(common) / float64(len(a)+len(b))
+}
+
+// levenshtein returns the edit distance between two rune slices
+func levenshtein(a []rune, b []rune) int {
+	prev := make([]int, len(b)+1)
+	curr := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+
+	for i := 1; i <= len(a); i++ {
+		curr[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			curr[j] = minInt(prev[j]+1, minInt(curr[j-1]+1, prev[j-1]+cost))
+		}
+		prev, curr = curr, prev
+	}
+
+	return prev[len(b)]
+}
+
+func minInt(a int, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,107 @@
+package modules
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+const samplePage = `<html><head><title>Acme Store - Home</title></head><body>
+<h1>Welcome to Acme Store</h1>
+<p>We sell rockets, anvils, giant magnets and other fine products for coyotes.</p>
+<p>Free shipping on orders over fifty dollars. Contact our support team any time.</p>
+<script>var token = "abc";</script>
+</body></html>`
+
+func TestTitleSimilarity(t *testing.T) {
+	tests := []struct {
+		name string
+		a    string
+		b    string
+		min  float64
+		max  float64
+	}{
+		{"Identical", "Acme Store", "Acme Store", 1, 1},
+		{"Trailing whitespace", "Acme Store", "  Acme Store \n", 1, 1},
+		{"Dynamic year", "Home | Acme - 2026", "Home | Acme - 2025", 0.7, 1},
+		{"Case difference", "ACME STORE", "acme store", 1, 1},
+		{"Unrelated", "Acme Store", "Router Configuration", 0, 0.3},
+		{"Empty", "", "", 0, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := TitleSimilarity(tt.a, tt.b)
+			if got < tt.min || got > tt.max {
+				t.Errorf("TitleSimilarity(%q, %q) = %.2f, want between %.2f and %.2f", tt.a, tt.b, got, tt.min, tt.max)
+			}
+		})
+	}
+}
+
+func TestBodySimilarity(t *testing.T) {
+	base := pageText(samplePage)
+
+	if got := BodySimilarity(base, base); got != 1 {
+		t.Errorf("Identical bodies should score 1, got %.2f", got)
+	}
+
+	changed := pageText(strings.Replace(samplePage, "fifty", "sixty", 1))
+	if got := BodySimilarity(base, changed); got < 0.6 {
+		t.Errorf("Slightly changed body should be similar, got %.2f", got)
+	}
+
+	other := pageText(`<html><body><form>Username Password Remember me Forgot your password</form></body></html>`)
+	if got := BodySimilarity(base, other); got > 0.5 {
+		t.Errorf("Unrelated body should not be similar, got %.2f", got)
+	}
+}
+
+func TestHeaderSimilarity(t *testing.T) {
+	a := http.Header{"Server": {"nginx"}, "Set-Cookie": {"session=1; Path=/"}, "Date": {"Mon"}}
+	b := http.Header{"Server": {"nginx"}, "Set-Cookie": {"session=2; Path=/"}, "Date": {"Tue"}}
+	c := http.Header{"Server": {"Apache"}}
+
+	if got := HeaderSimilarity(a, b); got != 1 {
+		t.Errorf("Equivalent headers should score 1, got %.2f", got)
+	}
+	if got := HeaderSimilarity(a, c); got >= 0.5 {
+		t.Errorf("Different headers should score low, got %.2f", got)
+	}
+}
+
+func TestSimilarityScore(t *testing.T) {
+	raw := "HTTP/1.1 200 OK\r\nServer: nginx\r\nSet-Cookie: session=1\r\n\r\n" + samplePage
+	baseline := ParsePageSample(raw)
+
+	if baseline.Title != "Acme Store - Home" {
+		t.Fatalf("Title not parsed: %q", baseline.Title)
+	}
+	if baseline.Headers.Get("Server") != "nginx" {
+		t.Fatalf("Headers not parsed: %v", baseline.Headers)
+	}
+
+	if got := SimilarityScore(baseline, baseline); got != 100 {
+		t.Errorf("Identical pages should score 100, got %d", got)
+	}
+
+	dynamic := ParsePageSample(strings.Replace(raw, "Acme Store - Home", "Acme Store - Home ", 1))
+	if got := SimilarityScore(baseline, dynamic); got < 90 {
+		t.Errorf("Page with trailing whitespace in title should score high, got %d", got)
+	}
+
+	other := ParsePageSample("HTTP/1.1 200 OK\r\nServer: Apache\r\n\r\n<html><title>Login</title><body>Username Password</body></html>")
+	if got := SimilarityScore(baseline, other); got > 40 {
+		t.Errorf("Unrelated page should score low, got %d", got)
+	}
+}
+
+func TestSimilarityScoreGenericTitle(t *testing.T) {
+	baseline := ParsePageSample("HTTP/1.1 200 OK\r\n\r\n<title>Login</title><body>" + samplePage + "</body>")
+	candidate := ParsePageSample("HTTP/1.1 200 OK\r\n\r\n<title>Login</title><body>Router admin panel enter the device password below</body>")
+
+	// Matching only on a generic title must not reach the default threshold
+	if got := SimilarityScore(baseline, candidate); got >= 75 {
+		t.Errorf("Generic title match scored %d, want below 75", got)
+	}
+}
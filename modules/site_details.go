@@ -0,0 +1,86 @@
+package modules
+
+// SiteDetails holds extra fingerprint data collected for a found website
+type SiteDetails struct {
+	IP           string   `json:"ip"`
+	Score        int      `json:"score,omitempty"`
+	DomainMatch  bool     `json:"domain_match,omitempty"`
+	Reasons      []string `json:"reasons,omitempty"`
+	Edge         string   `json:"edge,omitempty"`
+	EdgeProvider string   `json:"edge_provider,omitempty"`
+	Technologies []string `json:"technologies,omitempty"`
+
+	Redirects         []RedirectHop `json:"redirects,omitempty"`
+	DiscoveredDomains []string      `json:"discovered_domains,omitempty"`
+	FaviconURL        string        `json:"favicon_url,omitempty"`
+	FaviconMMH3       string        `json:"favicon_mmh3,omitempty"`
+	FaviconSHA256     string        `json:"favicon_sha256,omitempty"`
+	FaviconMatch      bool          `json:"favicon_match,omitempty"`
+}
+
+// UpdateSiteDetails applies fn to the details of the given URL, creating them if needed
+func (e *Engine) UpdateSiteDetails(ip string, fn func(d *SiteDetails)) {
+	if e == nil {
+		return
+	}
+	e.detailsMu.Lock()
+	defer e.detailsMu.Unlock()
+
+	d, ok := e.details[ip]
+	if !ok {
+		d = &SiteDetails{IP: ip}
+		e.details[ip] = d
+		e.detailsOrder = append(e.detailsOrder, ip)
+	}
+	fn(d)
+}
+
+// SiteDetails returns a copy of the details recorded for the given URL
+func (e *Engine) SiteDetails(ip string) (SiteDetails, bool) {
+	if e == nil {
+		return SiteDetails{}, false
+	}
+	e.detailsMu.Lock()
+	defer e.detailsMu.Unlock()
+
+	d, ok := e.details[ip]
+	if !ok {
+		return SiteDetails{}, false
+	}
+	return *d, true
+}
+
+// AllSiteDetails returns the recorded details in discovery order
+func (e *Engine) AllSiteDetails() []SiteDetails {
+	if e == nil {
+		return nil
+	}
+	e.detailsMu.Lock()
+	defer e.detailsMu.Unlock()
+
+	result := make([]SiteDetails, 0, len(e.detailsOrder))
+	for _, ip := range e.detailsOrder {
+		result = append(result, *e.details[ip])
+	}
+	return result
+}
+
+// RemoveSiteDetails forgets the details of the given URL
+func (e *Engine) RemoveSiteDetails(ip string) {
+	if e == nil {
+		return
+	}
+	e.detailsMu.Lock()
+	defer e.detailsMu.Unlock()
+
+	if _, ok := e.details[ip]; !ok {
+		return
+	}
+	delete(e.details, ip)
+	for i, v := range e.detailsOrder {
+		if v == ip {
+			e.detailsOrder = append(e.detailsOrder[:i], e.detailsOrder[i+1:]...)
+			break
+		}
+	}
+}
@@ -0,0 +1,155 @@
+package modules
+
+import (
+	"context"
+	"net"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+// DefaultSubdomainWords are subdomains that often point at the origin
+// server instead of the CDN in front of the domain
+var DefaultSubdomainWords = []string{
+	"direct", "direct-connect", "origin", "origin-www", "www-origin", "backend", "server",
+	"mail", "webmail", "smtp", "pop", "imap", "mx", "autodiscover", "autoconfig",
+	"cpanel", "whm", "webdisk", "plesk", "ftp", "sftp", "ssh", "vpn", "remote",
+	"dev", "development", "staging", "stage", "test", "beta", "demo", "uat", "old", "legacy", "backup",
+	"admin", "portal", "api", "app", "cdn-origin", "ns1", "ns2", "www", "m",
+}
+
+// Lookups of the subdomain phase
+const (
+	subdomainWorkers = 50
+	subdomainTimeout = 2 * time.Second
+)
+
+// SubdomainRecord is an address a subdomain of the scanned domain resolves to
+type SubdomainRecord struct {
+	Hostname string `json:"hostname"`
+	IP       string `json:"ip"`
+	Edge     string `json:"edge,omitempty"` // CDN/WAF provider owning the address
+}
+
+// SubdomainNames returns the domain followed by the words as its subdomains;
+// words that already end in the domain are kept as they are
+func SubdomainNames(domain string, words []string) []string {
+	names := []string{domain}
+	seen := map[string]bool{domain: true}
+	for _, word := range words {
+		word = strings.ToLower(strings.TrimSpace(word))
+		if word == "" {
+			continue
+		}
+		if name := hostnameFor(word, domain); !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// DiscoverSubdomains resolves the hostnames to IPv4 addresses through the
+// DNS servers of the engine. Addresses that random subdomains resolve to as
+// well (wildcard DNS) are dropped, so are hostnames that do not resolve.
+func (e *Engine) DiscoverSubdomains(ctx context.Context, domain string, hosts []string) []SubdomainRecord {
+	resolver := NewResolver(e.settings.DNSServers, subdomainTimeout)
+	return e.discoverSubdomains(ctx, domain, hosts, func(ctx context.Context, host string) []string {
+		ctx, cancel := context.WithTimeout(ctx, subdomainTimeout)
+		defer cancel()
+
+		addrs, err := resolver.LookupIP(ctx, "ip4", host)
+		if err != nil {
+			e.verbose("Subdomain %s did not resolve: %v", host, err)
+			return nil
+		}
+		ips := make([]string, 0, len(addrs))
+		for _, addr := range addrs {
+			ips = append(ips, addr.String())
+		}
+		return ips
+	})
+}
+
+func (e *Engine) discoverSubdomains(ctx context.Context, domain string, hosts []string, lookup func(ctx context.Context, host string) []string) []SubdomainRecord {
+	// Names that cannot exist tell the wildcard addresses apart
+	wildcard := map[string]bool{}
+	for i := 0; i < 2; i++ {
+		for _, ip := range lookup(ctx, randomLabel()+"."+domain) {
+			wildcard[ip] = true
+		}
+	}
+	if len(wildcard) > 0 {
+		e.warn("Wildcard DNS on *.%s (%s), subdomains resolving there are ignored", domain, strings.Join(sortedKeys(wildcard), ", "))
+	}
+
+	resolved := make([][]string, len(hosts))
+	forEach(ctx, len(hosts), subdomainWorkers, func(i int) {
+		resolved[i] = lookup(ctx, hosts[i])
+	})
+
+	var records []SubdomainRecord
+	for i, host := range hosts {
+		for _, ip := range resolved[i] {
+			if wildcard[ip] || net.ParseIP(ip) == nil {
+				continue
+			}
+			record := SubdomainRecord{Hostname: host, IP: ip, Edge: EdgeProviderForIP(ip)}
+			e.verbose("Subdomain %s resolves to %s %s", host, ip, record.Edge)
+			records = append(records, record)
+		}
+	}
+	return records
+}
+
+// SubdomainOrigins returns the unique addresses of the records that are not
+// known CDN/WAF edges, in the order of the records
+func SubdomainOrigins(records []SubdomainRecord) []string {
+	var ips []string
+	seen := map[string]bool{}
+	for _, r := range records {
+		if r.Edge == "" && !seen[r.IP] {
+			seen[r.IP] = true
+			ips = append(ips, r.IP)
+		}
+	}
+	return ips
+}
+
+// MarkSubdomainEdges sets the provider of records whose address was found to
+// be a CDN/WAF edge by its response during the scan, the address ranges alone
+// miss providers and smaller allocations
+func MarkSubdomainEdges(records []SubdomainRecord, details []SiteDetails) {
+	edges := map[string]string{}
+	for _, d := range details {
+		if d.EdgeProvider == "" {
+			continue
+		}
+		if u, err := url.Parse(d.IP); err == nil {
+			edges[u.Hostname()] = d.EdgeProvider
+		}
+	}
+	for i := range records {
+		if records[i].Edge == "" {
+			records[i].Edge = edges[records[i].IP]
+		}
+	}
+}
+
+// hostnameFor returns word as a subdomain of domain unless it already is one
+func hostnameFor(word string, domain string) string {
+	if domain == "" || word == domain || strings.HasSuffix(word, "."+domain) {
+		return word
+	}
+	return word + "." + domain
+}
+
+func sortedKeys(m map[string]bool) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,119 @@
+package modules
+
+import (
+	"context"
+	"encoding/binary"
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// startDNSServer answers A queries from records over UDP; names under
+// wildcard that are not in records get the wildcard address
+func startDNSServer(t *testing.T, records map[string]string, wildcard string, wildcardIP string) string {
+	t.Helper()
+
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	go func() {
+		buf := make([]byte, 512)
+		for {
+			n, addr, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			query := buf[:n]
+			if len(query) < 12 {
+				continue
+			}
+
+			// The question is the labels of the name followed by type and class
+			var labels []string
+			end := 12
+			for end < n && query[end] != 0 {
+				size := int(query[end])
+				labels = append(labels, string(query[end+1:end+1+size]))
+				end += size + 1
+			}
+			end += 5
+			name := strings.ToLower(strings.Join(labels, "."))
+
+			ip, ok := records[name]
+			if !ok && strings.HasSuffix(name, "."+wildcard) {
+				ip = wildcardIP
+			}
+
+			resp := append([]byte(nil), query[:end]...)
+			binary.BigEndian.PutUint16(resp[2:], 0x8180) // response, recursion available
+			binary.BigEndian.PutUint16(resp[6:], 0)      // answers
+			binary.BigEndian.PutUint16(resp[8:], 0)
+			binary.BigEndian.PutUint16(resp[10:], 0)
+			if ip == "" {
+				binary.BigEndian.PutUint16(resp[2:], 0x8183) // NXDOMAIN
+			} else {
+				binary.BigEndian.PutUint16(resp[6:], 1)
+				resp = append(resp, 0xc0, 0x0c, 0, 1, 0, 1, 0, 0, 0, 60, 0, 4)
+				resp = append(resp, net.ParseIP(ip).To4()...)
+			}
+			_, _ = conn.WriteTo(resp, addr)
+		}
+	}()
+	return conn.LocalAddr().String()
+}
+
+func TestDiscoverSubdomains(t *testing.T) {
+	server := startDNSServer(t, map[string]string{
+		"example.test":        "104.16.1.1", // behind Cloudflare
+		"direct.example.test": "198.51.100.7",
+		"mail.example.test":   "198.51.100.8",
+		"old.example.test":    "198.51.100.7",
+	}, "example.test", "203.0.113.9")
+
+	e := NewEngine(EngineSettings{DNSServers: []string{server}})
+	hosts := SubdomainNames("example.test", []string{"direct", "mail", "dev", "old", "direct"})
+	records := e.DiscoverSubdomains(context.Background(), "example.test", hosts)
+
+	// dev only resolves through the wildcard and is left out
+	want := []SubdomainRecord{
+		{Hostname: "example.test", IP: "104.16.1.1", Edge: "Cloudflare"},
+		{Hostname: "direct.example.test", IP: "198.51.100.7"},
+		{Hostname: "mail.example.test", IP: "198.51.100.8"},
+		{Hostname: "old.example.test", IP: "198.51.100.7"},
+	}
+	if !reflect.DeepEqual(records, want) {
+		t.Fatalf("DiscoverSubdomains() = %+v, want %+v", records, want)
+	}
+
+	if got, want := SubdomainOrigins(records), []string{"198.51.100.7", "198.51.100.8"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("SubdomainOrigins() = %v, want %v", got, want)
+	}
+}
+
+func TestSubdomainNames(t *testing.T) {
+	got := SubdomainNames("example.com", []string{"dev", " Mail ", "", "api.example.com", "dev", "example.com"})
+	want := []string{"example.com", "dev.example.com", "mail.example.com", "api.example.com"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("SubdomainNames() = %v, want %v", got, want)
+	}
+}
+
+func TestMarkSubdomainEdges(t *testing.T) {
+	records := []SubdomainRecord{
+		{Hostname: "example.test", IP: "104.16.1.1", Edge: "Cloudflare"},
+		{Hostname: "direct.example.test", IP: "198.51.100.7"},
+		{Hostname: "cdn.example.test", IP: "198.51.100.9"},
+	}
+	MarkSubdomainEdges(records, []SiteDetails{
+		{IP: "https://198.51.100.7"},
+		{IP: "https://198.51.100.9:8443", Edge: EdgeCDN, EdgeProvider: "Akamai"},
+	})
+
+	if got := []string{records[0].Edge, records[1].Edge, records[2].Edge}; !reflect.DeepEqual(got, []string{"Cloudflare", "", "Akamai"}) {
+		t.Errorf("Edges = %q, want Cloudflare, none, Akamai", got)
+	}
+}
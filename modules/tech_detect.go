@@ -0,0 +1,229 @@
+package modules
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+//go:embed signatures/technologies.json
+var builtinTechSignatures []byte
+
+// TechSignature describes how to recognize a technology in a response.
+// Every pattern is a regular expression, an empty header pattern only checks presence.
+type TechSignature struct {
+	Name     string            `json:"name"`
+	Category string            `json:"category"`
+	Headers  map[string]string `json:"headers,omitempty"`
+	Cookies  []string          `json:"cookies,omitempty"`
+	Meta     string            `json:"meta,omitempty"`
+	Scripts  []string          `json:"scripts,omitempty"`
+	Body     []string          `json:"body,omitempty"`
+
+	headers map[string]*regexp.Regexp
+	cookies []*regexp.Regexp
+	meta    *regexp.Regexp
+	scripts []*regexp.Regexp
+	body    []*regexp.Regexp
+}
+
+// builtinSignatures are the compiled built-in signatures, they are not modified
+var builtinSignatures []*TechSignature
+
+var metaGeneratorRe = regexp.MustCompile(`(?is)<meta\b[^>]*\bname\s*=\s*["']?generator["']?[^>]*>`)
+var metaContentRe = regexp.MustCompile(`(?is)\bcontent\s*=\s*(?:"([^"]*)"|'([^']*)')`)
+var scriptSrcRe = regexp.MustCompile(`(?is)<script\b[^>]*\bsrc\s*=\s*(?:"([^"]*)"|'([^']*)'|([^\s>]+))`)
+
+func init() {
+	sigs, err := ParseTechSignatures(builtinTechSignatures)
+	if err != nil {
+		panic("invalid built-in technology signatures: " + err.Error())
+	}
+	builtinSignatures = sigs
+}
+
+// ParseTechSignatures parses and compiles a JSON signature database
+func ParseTechSignatures(data []byte) ([]*TechSignature, error) {
+	var sigs []*TechSignature
+	if err := json.Unmarshal(data, &sigs); err != nil {
+		return nil, err
+	}
+
+	for _, sig := range sigs {
+		if err := sig.compile(); err != nil {
+			return nil, fmt.Errorf("%s: %v", sig.Name, err)
+		}
+	}
+	return sigs, nil
+}
+
+// LoadTechSignatures loads a signature database file and returns it merged
+// with the built-in signatures. Entries with the name of a built-in signature
+// replace it, new names are added to the database.
+func LoadTechSignatures(path string) ([]*TechSignature, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	sigs, err := ParseTechSignatures(data)
+	if err != nil {
+		return nil, err
+	}
+
+	merged := append([]*TechSignature(nil), builtinSignatures...)
+	index := map[string]int{}
+	for i, sig := range merged {
+		index[strings.ToLower(sig.Name)] = i
+	}
+	for _, sig := range sigs {
+		if i, ok := index[strings.ToLower(sig.Name)]; ok {
+			merged[i] = sig
+		} else {
+			merged = append(merged, sig)
+		}
+	}
+	return merged, nil
+}
+
+// DetectTechnologies returns the sorted names of the technologies of sigs
+// found in the response, the built-in signatures are used when sigs is nil
+func DetectTechnologies(resp *HTTPResponse, sigs []*TechSignature) []string {
+	if resp == nil {
+		return nil
+	}
+
+	body := string(resp.Body)
+	cookies := cookieNames(resp.Header.Values("Set-Cookie"))
+	generator := metaGenerator(body)
+	scripts := scriptSources(body)
+
+	if sigs == nil {
+		sigs = builtinSignatures
+	}
+
+	var found []string
+	for _, sig := range sigs {
+		if sig.matches(resp.Header, cookies, generator, scripts, body) {
+			found = append(found, sig.Name)
+		}
+	}
+	sort.Strings(found)
+	return found
+}
+
+// MatchesTechFilter reports whether any of the technologies is in the filter (case-insensitive).
+// An empty filter matches everything.
+func MatchesTechFilter(technologies []string, filter []string) bool {
+	if len(filter) == 0 {
+		return true
+	}
+	for _, tech := range technologies {
+		for _, f := range filter {
+			if strings.EqualFold(tech, strings.TrimSpace(f)) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (sig *TechSignature) compile() error {
+	var err error
+
+	sig.headers = map[string]*regexp.Regexp{}
+	for name, pattern := range sig.Headers {
+		if sig.headers[name], err = regexp.Compile(pattern); err != nil {
+			return err
+		}
+	}
+	for _, pattern := range sig.Cookies {
+		re, err := regexp.Compile("^" + pattern)
+		if err != nil {
+			return err
+		}
+		sig.cookies = append(sig.cookies, re)
+	}
+	if sig.Meta != "" {
+		if sig.meta, err = regexp.Compile(sig.Meta); err != nil {
+			return err
+		}
+	}
+	for _, pattern := range sig.Scripts {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return err
+		}
+		sig.scripts = append(sig.scripts, re)
+	}
+	for _, pattern := range sig.Body {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return err
+		}
+		sig.body = append(sig.body, re)
+	}
+	return nil
+}
+
+func (sig *TechSignature) matches(header http.Header, cookies []string, generator string, scripts []string, body string) bool {
+	for name, re := range sig.headers {
+		if values := header.Values(name); len(values) > 0 {
+			for _, v := range values {
+				if re.MatchString(v) {
+					return true
+				}
+			}
+		}
+	}
+	for _, re := range sig.cookies {
+		for _, c := range cookies {
+			if re.MatchString(c) {
+				return true
+			}
+		}
+	}
+	if sig.meta != nil && generator != "" && sig.meta.MatchString(generator) {
+		return true
+	}
+	for _, re := range sig.scripts {
+		for _, src := range scripts {
+			if re.MatchString(src) {
+				return true
+			}
+		}
+	}
+	for _, re := range sig.body {
+		if re.MatchString(body) {
+			return true
+		}
+	}
+	return false
+}
+
+// metaGenerator returns the content of <meta name="generator">
+func metaGenerator(body string) string {
+	tag := metaGeneratorRe.FindString(body)
+	if tag == "" {
+		return ""
+	}
+	content := metaContentRe.FindStringSubmatch(tag)
+	if len(content) < 3 {
+		return ""
+	}
+	return content[1] + content[2]
+}
+
+// scriptSources returns the src attributes of <script> tags
+func scriptSources(body string) []string {
+	var sources []string
+	for _, match := range scriptSrcRe.FindAllStringSubmatch(body, -1) {
+		sources = append(sources, match[1]+match[2]+match[3])
+	}
+	return sources
+}
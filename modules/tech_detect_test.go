@@ -0,0 +1,119 @@
+package modules
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestBuiltinTechSignatures(t *testing.T) {
+	sigs, err := ParseTechSignatures(builtinTechSignatures)
+	if err != nil {
+		t.Fatalf("Built-in signatures failed to parse: %v", err)
+	}
+	if len(sigs) == 0 {
+		t.Fatal("Built-in signature database is empty")
+	}
+}
+
+func TestDetectTechnologies(t *testing.T) {
+	tests := []struct {
+		name   string
+		header http.Header
+		body   string
+		want   []string
+	}{
+		{
+			name:   "Server header",
+			header: http.Header{"Server": {"nginx/1.24.0"}},
+			want:   []string{"Nginx"},
+		},
+		{
+			name:   "WordPress by generator and scripts",
+			header: http.Header{"Server": {"Apache"}, "X-Powered-By": {"PHP/8.2"}},
+			body:   `<meta name="generator" content="WordPress 6.4"><script src="/wp-includes/js/jquery/jquery.min.js"></script>`,
+			want:   []string{"Apache", "PHP", "WordPress", "jQuery"},
+		},
+		{
+			name:   "Cookie name",
+			header: http.Header{"Set-Cookie": {"laravel_session=abc; path=/"}},
+			want:   []string{"Laravel"},
+		},
+		{
+			name: "Nothing known",
+			body: "<html><title>Plain</title></html>",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			header := tt.header
+			if header == nil {
+				header = http.Header{}
+			}
+			got := DetectTechnologies(&HTTPResponse{Header: header, Body: []byte(tt.body)}, nil)
+			if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("DetectTechnologies() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadTechSignatures(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "signatures.json")
+	data := `[{"name": "Acme Panel", "category": "panel", "body": ["acme-panel-login"]}]`
+	if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	sigs, err := LoadTechSignatures(path)
+	if err != nil {
+		t.Fatalf("LoadTechSignatures failed: %v", err)
+	}
+	if len(sigs) != len(builtinSignatures)+1 {
+		t.Errorf("LoadTechSignatures() returned %d signatures, want the %d built-in ones and the new one", len(sigs), len(builtinSignatures))
+	}
+
+	resp := &HTTPResponse{Header: http.Header{}, Body: []byte(`<div id="acme-panel-login">`)}
+	if got := DetectTechnologies(resp, sigs); len(got) != 1 || got[0] != "Acme Panel" {
+		t.Errorf("DetectTechnologies() = %v, want [Acme Panel]", got)
+	}
+	if got := DetectTechnologies(resp, nil); len(got) != 0 {
+		t.Errorf("Loading changed the built-in signatures, DetectTechnologies() = %v", got)
+	}
+
+	if _, err := LoadTechSignatures(filepath.Join(t.TempDir(), "missing.json")); err == nil {
+		t.Error("Expected error for missing signature file")
+	}
+}
+
+func TestParseTechSignaturesInvalidPattern(t *testing.T) {
+	if _, err := ParseTechSignatures([]byte(`[{"name": "Broken", "body": ["("]}]`)); err == nil {
+		t.Error("Expected error for invalid regular expression")
+	}
+}
+
+func TestMatchesTechFilter(t *testing.T) {
+	tests := []struct {
+		name   string
+		techs  []string
+		filter []string
+		want   bool
+	}{
+		{"Empty filter", []string{"Nginx"}, nil, true},
+		{"Match", []string{"Nginx", "WordPress"}, []string{"wordpress"}, true},
+		{"Match with spaces", []string{"WordPress"}, []string{" WordPress "}, true},
+		{"No match", []string{"Nginx"}, []string{"WordPress"}, false},
+		{"No technologies", nil, []string{"WordPress"}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := MatchesTechFilter(tt.techs, tt.filter); got != tt.want {
+				t.Errorf("MatchesTechFilter(%v, %v) = %v, want %v", tt.techs, tt.filter, got, tt.want)
+			}
+		})
+	}
+}
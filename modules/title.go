@@ -0,0 +1,80 @@
+package modules
+
+import (
+	"bytes"
+	"io"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/charset"
+)
+
+// DecodeBody converts a response body to UTF-8 using the Content-Type header,
+// a byte order mark or a <meta charset> declaration, in that order
+func DecodeBody(body []byte, contentType string) string {
+	if len(body) == 0 {
+		return ""
+	}
+
+	enc, name, _ := charset.DetermineEncoding(body, contentType)
+	if name == "utf-8" || enc == nil {
+		return string(body)
+	}
+
+	decoded, err := io.ReadAll(enc.NewDecoder().Reader(bytes.NewReader(body)))
+	if err != nil {
+		return string(body)
+	}
+	return string(decoded)
+}
+
+// ExtractTitle returns the normalized document title of an HTML body.
+// The boolean is false when the page has no <title> element.
+func ExtractTitle(body []byte, contentType string) (string, bool) {
+	return extractTitle(DecodeBody(body, contentType))
+}
+
+// extractTitle finds the first HTML <title> of a UTF-8 document, skipping titles of
+// embedded SVG and MathML content
+func extractTitle(doc string) (string, bool) {
+	z := html.NewTokenizer(strings.NewReader(doc))
+	foreignDepth := 0
+
+	for {
+		switch z.Next() {
+		case html.ErrorToken:
+			return "", false
+
+		case html.StartTagToken:
+			name, _ := z.TagName()
+			switch string(name) {
+			case "svg", "math":
+				foreignDepth++
+			case "title":
+				if foreignDepth > 0 {
+					continue
+				}
+				return readTitleText(z), true
+			}
+
+		case html.EndTagToken:
+			name, _ := z.TagName()
+			if (string(name) == "svg" || string(name) == "math") && foreignDepth > 0 {
+				foreignDepth--
+			}
+		}
+	}
+}
+
+// readTitleText collects the text up to the closing </title>
+func readTitleText(z *html.Tokenizer) string {
+	var sb strings.Builder
+	for {
+		switch z.Next() {
+		case html.TextToken:
+			sb.Write(z.Text())
+		case html.ErrorToken, html.EndTagToken:
+			return strings.Join(strings.Fields(sb.String()), " ")
+		}
+	}
+}
@@ -0,0 +1,62 @@
+package modules
+
+import "testing"
+
+func TestExtractTitle(t *testing.T) {
+	tests := []struct {
+		name        string
+		body        string
+		contentType string
+		want        string
+		found       bool
+	}{
+		{"Simple", "<html><title>Example</title></html>", "text/html", "Example", true},
+		{"Uppercase tag", "<TITLE>Example</TITLE>", "text/html", "Example", true},
+		{"Attributes", `<title data-x="1" lang="en">Example</title>`, "text/html", "Example", true},
+		{"Entities", "<title>Tom &amp; Jerry &lt;3</title>", "text/html", "Tom & Jerry <3", true},
+		{"Whitespace", "<title>\n   Home |\tSite   </title>", "text/html", "Home | Site", true},
+		{"SVG title skipped", "<svg><title>icon</title></svg><title>Real</title>", "text/html", "Real", true},
+		{"Empty title", "<title></title>", "text/html", "", true},
+		{"No title", "<html><body>Hello</body></html>", "text/html", "", false},
+		{
+			"Windows-1254 from header",
+			"<title>\xddstanbul \xd0\xfc\xfe</title>",
+			"text/html; charset=windows-1254",
+			"İstanbul Ğüş",
+			true,
+		},
+		{
+			"ISO-8859-9 from meta",
+			"<meta http-equiv=\"Content-Type\" content=\"text/html; charset=ISO-8859-9\"><title>Giri\xfe</title>",
+			"text/html",
+			"Giriş",
+			true,
+		},
+		{
+			"Meta charset",
+			"<meta charset=\"windows-1254\"><title>\xc7ark</title>",
+			"",
+			"Çark",
+			true,
+		},
+		{"UTF-8", "<title>Giriş Yap</title>", "text/html; charset=utf-8", "Giriş Yap", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, found := ExtractTitle([]byte(tt.body), tt.contentType)
+			if got != tt.want || found != tt.found {
+				t.Errorf("ExtractTitle() = (%q, %v), want (%q, %v)", got, found, tt.want, tt.found)
+			}
+		})
+	}
+}
+
+func TestDecodeBody(t *testing.T) {
+	if got := DecodeBody([]byte("\xfe"), "text/plain; charset=iso-8859-9"); got != "ş" {
+		t.Errorf("DecodeBody() = %q, want %q", got, "ş")
+	}
+	if got := DecodeBody(nil, "text/html"); got != "" {
+		t.Errorf("DecodeBody(nil) = %q, want empty", got)
+	}
+}
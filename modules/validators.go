@@ -1,8 +1,11 @@
 package modules
 
 import (
+	"fmt"
 	"net"
+	"net/url"
 	"regexp"
+	"strconv"
 	"strings"
 	"unicode"
 )
@@ -137,6 +140,53 @@ func ValidateTimeout(timeout int) int {
 	return timeout
 }
 
+// ValidateTimeoutRange checks a fixed (300) or adaptive (200-3000) timeout
+// whose bounds are within the limits of ValidateTimeout
+func ValidateTimeoutRange(timeout string) error {
+	min, max, err := ParseTimeoutRange(timeout)
+	if err != nil {
+		return err
+	}
+	for _, ms := range []int{min, max} {
+		if ValidateTimeout(ms) != ms {
+			return fmt.Errorf("timeout %dms is out of range, use 100-60000", ms)
+		}
+	}
+	return nil
+}
+
+// ValidateHostname checks that a domain is a bare host name as used by the
+// scan (example.com), without scheme, port or path
+func ValidateHostname(domain string) error {
+	if strings.Contains(domain, "://") || strings.ContainsAny(domain, "/:") {
+		return fmt.Errorf("invalid domain %q, use the host name only (e.g. example.com)", domain)
+	}
+	if !ValidateDomain(domain) {
+		return fmt.Errorf("invalid domain %q, use a host name such as example.com", domain)
+	}
+	return nil
+}
+
+// ValidateFaviconHash checks if the given string is a favicon hash
+// in mmh3 (signed 32-bit integer) or sha256 (64 hex characters) form
+func ValidateFaviconHash(hash string) bool {
+	if _, err := strconv.ParseInt(hash, 10, 32); err == nil {
+		return true
+	}
+
+	matched, _ := regexp.MatchString(`^[0-9a-fA-F]{64}$`, hash)
+	return matched
+}
+
+// ValidateWebhookURL checks if the given string is an absolute http(s) URL
+func ValidateWebhookURL(rawURL string) bool {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return false
+	}
+	return (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
+
 // isAlphanumeric checks if a rune is alphanumeric
 func isAlphanumeric(r rune) bool {
 	return unicode.IsLetter(r) || unicode.IsDigit(r)
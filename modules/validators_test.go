@@ -1,6 +1,7 @@
 package modules
 
 import (
+	"strings"
 	"testing"
 )
 
@@ -129,6 +130,55 @@ func TestSanitizeFilename(t *testing.T) {
 	}
 }
 
+func TestValidateTimeoutRange(t *testing.T) {
+	tests := []struct {
+		input   string
+		wantErr bool
+	}{
+		{"300", false},
+		{"200-3000", false},
+		{"100-60000", false},
+		{"50", true},
+		{"300-90000", true},
+		{"3000-200", true},
+		{"fast", true},
+		{"300-", true},
+		{"-3000", true},
+		{":3000", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			if err := ValidateTimeoutRange(tt.input); (err != nil) != tt.wantErr {
+				t.Errorf("ValidateTimeoutRange(%q) error = %v, wantErr %v", tt.input, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidateHostname(t *testing.T) {
+	tests := []struct {
+		input   string
+		wantErr bool
+	}{
+		{"example.com", false},
+		{"sub.example.co.uk", false},
+		{"https://example.com", true},
+		{"example.com/login", true},
+		{"example.com:8443", true},
+		{"localhost", true},
+		{"-example.com", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			if err := ValidateHostname(tt.input); (err != nil) != tt.wantErr {
+				t.Errorf("ValidateHostname(%q) error = %v, wantErr %v", tt.input, err, tt.wantErr)
+			}
+		})
+	}
+}
+
 func TestValidateWorkerCount(t *testing.T) {
 	tests := []struct {
 		name  string
@@ -152,3 +202,51 @@ func TestValidateWorkerCount(t *testing.T) {
 		})
 	}
 }
+
+func TestValidateFaviconHash(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  bool
+	}{
+		{"Positive mmh3", "116323821", true},
+		{"Negative mmh3", "-1234567890", true},
+		{"SHA256", strings.Repeat("ab", 32), true},
+		{"Out of int32 range", "9999999999", false},
+		{"Short hex", "abcdef", false},
+		{"Empty string", "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := ValidateFaviconHash(tt.input)
+			if got != tt.want {
+				t.Errorf("ValidateFaviconHash(%q) = %v, want %v", tt.input, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateWebhookURL(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  bool
+	}{
+		{"HTTPS", "https://hooks.example.com/ipmap", true},
+		{"HTTP with port", "http://127.0.0.1:8080/hook", true},
+		{"No scheme", "hooks.example.com/ipmap", false},
+		{"Other scheme", "ftp://hooks.example.com", false},
+		{"No host", "https:///hook", false},
+		{"Empty string", "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := ValidateWebhookURL(tt.input)
+			if got != tt.want {
+				t.Errorf("ValidateWebhookURL(%q) = %v, want %v", tt.input, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,278 @@
+package modules
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// DefaultVhostThreshold is the similarity to a catch-all response at which a
+// hostname counts as served by the catch-all
+const DefaultVhostThreshold = 80
+
+// VhostOptions control a virtual host enumeration
+type VhostOptions struct {
+	Timeout   int     // request timeout in ms
+	Workers   int     // concurrent requests
+	Rate      int     // requests per second, 0 for unlimited
+	Retries   int     // retries of timed out requests
+	Threshold int     // similarity (0-100) to the catch-all response at which a hostname is dropped
+	Verbose   bool    // also log the verbose messages
+	Log       LogFunc // receives the log messages, they are dropped when nil
+}
+
+// VhostHit is a hostname an address answers differently from unknown names
+type VhostHit struct {
+	URL        string `json:"url"`
+	Hostname   string `json:"hostname"`
+	Status     int    `json:"status"`
+	Title      string `json:"title"`
+	Length     int    `json:"length"`
+	Similarity int    `json:"similarity"` // to the closest catch-all response
+}
+
+// vhostEndpoint is a scheme and address with its catch-all responses
+type vhostEndpoint struct {
+	url      string
+	defaults []*Fingerprint
+	closed   bool
+}
+
+// LoadHostnames reads the hostnames of a wordlist, one per line. With a
+// domain the lines are subdomain words ("dev" becomes dev.example.com) and
+// the domain itself comes first. Blank lines and # comments are skipped.
+func LoadHostnames(path string, domain string) ([]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var hosts []string
+	seen := map[string]bool{}
+	add := func(host string) {
+		if !seen[host] {
+			seen[host] = true
+			hosts = append(hosts, host)
+		}
+	}
+
+	domain = strings.ToLower(strings.TrimSuffix(domain, "."))
+	if domain != "" {
+		add(domain)
+	}
+
+	scanner := bufio.NewScanner(file)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.ToLower(strings.TrimSpace(scanner.Text()))
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		host := hostnameFor(strings.TrimSuffix(line, "."), domain)
+		if err := ValidateHostname(host); err != nil {
+			return nil, fmt.Errorf("line %d: %v", n, err)
+		}
+		add(host)
+	}
+	return hosts, scanner.Err()
+}
+
+// EnumerateVhosts sends every hostname as Host header and TLS server name to
+// the addresses (ip or ip:port) over HTTPS and HTTP. The response to random
+// names is the catch-all of an address; only hostnames answered differently
+// are returned, in the order of the addresses and hostnames.
+func EnumerateVhosts(ctx context.Context, targets []string, hosts []string, opts VhostOptions) []VhostHit {
+	if opts.Threshold <= 0 {
+		opts.Threshold = DefaultVhostThreshold
+	}
+	engine := NewEngine(EngineSettings{
+		Workers:         opts.Workers,
+		Rate:            opts.Rate,
+		Retries:         opts.Retries,
+		FollowRedirects: true,
+		Verbose:         opts.Verbose,
+		Log:             opts.Log,
+	})
+
+	var endpoints []*vhostEndpoint
+	for _, target := range targets {
+		for _, scheme := range []string{"https://", "http://"} {
+			endpoints = append(endpoints, &vhostEndpoint{url: scheme + target})
+		}
+	}
+
+	// Random names under the parent domains also catch wildcard virtual hosts
+	probes := catchAllNames(hosts)
+	forEach(ctx, len(endpoints), opts.Workers, func(i int) {
+		e := endpoints[i]
+		for _, name := range probes {
+			if resp := engine.doHostRequest(e.url, name, opts.Timeout, opts.Retries); resp != nil {
+				e.defaults = append(e.defaults, vhostFingerprint(resp, name))
+			}
+		}
+		// Servers may refuse unknown names during the TLS handshake, only a
+		// closed port means nothing is served
+		if len(e.defaults) == 0 && !CheckPort(endpointAddr(e.url), opts.Timeout) {
+			e.closed = true
+		}
+		engine.verbose("%s: %d catch-all responses", e.url, len(e.defaults))
+	})
+
+	results := make([]*VhostHit, len(endpoints)*len(hosts))
+	forEach(ctx, len(results), opts.Workers, func(i int) {
+		e, host := endpoints[i/len(hosts)], hosts[i%len(hosts)]
+		if e.closed {
+			return
+		}
+		resp := engine.doHostRequest(e.url, host, opts.Timeout, opts.Retries)
+		if resp == nil {
+			return
+		}
+
+		fp := vhostFingerprint(resp, host)
+		similarity, catchAll := matchCatchAll(e.defaults, fp, opts.Threshold)
+		if catchAll {
+			return
+		}
+		title, _ := ExtractTitle(resp.Body, resp.Header.Get("Content-Type"))
+		engine.verbose("Virtual host %s on %s: %d %s", host, e.url, resp.StatusCode, title)
+		results[i] = &VhostHit{
+			URL:        e.url,
+			Hostname:   host,
+			Status:     resp.StatusCode,
+			Title:      title,
+			Length:     len(resp.Body),
+			Similarity: similarity,
+		}
+	})
+
+	var hits []VhostHit
+	for _, hit := range results {
+		if hit != nil {
+			hits = append(hits, *hit)
+		}
+	}
+	return hits
+}
+
+// matchCatchAll returns the highest similarity of the response to the
+// catch-all responses and whether it is one of them
+func matchCatchAll(defaults []*Fingerprint, fp *Fingerprint, threshold int) (int, bool) {
+	best := 0
+	for _, d := range defaults {
+		if d.StatusCode != fp.StatusCode {
+			continue
+		}
+		// Redirect bodies are mostly empty, the target tells them apart
+		if isRedirect(fp.StatusCode) {
+			if d.RedirectTarget == fp.RedirectTarget {
+				return 100, true
+			}
+			continue
+		}
+		if d.NormalizedHash == fp.NormalizedHash {
+			return 100, true
+		}
+		score, _ := d.Compare(fp)
+		if score > best {
+			best = score
+		}
+	}
+	return best, best >= threshold
+}
+
+// vhostFingerprint fingerprints a response with the requested name masked,
+// catch-all pages and redirects often echo it. A redirect's target is its
+// masked Location.
+func vhostFingerprint(resp *HTTPResponse, host string) *Fingerprint {
+	masked := *resp
+	masked.Body = bytes.ReplaceAll(resp.Body, []byte(host), []byte("{host}"))
+	masked.Header = resp.Header.Clone()
+	location := strings.ReplaceAll(masked.Header.Get("Location"), host, "{host}")
+	if location != "" {
+		masked.Header.Set("Location", location)
+	}
+
+	fp := NewFingerprint(&masked)
+	if isRedirect(resp.StatusCode) {
+		fp.RedirectTarget = location
+	}
+	return fp
+}
+
+func isRedirect(status int) bool {
+	return status >= 300 && status < 400
+}
+
+// catchAllNames returns a random name that no server knows plus a random
+// subdomain of every parent domain of the hostnames
+func catchAllNames(hosts []string) []string {
+	names := []string{randomLabel() + ".invalid"}
+	seen := map[string]bool{}
+	for _, host := range hosts {
+		parent := host
+		if i := strings.Index(host, "."); i >= 0 {
+			parent = host[i+1:]
+		}
+		// Top level domains alone are no wildcard candidates
+		if !strings.Contains(parent, ".") || seen[parent] {
+			continue
+		}
+		seen[parent] = true
+		names = append(names, randomLabel()+"."+parent)
+	}
+	return names
+}
+
+func randomLabel() string {
+	b := make([]byte, 6)
+	_, _ = rand.Read(b)
+	return "ipmap-" + hex.EncodeToString(b)
+}
+
+// endpointAddr returns host:port of an http(s) URL, with the scheme's default port
+func endpointAddr(rawURL string) string {
+	hostport := rawURL[strings.Index(rawURL, "://")+3:]
+	if _, _, err := net.SplitHostPort(hostport); err == nil {
+		return hostport
+	}
+	port := HTTPPort
+	if strings.HasPrefix(rawURL, "https://") {
+		port = HTTPSPort
+	}
+	return net.JoinHostPort(hostport, strconv.Itoa(port))
+}
+
+// forEach calls fn for 0..n-1 on up to workers goroutines until ctx ends
+func forEach(ctx context.Context, n int, workers int, fn func(i int)) {
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < ValidateWorkerCount(workers); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				fn(i)
+			}
+		}()
+	}
+
+feed:
+	for i := 0; i < n; i++ {
+		select {
+		case jobs <- i:
+		case <-ctx.Done():
+			break feed
+		}
+	}
+	close(jobs)
+	wg.Wait()
+}
@@ -0,0 +1,146 @@
+package modules
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestLoadHostnames(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "words.txt")
+	content := "# common names\ndev\n\nAPI\nmail.example.com\ndev\nstaging.example.com.\n"
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		domain string
+		want   []string
+	}{
+		{"example.com", []string{"example.com", "dev.example.com", "api.example.com", "mail.example.com", "staging.example.com"}},
+		{"", nil},
+	}
+
+	for _, tt := range tests {
+		got, err := LoadHostnames(path, tt.domain)
+		if tt.want == nil {
+			// Without a domain the bare words are no hostnames
+			if err == nil || !strings.Contains(err.Error(), "line 2") {
+				t.Errorf("LoadHostnames(%q) error = %v, want a line 2 error", tt.domain, err)
+			}
+			continue
+		}
+		if err != nil || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("LoadHostnames(%q) = %v, %v, want %v", tt.domain, got, err, tt.want)
+		}
+	}
+}
+
+func TestEnumerateVhosts(t *testing.T) {
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host := r.Host
+		switch {
+		// The app is only selected when the handshake named it
+		case host == "app.example.com" && r.TLS.ServerName == host:
+			_, _ = w.Write([]byte("<html><title>App Portal</title><body>Sign in to the internal app portal</body></html>"))
+		case host == "api.example.com":
+			w.Header().Set("Content-Type", "application/json")
+			_, _ = w.Write([]byte(`{"service":"api","version":"1.4.2"}`))
+		case strings.HasSuffix(host, ".wild.example.com"):
+			_, _ = w.Write([]byte("<html><title>Wildcard</title><body>Every name under wild answers here</body></html>"))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = w.Write([]byte("<html><title>Not Found</title><body>No site is configured for " + host + "</body></html>"))
+		}
+	}))
+	defer ts.Close()
+
+	hosts := []string{"www.example.com", "app.example.com", "api.example.com", "a.wild.example.com", "mail.example.com"}
+	target := strings.TrimPrefix(ts.URL, "https://")
+	var mu sync.Mutex
+	var logs []string
+	hits := EnumerateVhosts(context.Background(), []string{target}, hosts, VhostOptions{
+		Timeout: 2000,
+		Workers: 4,
+		Rate:    1000,
+		Verbose: true,
+		Log: func(level LogLevel, msg string) {
+			mu.Lock()
+			defer mu.Unlock()
+			logs = append(logs, msg)
+		},
+	})
+
+	// Plain HTTP on the TLS port is answered with a 400 or a reset, only HTTPS is checked
+	var got []string
+	var https []VhostHit
+	for _, hit := range hits {
+		if strings.HasPrefix(hit.URL, "https://") {
+			got = append(got, hit.URL+" "+hit.Hostname)
+			https = append(https, hit)
+		}
+	}
+	want := []string{ts.URL + " app.example.com", ts.URL + " api.example.com"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("EnumerateVhosts() = %v, want %v", got, want)
+	}
+	if https[0].Status != 200 || https[0].Title != "App Portal" {
+		t.Errorf("App hit = %+v", https[0])
+	}
+	if !strings.Contains(strings.Join(logs, "\n"), "Virtual host app.example.com on "+ts.URL) {
+		t.Errorf("Log did not receive the hits: %v", logs)
+	}
+}
+
+func TestEnumerateVhostsRedirects(t *testing.T) {
+	// A redirect must not be followed away from the probed address
+	elsewhere := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("Redirect to %s was followed", r.Host)
+	}))
+	defer elsewhere.Close()
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Host {
+		case "shop.example.com":
+			http.Redirect(w, r, elsewhere.URL+"/login", http.StatusFound)
+		case "app.example.com":
+			_, _ = w.Write([]byte("<html><title>App</title><body>Internal app</body></html>"))
+		default:
+			// Every other name is sent to HTTPS on itself
+			http.Redirect(w, r, "https://"+r.Host+"/", http.StatusMovedPermanently)
+		}
+	}))
+	defer ts.Close()
+
+	hosts := []string{"www.example.com", "shop.example.com", "app.example.com"}
+	target := strings.TrimPrefix(ts.URL, "http://")
+	hits := EnumerateVhosts(context.Background(), []string{target}, hosts, VhostOptions{Timeout: 2000, Workers: 4})
+
+	var got []string
+	for _, hit := range hits {
+		if strings.HasPrefix(hit.URL, "http://") {
+			got = append(got, fmt.Sprintf("%s %d", hit.Hostname, hit.Status))
+		}
+	}
+	if want := []string{"shop.example.com 302", "app.example.com 200"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("EnumerateVhosts() = %v, want %v", got, want)
+	}
+}
+
+func TestCatchAllNames(t *testing.T) {
+	names := catchAllNames([]string{"example.com", "dev.example.com", "a.b.example.com", "mail.example.com"})
+	var suffixes []string
+	for _, name := range names {
+		suffixes = append(suffixes, name[strings.Index(name, ".")+1:])
+	}
+	if want := []string{"invalid", "example.com", "b.example.com"}; !reflect.DeepEqual(suffixes, want) {
+		t.Errorf("catchAllNames() parents = %v, want %v", suffixes, want)
+	}
+}
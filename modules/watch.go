@@ -0,0 +1,188 @@
+package modules
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// WatchSite is a site seen by a watch run
+type WatchSite struct {
+	Status      string `json:"status"`
+	URL         string `json:"url"`
+	Title       string `json:"title"`
+	Hostname    string `json:"hostname,omitempty"`
+	DomainMatch bool   `json:"domain_match,omitempty"`
+	Score       int    `json:"score,omitempty"`
+}
+
+// WatchRun is the stored outcome of one watch scan
+type WatchRun struct {
+	Time    time.Time   `json:"time"`
+	Key     string      `json:"key"` // watched targets and domain, see WatchKey
+	Domain  string      `json:"domain,omitempty"`
+	Targets []string    `json:"targets"`
+	Scanned int64       `json:"scanned"` // addresses probed
+	Errors  int         `json:"errors"`  // failed requests
+	Sites   []WatchSite `json:"sites"`
+}
+
+// WatchKey identifies the runs of a watch by the targets as given (ASN or
+// IP blocks, in any order) and the domain
+func WatchKey(targets []string, domain string) string {
+	sorted := make([]string, 0, len(targets))
+	for _, target := range targets {
+		sorted = append(sorted, strings.ToUpper(strings.TrimSpace(target)))
+	}
+	sort.Strings(sorted)
+	return strings.Join(sorted, ",") + " " + strings.ToLower(domain)
+}
+
+// Degraded reports whether the run found no site because nothing could be
+// scanned, e.g. while the network was down. Such a run is not a baseline.
+func (r *WatchRun) Degraded() bool {
+	return len(r.Sites) == 0 && (r.Scanned == 0 || int64(r.Errors) >= r.Scanned)
+}
+
+// ChangeType names the differences reported between two watch runs
+type ChangeType string
+
+const (
+	ChangeNew         ChangeType = "new"           // a site that was not seen before
+	ChangeDomainMatch ChangeType = "domain_match"  // a site started serving the watched domain
+	ChangeTitle       ChangeType = "title_changed" // the title of a site changed
+	ChangeGone        ChangeType = "disappeared"   // a site seen before is gone
+)
+
+// WatchChange is a difference between the previous and the latest watch run
+type WatchChange struct {
+	Type          ChangeType `json:"type"`
+	URL           string     `json:"url"`
+	Status        string     `json:"status,omitempty"`
+	Title         string     `json:"title,omitempty"`
+	PreviousTitle string     `json:"previous_title,omitempty"`
+	Hostname      string     `json:"hostname,omitempty"`
+	Score         int        `json:"score,omitempty"`
+}
+
+// DiffRuns returns the changes from prev to cur sorted by URL. A new site
+// serving the watched domain is reported as a domain match only.
+func DiffRuns(prev *WatchRun, cur *WatchRun) []WatchChange {
+	before := map[string]WatchSite{}
+	if prev != nil {
+		for _, site := range prev.Sites {
+			before[site.URL] = site
+		}
+	}
+
+	var changes []WatchChange
+	seen := map[string]bool{}
+	for _, site := range cur.Sites {
+		seen[site.URL] = true
+		change := WatchChange{URL: site.URL, Status: site.Status, Title: site.Title, Hostname: site.Hostname, Score: site.Score}
+
+		old, ok := before[site.URL]
+		switch {
+		case site.DomainMatch && (!ok || !old.DomainMatch):
+			change.Type = ChangeDomainMatch
+		case !ok:
+			change.Type = ChangeNew
+		case old.Title != site.Title:
+			change.Type = ChangeTitle
+			change.PreviousTitle = old.Title
+		default:
+			continue
+		}
+		changes = append(changes, change)
+	}
+
+	for url, site := range before {
+		if !seen[url] {
+			changes = append(changes, WatchChange{Type: ChangeGone, URL: url, Status: site.Status, Title: site.Title, Hostname: site.Hostname})
+		}
+	}
+
+	sort.Slice(changes, func(i, j int) bool {
+		if changes[i].URL != changes[j].URL {
+			return changes[i].URL < changes[j].URL
+		}
+		return changes[i].Type < changes[j].Type
+	})
+	return changes
+}
+
+// String formats a change as a single line
+func (c WatchChange) String() string {
+	switch c.Type {
+	case ChangeTitle:
+		return fmt.Sprintf("[%s] %s: %q -> %q", c.Type, c.URL, c.PreviousTitle, c.Title)
+	case ChangeDomainMatch:
+		return fmt.Sprintf("[%s] %s (score %d): %s", c.Type, c.URL, c.Score, c.Title)
+	}
+	return fmt.Sprintf("[%s] %s: %s", c.Type, c.URL, c.Title)
+}
+
+// WatchStore keeps every watch run as a JSON file in a directory
+type WatchStore struct {
+	dir string
+}
+
+// OpenWatchStore creates the run directory if needed
+func OpenWatchStore(dir string) (*WatchStore, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	return &WatchStore{dir: dir}, nil
+}
+
+// Save stores the run as run-<time>.json and returns its path
+func (s *WatchStore) Save(run *WatchRun) (string, error) {
+	data, err := json.MarshalIndent(run, "", "  ")
+	if err != nil {
+		return "", err
+	}
+
+	path := filepath.Join(s.dir, "run-"+run.Time.UTC().Format("20060102T150405.000000000Z")+".json")
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return "", err
+	}
+	return path, os.Rename(tmp, path)
+}
+
+// Latest returns the most recent stored run of the watch key, nil when there
+// is none. Runs of other targets or domains in the directory are skipped.
+func (s *WatchStore) Latest(key string) (*WatchRun, error) {
+	files, err := filepath.Glob(filepath.Join(s.dir, "run-*.json"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(files)
+
+	for i := len(files) - 1; i >= 0; i-- {
+		data, err := os.ReadFile(files[i])
+		if err != nil {
+			return nil, err
+		}
+		run := &WatchRun{}
+		if err := json.Unmarshal(data, run); err != nil {
+			return nil, fmt.Errorf("%s: %v", files[i], err)
+		}
+		if run.Key == key {
+			return run, nil
+		}
+	}
+	return nil, nil
+}
+
+// NotifyWatchChanges sends the changes of a watch run to the webhooks
+func (n *Notifier) NotifyWatchChanges(domain string, changes []WatchChange) {
+	if len(changes) == 0 {
+		return
+	}
+	n.Notify(WebhookPayload{Event: EventChanges, Domain: domain, Changes: changes})
+}
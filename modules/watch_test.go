@@ -0,0 +1,168 @@
+package modules
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestDiffRuns(t *testing.T) {
+	prev := &WatchRun{Sites: []WatchSite{
+		{Status: "200", URL: "https://1.1.1.1", Title: "Login"},
+		{Status: "200", URL: "https://1.1.1.2", Title: "Example"},
+		{Status: "200", URL: "https://1.1.1.3", Title: "Gone"},
+		{Status: "200", URL: "https://1.1.1.4", Title: "Example", DomainMatch: true, Score: 90},
+	}}
+
+	tests := []struct {
+		name string
+		prev *WatchRun
+		cur  []WatchSite
+		want []WatchChange
+	}{
+		{
+			name: "No changes",
+			prev: prev,
+			cur:  prev.Sites,
+			want: nil,
+		},
+		{
+			name: "New, changed and disappeared sites",
+			prev: prev,
+			cur: []WatchSite{
+				{Status: "200", URL: "https://1.1.1.1", Title: "Dashboard"},
+				{Status: "200", URL: "https://1.1.1.2", Title: "Example"},
+				{Status: "200", URL: "https://1.1.1.4", Title: "Example", DomainMatch: true, Score: 90},
+				{Status: "301", URL: "http://1.1.1.5", Title: "Moved"},
+			},
+			want: []WatchChange{
+				{Type: ChangeNew, URL: "http://1.1.1.5", Status: "301", Title: "Moved"},
+				{Type: ChangeTitle, URL: "https://1.1.1.1", Status: "200", Title: "Dashboard", PreviousTitle: "Login"},
+				{Type: ChangeGone, URL: "https://1.1.1.3", Status: "200", Title: "Gone"},
+			},
+		},
+		{
+			name: "Sites starting to serve the domain",
+			prev: prev,
+			cur: []WatchSite{
+				{Status: "200", URL: "https://1.1.1.1", Title: "Login"},
+				{Status: "200", URL: "https://1.1.1.2", Title: "Example", DomainMatch: true, Score: 88},
+				{Status: "200", URL: "https://1.1.1.3", Title: "Gone"},
+				{Status: "200", URL: "https://1.1.1.4", Title: "Example", DomainMatch: true, Score: 90},
+				{Status: "200", URL: "https://1.1.1.9", Title: "Example", DomainMatch: true, Score: 95},
+			},
+			want: []WatchChange{
+				{Type: ChangeDomainMatch, URL: "https://1.1.1.2", Status: "200", Title: "Example", Score: 88},
+				{Type: ChangeDomainMatch, URL: "https://1.1.1.9", Status: "200", Title: "Example", Score: 95},
+			},
+		},
+		{
+			name: "First run reports every site",
+			prev: nil,
+			cur:  []WatchSite{{Status: "200", URL: "https://1.1.1.1", Title: "Login"}},
+			want: []WatchChange{{Type: ChangeNew, URL: "https://1.1.1.1", Status: "200", Title: "Login"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := DiffRuns(tt.prev, &WatchRun{Sites: tt.cur})
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("DiffRuns() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWatchChangeString(t *testing.T) {
+	tests := []struct {
+		change WatchChange
+		want   string
+	}{
+		{WatchChange{Type: ChangeNew, URL: "https://1.1.1.1", Title: "Login"}, "[new] https://1.1.1.1: Login"},
+		{WatchChange{Type: ChangeTitle, URL: "https://1.1.1.1", Title: "B", PreviousTitle: "A"}, `[title_changed] https://1.1.1.1: "A" -> "B"`},
+		{WatchChange{Type: ChangeDomainMatch, URL: "https://1.1.1.1", Title: "Example", Score: 91}, "[domain_match] https://1.1.1.1 (score 91): Example"},
+	}
+
+	for _, tt := range tests {
+		if got := tt.change.String(); got != tt.want {
+			t.Errorf("String() = %q, want %q", got, tt.want)
+		}
+	}
+}
+
+func TestWatchStore(t *testing.T) {
+	store, err := OpenWatchStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	key := WatchKey([]string{"1.1.1.0/24"}, "example.com")
+	if run, err := store.Latest(key); err != nil || run != nil {
+		t.Fatalf("Empty store returned %v, %v", run, err)
+	}
+
+	start := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	runs := []struct {
+		key   string
+		title string
+	}{
+		{key, "First"},
+		{key, "Second"},
+		{WatchKey([]string{"AS13335"}, "example.com"), "Other targets"},
+	}
+	for i, r := range runs {
+		run := &WatchRun{
+			Time:    start.Add(time.Duration(i) * time.Hour),
+			Key:     r.key,
+			Domain:  "example.com",
+			Targets: []string{"1.1.1.0/24"},
+			Sites:   []WatchSite{{Status: "200", URL: "https://1.1.1.1", Title: r.title}},
+		}
+		if _, err := store.Save(run); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	latest, err := store.Latest(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if latest == nil || latest.Sites[0].Title != "Second" || !latest.Time.Equal(start.Add(time.Hour)) {
+		t.Errorf("Latest() = %+v, want the second run", latest)
+	}
+	if run, err := store.Latest(WatchKey([]string{"1.1.1.0/24"}, "other.com")); err != nil || run != nil {
+		t.Errorf("Latest() of another domain = %+v, %v, want none", run, err)
+	}
+}
+
+func TestWatchKey(t *testing.T) {
+	if WatchKey([]string{"1.1.2.0/24", " 1.1.1.0/24"}, "Example.com") != WatchKey([]string{"1.1.1.0/24", "1.1.2.0/24"}, "example.com") {
+		t.Error("WatchKey() depends on the order of the targets")
+	}
+	if WatchKey([]string{"AS13335"}, "example.com") == WatchKey([]string{"AS13335"}, "") {
+		t.Error("WatchKey() ignores the domain")
+	}
+}
+
+func TestWatchRunDegraded(t *testing.T) {
+	site := []WatchSite{{Status: "200", URL: "https://1.1.1.1", Title: "Login"}}
+	tests := []struct {
+		name string
+		run  WatchRun
+		want bool
+	}{
+		{"Nothing scanned", WatchRun{}, true},
+		{"Only errors", WatchRun{Scanned: 256, Errors: 512}, true},
+		{"No sites without errors", WatchRun{Scanned: 256, Errors: 12}, false},
+		{"Sites despite errors", WatchRun{Scanned: 256, Errors: 512, Sites: site}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.run.Degraded(); got != tt.want {
+				t.Errorf("Degraded() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
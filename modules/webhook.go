@@ -0,0 +1,311 @@
+package modules
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+)
+
+// WebhookEvent names the scan events webhooks are notified of
+type WebhookEvent string
+
+const (
+	EventHit          WebhookEvent = "hit"           // a site was reported
+	EventDomainMatch  WebhookEvent = "domain_match"  // a site matched the searched domain
+	EventScanComplete WebhookEvent = "scan_complete" // the scan finished or stopped at a domain match
+	EventScanFailed   WebhookEvent = "scan_failed"   // the scan could not be run or was interrupted
+	EventChanges      WebhookEvent = "changes"       // ipmap watch found changes since the previous run
+)
+
+// WebhookEvents lists all events in the order they are documented
+var WebhookEvents = []WebhookEvent{EventHit, EventDomainMatch, EventScanComplete, EventScanFailed, EventChanges}
+
+// Headers sent with every webhook request
+const (
+	WebhookEventHeader     = "X-Ipmap-Event"
+	WebhookSignatureHeader = "X-Ipmap-Signature"
+)
+
+// webhookTimeout bounds a single delivery attempt
+const webhookTimeout = 10 * time.Second
+
+// webhookQueueSize is the number of notifications buffered before new ones are dropped
+const webhookQueueSize = 1000
+
+// Webhook is an endpoint notified with a JSON POST on scan events
+type Webhook struct {
+	URL      string             // endpoint receiving the POST
+	Events   []WebhookEvent     // events to send, all when empty
+	Template *template.Template // request body, the JSON payload when nil
+	Secret   string             // HMAC-SHA256 key of the signature header, unsigned when empty
+	Retries  int                // retries after a failed delivery
+}
+
+// WebhookSite is a reported site in a webhook payload
+type WebhookSite struct {
+	Status   string `json:"status"`
+	URL      string `json:"url"`
+	Title    string `json:"title"`
+	Hostname string `json:"hostname,omitempty"`
+}
+
+// WebhookPayload is the data of a notification. It is sent as JSON or
+// rendered with the webhook template.
+type WebhookPayload struct {
+	Event   WebhookEvent  `json:"event"`
+	Time    time.Time     `json:"time"`
+	Domain  string        `json:"domain,omitempty"`
+	Site    *WebhookSite  `json:"site,omitempty"`
+	Details *SiteDetails  `json:"details,omitempty"`
+	Matched bool          `json:"matched,omitempty"`
+	Summary *ScanSummary  `json:"summary,omitempty"`
+	Changes []WatchChange `json:"changes,omitempty"`
+	Error   string        `json:"error,omitempty"`
+}
+
+// ParseWebhookEvents parses a comma-separated event list, empty means all events
+func ParseWebhookEvents(value string) ([]WebhookEvent, error) {
+	var events []WebhookEvent
+	for _, name := range strings.Split(value, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		known := false
+		for _, event := range WebhookEvents {
+			if WebhookEvent(name) == event {
+				known = true
+				break
+			}
+		}
+		if !known {
+			return nil, fmt.Errorf("unknown webhook event: %s", name)
+		}
+		events = append(events, WebhookEvent(name))
+	}
+	return events, nil
+}
+
+// ParseWebhookTemplate parses a request body template. The payload fields are
+// available as {{.Event}}, {{.Site.URL}} etc., {{json .}} encodes a value as JSON.
+func ParseWebhookTemplate(text string) (*template.Template, error) {
+	return template.New("webhook").Funcs(template.FuncMap{
+		"json": func(v interface{}) (string, error) {
+			data, err := json.Marshal(v)
+			return string(data), err
+		},
+	}).Option("missingkey=zero").Parse(text)
+}
+
+// SignWebhook returns the signature header value of body, "sha256=<hex hmac>"
+func SignWebhook(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// wants reports whether the webhook subscribed to the event
+func (w *Webhook) wants(event WebhookEvent) bool {
+	if len(w.Events) == 0 {
+		return true
+	}
+	for _, e := range w.Events {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
+
+// Body renders the request body of a payload
+func (w *Webhook) Body(payload *WebhookPayload) ([]byte, error) {
+	if w.Template == nil {
+		return json.Marshal(payload)
+	}
+
+	var buf bytes.Buffer
+	if err := w.Template.Execute(&buf, payload); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+type webhookDelivery struct {
+	hook    *Webhook
+	payload *WebhookPayload
+}
+
+// Notifier delivers webhook notifications in the background, in the order
+// they were sent, so a slow endpoint never holds up the scan
+type Notifier struct {
+	hooks  []*Webhook
+	client *http.Client
+	policy RetryPolicy
+	log    LogFunc
+	queue  chan webhookDelivery
+	done   chan struct{}
+
+	mu     sync.Mutex
+	closed bool
+}
+
+// NewNotifier starts a notifier for the webhooks, its failures are passed
+// to log (dropped when nil)
+func NewNotifier(hooks []Webhook, log LogFunc) *Notifier {
+	n := &Notifier{
+		client: &http.Client{Timeout: webhookTimeout},
+		policy: DefaultRetryPolicy(),
+		log:    log,
+		queue:  make(chan webhookDelivery, webhookQueueSize),
+		done:   make(chan struct{}),
+	}
+	for i := range hooks {
+		n.hooks = append(n.hooks, &hooks[i])
+	}
+
+	go func() {
+		defer close(n.done)
+		for d := range n.queue {
+			if err := n.deliver(d.hook, d.payload); err != nil {
+				n.logf(LogWarn, "Webhook %s failed (%s): %v", d.hook.URL, d.payload.Event, err)
+			}
+		}
+	}()
+	return n
+}
+
+// Notify queues the payload for the webhooks subscribed to its event. A nil
+// Notifier drops it.
+func (n *Notifier) Notify(payload WebhookPayload) {
+	if n == nil {
+		return
+	}
+	if payload.Time.IsZero() {
+		payload.Time = time.Now().UTC()
+	}
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.closed {
+		return
+	}
+
+	for _, hook := range n.hooks {
+		if !hook.wants(payload.Event) {
+			continue
+		}
+		select {
+		case n.queue <- webhookDelivery{hook: hook, payload: &payload}:
+		default:
+			n.logf(LogWarn, "Webhook queue full, dropping %s notification", payload.Event)
+		}
+	}
+}
+
+// Close stops accepting notifications and waits up to timeout for the queued
+// ones to be delivered. It reports whether all of them were.
+func (n *Notifier) Close(timeout time.Duration) bool {
+	if n == nil {
+		return true
+	}
+	n.mu.Lock()
+	if !n.closed {
+		n.closed = true
+		close(n.queue)
+	}
+	n.mu.Unlock()
+
+	select {
+	case <-n.done:
+		return true
+	case <-time.After(timeout):
+		return false
+	}
+}
+
+// deliver posts the payload, retrying network errors, 429 and 5xx responses with backoff
+func (n *Notifier) deliver(hook *Webhook, payload *WebhookPayload) error {
+	body, err := hook.Body(payload)
+	if err != nil {
+		return fmt.Errorf("template: %v", err)
+	}
+
+	for attempt := 0; ; attempt++ {
+		delay, err := n.post(hook, payload.Event, body, attempt+1)
+		if err == nil {
+			return nil
+		}
+		if delay < 0 || attempt >= hook.Retries {
+			return err
+		}
+		n.logf(LogVerbose, "Webhook %s attempt %d failed: %v, retrying in %v", hook.URL, attempt+1, err, delay)
+		time.Sleep(delay)
+	}
+}
+
+// post sends one attempt. On failure it returns the delay before the next
+// attempt, or a negative delay when retrying is pointless.
+func (n *Notifier) post(hook *Webhook, event WebhookEvent, body []byte, attempt int) (time.Duration, error) {
+	req, err := http.NewRequest(http.MethodPost, hook.URL, bytes.NewReader(body))
+	if err != nil {
+		return -1, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "ipmap-webhook")
+	req.Header.Set(WebhookEventHeader, string(event))
+	if hook.Secret != "" {
+		req.Header.Set(WebhookSignatureHeader, SignWebhook(hook.Secret, body))
+	}
+
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return n.policy.Backoff(attempt), err
+	}
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024))
+	resp.Body.Close()
+
+	switch {
+	case resp.StatusCode < 300:
+		return 0, nil
+	case resp.StatusCode == http.StatusTooManyRequests, resp.StatusCode >= 500:
+		return n.policy.RetryDelay(attempt, resp.Header), fmt.Errorf("status %d", resp.StatusCode)
+	}
+	return -1, fmt.Errorf("status %d", resp.StatusCode)
+}
+
+func (n *Notifier) logf(level LogLevel, format string, args ...interface{}) {
+	if n.log != nil {
+		n.log(level, fmt.Sprintf(format, args...))
+	}
+}
+
+// notifySite sends the hit event of a reported site, and the domain match event when it matched
+func (n *Notifier) notifySite(domain string, site []string, details SiteDetails) {
+	if n == nil {
+		return
+	}
+	ws := &WebhookSite{}
+	fields := []*string{&ws.Status, &ws.URL, &ws.Title, &ws.Hostname}
+	for i := 0; i < len(site) && i < len(fields); i++ {
+		*fields[i] = site[i]
+	}
+
+	n.Notify(WebhookPayload{Event: EventHit, Domain: domain, Site: ws, Details: &details})
+	if details.DomainMatch {
+		n.Notify(WebhookPayload{Event: EventDomainMatch, Domain: domain, Site: ws, Details: &details})
+	}
+}
+
+// NotifyScanFailed sends the scan failure event
+func (n *Notifier) NotifyScanFailed(domain string, err error) {
+	n.Notify(WebhookPayload{Event: EventScanFailed, Domain: domain, Error: err.Error()})
+}
@@ -0,0 +1,210 @@
+package modules
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// webhookReceiver records the webhook requests of a local listener
+type webhookReceiver struct {
+	mu       sync.Mutex
+	requests []*http.Request
+	bodies   []string
+	statuses []int // status codes answered in turn, 200 afterwards
+}
+
+func newWebhookReceiver(t *testing.T, statuses ...int) (*webhookReceiver, string) {
+	r := &webhookReceiver{statuses: statuses}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		body, _ := io.ReadAll(req.Body)
+
+		r.mu.Lock()
+		r.requests = append(r.requests, req)
+		r.bodies = append(r.bodies, string(body))
+		status := http.StatusOK
+		if len(r.statuses) > 0 {
+			status, r.statuses = r.statuses[0], r.statuses[1:]
+		}
+		r.mu.Unlock()
+
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(server.Close)
+	return r, server.URL
+}
+
+func (r *webhookReceiver) count() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.requests)
+}
+
+// fastNotifier returns a notifier retrying without noticeable delays
+func fastNotifier(hooks ...Webhook) *Notifier {
+	n := NewNotifier(hooks, nil)
+	n.policy = RetryPolicy{BaseDelay: time.Millisecond, MaxDelay: 5 * time.Millisecond, MaxRetryAfter: 5 * time.Millisecond}
+	return n
+}
+
+func TestNotifierDeliversSignedJSON(t *testing.T) {
+	receiver, url := newWebhookReceiver(t)
+
+	n := fastNotifier(Webhook{URL: url, Secret: "s3cret"})
+	n.Notify(WebhookPayload{
+		Event:   EventDomainMatch,
+		Domain:  "example.com",
+		Site:    &WebhookSite{Status: "200", URL: "https://1.1.1.1", Title: "Example"},
+		Details: &SiteDetails{IP: "https://1.1.1.1", Score: 92, DomainMatch: true},
+	})
+	if !n.Close(5 * time.Second) {
+		t.Fatal("Notifications were not delivered in time")
+	}
+
+	if receiver.count() != 1 {
+		t.Fatalf("Receiver got %d requests, want 1", receiver.count())
+	}
+	req, body := receiver.requests[0], receiver.bodies[0]
+
+	if req.Method != http.MethodPost || req.Header.Get("Content-Type") != "application/json" {
+		t.Errorf("Unexpected request %s with content type %q", req.Method, req.Header.Get("Content-Type"))
+	}
+	if got := req.Header.Get(WebhookEventHeader); got != string(EventDomainMatch) {
+		t.Errorf("Event header = %q, want %q", got, EventDomainMatch)
+	}
+	if got, want := req.Header.Get(WebhookSignatureHeader), SignWebhook("s3cret", []byte(body)); got != want {
+		t.Errorf("Signature header = %q, want %q", got, want)
+	}
+
+	var payload WebhookPayload
+	if err := json.Unmarshal([]byte(body), &payload); err != nil {
+		t.Fatalf("Body is not JSON: %v", err)
+	}
+	if payload.Event != EventDomainMatch || payload.Site.URL != "https://1.1.1.1" || payload.Details.Score != 92 || payload.Time.IsZero() {
+		t.Errorf("Unexpected payload %+v", payload)
+	}
+}
+
+func TestNotifierRetries(t *testing.T) {
+	tests := []struct {
+		name     string
+		statuses []int
+		retries  int
+		want     int
+	}{
+		{"Success", nil, 3, 1},
+		{"Server errors are retried", []int{500, 503}, 3, 3},
+		{"Rate limit is retried", []int{429}, 3, 2},
+		{"Retries are bounded", []int{500, 500, 500, 500}, 2, 3},
+		{"Client errors are not retried", []int{400}, 3, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			receiver, url := newWebhookReceiver(t, tt.statuses...)
+
+			n := fastNotifier(Webhook{URL: url, Retries: tt.retries})
+			n.Notify(WebhookPayload{Event: EventScanComplete})
+			n.Close(5 * time.Second)
+
+			if got := receiver.count(); got != tt.want {
+				t.Errorf("Receiver got %d requests, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNotifierEvents(t *testing.T) {
+	receiver, url := newWebhookReceiver(t)
+
+	n := fastNotifier(Webhook{URL: url, Events: []WebhookEvent{EventDomainMatch, EventScanFailed}})
+	for _, event := range WebhookEvents {
+		n.Notify(WebhookPayload{Event: event})
+	}
+	n.Close(5 * time.Second)
+
+	var got []string
+	for _, req := range receiver.requests {
+		got = append(got, req.Header.Get(WebhookEventHeader))
+	}
+	if strings.Join(got, ",") != "domain_match,scan_failed" {
+		t.Errorf("Delivered events = %v, want domain_match and scan_failed in order", got)
+	}
+}
+
+func TestWebhookTemplate(t *testing.T) {
+	tmpl, err := ParseWebhookTemplate(`{"text": {{json (printf "%s found on %s" .Domain .Site.URL)}}}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hook := &Webhook{Template: tmpl}
+	body, err := hook.Body(&WebhookPayload{
+		Event:  EventHit,
+		Domain: `example.com"`,
+		Site:   &WebhookSite{URL: "https://1.1.1.1"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var msg struct{ Text string }
+	if err := json.Unmarshal(body, &msg); err != nil {
+		t.Fatalf("Rendered body %s is not JSON: %v", body, err)
+	}
+	if msg.Text != `example.com" found on https://1.1.1.1` {
+		t.Errorf("Rendered text = %q", msg.Text)
+	}
+
+	if _, err := ParseWebhookTemplate("{{.Event"); err == nil {
+		t.Error("Invalid template should not parse")
+	}
+}
+
+func TestParseWebhookEvents(t *testing.T) {
+	events, err := ParseWebhookEvents(" hit, scan_failed ")
+	if err != nil || len(events) != 2 || events[0] != EventHit || events[1] != EventScanFailed {
+		t.Errorf("ParseWebhookEvents() = %v, %v", events, err)
+	}
+	if events, err := ParseWebhookEvents(""); err != nil || events != nil {
+		t.Errorf("Empty list should mean all events, got %v, %v", events, err)
+	}
+	if _, err := ParseWebhookEvents("hit,found"); err == nil {
+		t.Error("Unknown event should be rejected")
+	}
+}
+
+func TestScanSitesWebhooks(t *testing.T) {
+	receiver, url := newWebhookReceiver(t)
+	n := NewNotifier([]Webhook{{URL: url}}, nil)
+	defer n.Close(5 * time.Second)
+
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("<title>Webhook Target</title>"))
+	}))
+	defer target.Close()
+
+	NewEngine(EngineSettings{Workers: 2, Notifier: n}).ScanSites(context.Background(), []string{strings.TrimPrefix(target.URL, "http://")}, ScanOptions{
+		Domain:  "example.com",
+		Timeout: 2000,
+		Quiet:   true,
+	})
+	n.Close(5 * time.Second)
+
+	var events []string
+	for i, req := range receiver.requests {
+		events = append(events, req.Header.Get(WebhookEventHeader))
+		if !strings.Contains(receiver.bodies[i], `"domain":"example.com"`) {
+			t.Errorf("Payload %s does not name the domain", receiver.bodies[i])
+		}
+	}
+	if strings.Join(events, ",") != "hit,scan_complete" {
+		t.Errorf("Delivered events = %v, want hit and scan_complete", events)
+	}
+}
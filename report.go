@@ -0,0 +1,104 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"ipmap/modules"
+	"os"
+	"strings"
+)
+
+// runReport renders an exported JSON result: ipmap report result.json
+func runReport(cmd *command, args []string) int {
+	fs := newFlagSet(cmd)
+	format := fs.String("format", "text", "output format (text/json)")
+	out := fs.String("o", "", "write the report to this file instead of stdout")
+	if code, ok := parseFlags(fs, args); !ok {
+		return code
+	}
+	if fs.NArg() != 1 || !validFormat(*format) {
+		fs.Usage()
+		return exitUsage
+	}
+
+	data, err := readResult(fs.Arg(0))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitError
+	}
+	return writeReport(data, *format == "json", *out)
+}
+
+// runMerge combines the exported results of sharded scans: ipmap merge -o all.json shard-*.json
+func runMerge(cmd *command, args []string) int {
+	fs := newFlagSet(cmd)
+	format := fs.String("format", "json", "output format (text/json)")
+	out := fs.String("o", "", "write the merged result to this file instead of stdout")
+	if code, ok := parseFlags(fs, args); !ok {
+		return code
+	}
+	if fs.NArg() == 0 || !validFormat(*format) {
+		fs.Usage()
+		return exitUsage
+	}
+
+	// Warnings go to stderr, the merged result may be piped
+	var results []modules.ResultData
+	for _, path := range fs.Args() {
+		data, err := readResult(path)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return exitError
+		}
+		results = append(results, data)
+	}
+
+	merged, err := modules.MergeResults(results...)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Results not merged:", err)
+		return exitError
+	}
+	if missing := modules.MissingShards(merged.Shards); len(missing) > 0 {
+		fmt.Fprintln(os.Stderr, "[WARN] The merged result misses shards "+strings.Join(missing, ","))
+	}
+	return writeReport(merged, *format == "json", *out)
+}
+
+// readResult reads an exported JSON result from a file, or stdin for "-"
+func readResult(path string) (modules.ResultData, error) {
+	var in io.Reader = os.Stdin
+	if path != "-" {
+		file, err := os.Open(path)
+		if err != nil {
+			return modules.ResultData{}, fmt.Errorf("result could not be opened: %v", err)
+		}
+		defer file.Close()
+		in = file
+	}
+
+	var data modules.ResultData
+	if err := json.NewDecoder(in).Decode(&data); err != nil {
+		return modules.ResultData{}, fmt.Errorf("%s is not an ipmap JSON export: %v", path, err)
+	}
+	return data, nil
+}
+
+// writeReport renders a result to the file out, or stdout when out is ""
+func writeReport(data modules.ResultData, isJSON bool, out string) int {
+	report, err := data.Format(isJSON)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Report could not be rendered:", err)
+		return exitError
+	}
+
+	if out == "" {
+		fmt.Println(report)
+		return exitOK
+	}
+	if err := os.WriteFile(out, []byte(report+"\n"), 0o644); err != nil {
+		fmt.Fprintln(os.Stderr, "Report could not be written:", err)
+		return exitError
+	}
+	return exitOK
+}
@@ -0,0 +1,448 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"ipmap/config"
+	"ipmap/modules"
+	"ipmap/scanner"
+	"net"
+	"net/url"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// scanFlags are the flags of the scan command, also accepted without a command
+var (
+	scanFlags = flag.NewFlagSet("scan", flag.ContinueOnError)
+
+	domain      = scanFlags.String("d", "", "domain whose origin is searched (e.g. example.com)")
+	asn         = scanFlags.String("asn", "", "ASN whose IP blocks are scanned (e.g. AS13335)")
+	ip          = scanFlags.String("ip", "", "IP blocks to scan (comma-separated CIDRs)")
+	timeout     = scanFlags.String("t", "", "timeout in ms (300) or adaptive bounds (200-3000), adaptive by default")
+	con         = scanFlags.Bool("c", false, "keep scanning after a domain match")
+	export      = scanFlags.Bool("export", false, "export the result without asking")
+	verbose     = scanFlags.Bool("v", false, "verbose mode")
+	format      = scanFlags.String("format", "text", "output format (text/json)")
+	workers     = scanFlags.Int("workers", 100, "number of concurrent workers (1-1000)")
+	retries     = scanFlags.Int("retries", 2, "retries for timeouts and 429/503 responses (0-10)")
+	preScan     = scanFlags.Bool("prescan", false, "TCP connect check on ports 443/80 before HTTP probing")
+	preScanTime = scanFlags.Int("prescan-timeout", 500, "TCP connect timeout of the pre-scan in ms")
+	configFile  = scanFlags.String("config", "", "JSON settings file (workers, rate, retries), reloaded on SIGHUP")
+	controlFile = scanFlags.String("control-file", "", "pause the scan while this file exists")
+	metricsAddr = scanFlags.String("metrics-addr", "", "serve Prometheus metrics on this address (e.g. 127.0.0.1:9100)")
+	proxy       = scanFlags.String("proxy", "", "proxy URL (http/https/socks5)")
+	rate        = scanFlags.Int("rate", 0, "requests per second (0 = unlimited)")
+	dns         = scanFlags.String("dns", "", "custom DNS servers (comma-separated)")
+	faviconHash = scanFlags.String("favicon-hash", "", "favicon hash to match (mmh3 or sha256)")
+	threshold   = scanFlags.Int("threshold", 75, "similarity score (0-100) to consider a site as the domain")
+	excludeCDN  = scanFlags.Bool("exclude-cdn", false, "ignore CDN/WAF edges when matching the domain")
+	tech        = scanFlags.String("tech", "", "only show sites running these technologies (comma-separated)")
+	techDB      = scanFlags.String("tech-db", "", "technology signature file (JSON) to extend the built-in database")
+	noRedirect  = scanFlags.Bool("no-redirect", false, "do not follow redirects, report them instead")
+	shard       = scanFlags.String("shard", "", "scan only shard i of n of the targets (e.g. 1/4), see ipmap merge")
+	subdomains  = scanFlags.Bool("subdomains", false, "resolve common subdomains of -d first and probe their non-CDN addresses before the targets")
+	subWords    = scanFlags.String("subdomain-words", "", "wordlist of extra subdomains for -subdomains, one per line (implies -subdomains)")
+	requestOpts = addRequestFlags(scanFlags)
+	webhookOpts = addWebhookFlags(scanFlags)
+)
+
+var scanCommand = &command{
+	name:    "scan",
+	summary: "Scan an ASN or IP blocks for websites and find the origin of a domain",
+	details: "Exactly one of -asn and -ip is required.",
+	examples: []example{
+		{"Finding sites by scanning all the IP blocks", "ipmap scan -ip 103.21.244.0/22,103.22.200.0/22"},
+		{"Finding real IP address of site by scanning given IP addresses", "ipmap scan -ip 103.21.244.0/22,103.22.200.0/22 -d example.com"},
+		{"Finding sites by scanning all the IP blocks in the ASN", "ipmap scan -asn AS13335"},
+		{"Finding real IP address of site by scanning all IP blocks in ASN", "ipmap scan -asn AS13335 -d example.com"},
+		{"Using proxy and rate limiting", "ipmap scan -asn AS13335 -proxy http://127.0.0.1:8080 -rate 50"},
+		{"Finding sites serving a known favicon without contacting the domain", "ipmap scan -asn AS13335 -t 300 -favicon-hash -1234567890"},
+		{"Probing custom endpoints with extra headers", `ipmap scan -ip 103.21.244.0/22 -t 300 -path /health,/.well-known/security.txt -H "X-Forwarded-For: 127.0.0.1"`},
+		{"Probing the addresses of origin-revealing subdomains (direct., mail., dev., ...) first", "ipmap scan -asn AS13335 -d example.com -subdomains -dns 1.1.1.1"},
+		{"Splitting a scan over two machines, merged afterwards with ipmap merge", "ipmap scan -asn AS13335 -shard 1/2 -format json --export"},
+		{"Getting notified when the origin of a domain is found", "ipmap scan -asn AS13335 -d example.com -webhook https://hooks.example.com/ipmap -webhook-events domain_match"},
+	},
+	run: runScan,
+}
+
+// headerFlags collects repeated -H "Name: value" flags
+type headerFlags []string
+
+func (h *headerFlags) String() string {
+	return strings.Join(*h, ", ")
+}
+
+func (h *headerFlags) Set(value string) error {
+	*h = append(*h, value)
+	return nil
+}
+
+// requestOptions are the flags shaping the probe requests
+type requestOptions struct {
+	method   *string
+	paths    *string
+	cookies  *string
+	body     *string
+	template *string
+	headers  headerFlags
+}
+
+func addRequestFlags(fs *flag.FlagSet) *requestOptions {
+	o := &requestOptions{
+		method:   fs.String("method", "", "HTTP method of probe requests (default GET)"),
+		paths:    fs.String("path", "", "request paths to probe (comma-separated, default /)"),
+		cookies:  fs.String("cookie", "", "cookies sent with probe requests (name=value; name2=value2)"),
+		body:     fs.String("body", "", "request body sent with probe requests"),
+		template: fs.String("template", "", "request template file (JSON)"),
+	}
+	fs.Var(&o.headers, "H", "extra request header (Name: value), can be repeated")
+	return o
+}
+
+// runScan scans the -asn or -ip targets: ipmap scan -asn AS13335 -d example.com
+func runScan(cmd *command, args []string) int {
+	scanFlags.Usage = func() { printCommandHelp(scanFlags.Output(), cmd, scanFlags) }
+	if code, ok := parseFlags(scanFlags, args); !ok {
+		return code
+	}
+
+	if (*asn != "" && *ip != "") || (*asn == "" && *ip == "") {
+		fmt.Fprintln(os.Stderr, "Use exactly one of -asn and -ip")
+		fmt.Fprintln(os.Stderr, `Run "ipmap help scan" for the flags and examples.`)
+		return exitUsage
+	}
+	if err := validateScanFlags(); err != nil {
+		fmt.Fprintln(os.Stderr, "Invalid parameters:", err)
+		return exitUsage
+	}
+
+	// Set global config
+	config.Verbose = *verbose
+	config.Format = *format
+	config.Workers = *workers
+	config.MaxRetries = *retries
+	config.PreScan = *preScan
+	config.PreScanTimeout = *preScanTime
+	config.ProxyURL = *proxy
+	config.RateLimit = *rate
+	if *dns != "" {
+		config.DNSServers = strings.Split(*dns, ",")
+	}
+	config.FaviconHash = strings.TrimSpace(*faviconHash)
+	config.MatchThreshold = *threshold
+	config.ExcludeEdges = *excludeCDN
+	config.FollowRedirects = !*noRedirect
+	if *tech != "" {
+		config.TechFilter = strings.Split(*tech, ",")
+	}
+
+	// Settings file values apply unless the flag was given explicitly
+	if *configFile != "" {
+		settings, err := config.LoadSettings(*configFile)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Config file could not be loaded:", err)
+			return exitUsage
+		}
+		explicit := map[string]bool{}
+		scanFlags.Visit(func(f *flag.Flag) { explicit[f.Name] = true })
+		if settings.Workers != nil && !explicit["workers"] {
+			config.Workers = *settings.Workers
+		}
+		if settings.Rate != nil && !explicit["rate"] {
+			config.RateLimit = *settings.Rate
+		}
+		if settings.Retries != nil && !explicit["retries"] {
+			config.MaxRetries = *settings.Retries
+		}
+	}
+
+	var sigs []*modules.TechSignature
+	if *techDB != "" {
+		var err error
+		if sigs, err = modules.LoadTechSignatures(*techDB); err != nil {
+			fmt.Fprintln(os.Stderr, "Failed to load technology signatures:", err)
+			return exitUsage
+		}
+	}
+
+	tmpl, err := requestOpts.build()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Invalid request template:", err)
+		return exitUsage
+	}
+
+	var words []string
+	if *subWords != "" {
+		if words, err = modules.LoadHostnames(*subWords, *domain); err != nil {
+			fmt.Fprintf(os.Stderr, "Invalid subdomain wordlist %s: %v\n", *subWords, err)
+			return exitUsage
+		}
+	}
+
+	notifier, err := webhookOpts.notifier()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Webhook configuration error:", err)
+		return exitUsage
+	}
+	defer flushWebhooks(notifier)
+
+	// Every input is checked before the scan touches the network
+	opts := scanOptions(tmpl, words)
+	opts.TechSignatures = sigs
+	opts.Notifier = notifier
+	s, err := scanner.New(opts)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Invalid parameters:", err)
+		return exitUsage
+	}
+
+	if *metricsAddr != "" {
+		if err := modules.StartMetricsServer(*metricsAddr); err != nil {
+			fmt.Fprintln(os.Stderr, "Metrics server could not be started:", err)
+			return exitError
+		}
+	}
+
+	// Setup interrupt handler and runtime controls
+	setupInterruptHandler(s, notifier)
+	setupControlHandler(s)
+	if *controlFile != "" {
+		modules.WatchControlFile(*controlFile, time.Second, s.SetPaused)
+	}
+
+	// Log configuration if verbose
+	if config.Verbose {
+		config.VerboseLog("Configuration - Workers: %d, Retries: %d, Rate Limit: %d/s, Proxy: %s",
+			config.Workers, config.MaxRetries, config.RateLimit, config.ProxyURL)
+		if len(config.DNSServers) > 0 {
+			config.VerboseLog("Custom DNS Servers: %v", config.DNSServers)
+		}
+	}
+
+	result, err := s.Scan(context.Background())
+	switch {
+	case errors.Is(err, scanner.ErrDomainUnresolved):
+		fmt.Println("Domain not resolved. Please check:")
+		fmt.Println("  - Domain is accessible via HTTP/HTTPS")
+		fmt.Println("  - No network/firewall issues")
+		fmt.Println("  - Domain name is correct")
+		return exitError
+	case errors.Is(err, scanner.ErrNoTargets):
+		fmt.Fprintln(os.Stderr, "Nothing to scan:", err)
+		return exitNoResults
+	case err != nil:
+		fmt.Fprintln(os.Stderr, "Scan failed:", err)
+		return exitError
+	}
+
+	modules.PrintReport(result.Report, *export)
+	for _, hit := range result.Hits {
+		// With -c the scan goes on after a match, the hits still tell
+		if hit.Details.DomainMatch {
+			return exitDomainFound
+		}
+	}
+	if len(result.Hits) == 0 {
+		return exitNoResults
+	}
+	return exitOK
+}
+
+// validateScanFlags checks the flags the scanner options do not cover
+func validateScanFlags() error {
+	if scanFlags.NArg() > 0 {
+		return fmt.Errorf("unexpected argument %q, the scan takes flags only", scanFlags.Arg(0))
+	}
+	if *format != "text" && *format != "json" {
+		return fmt.Errorf("invalid format %q, use text or json", *format)
+	}
+	if *workers < 1 || *workers > 1000 {
+		return fmt.Errorf("invalid workers %d, it must be between 1 and 1000", *workers)
+	}
+	if *shard != "" {
+		if _, err := modules.ParseShard(*shard); err != nil {
+			return err
+		}
+	}
+	if (*subdomains || *subWords != "") && *domain == "" {
+		return errors.New("-subdomains needs the domain, add -d example.com")
+	}
+	if *proxy != "" {
+		u, err := url.Parse(*proxy)
+		if err != nil || u.Host == "" || (u.Scheme != "http" && u.Scheme != "https" && u.Scheme != "socks5") {
+			return fmt.Errorf("invalid proxy %q, use http://, https:// or socks5:// with a host", *proxy)
+		}
+	}
+	if *dns != "" {
+		for _, server := range strings.Split(*dns, ",") {
+			host := server
+			if h, _, err := net.SplitHostPort(server); err == nil {
+				host = h
+			}
+			if !modules.ValidateIP(host) || strings.Contains(host, "/") {
+				return fmt.Errorf("invalid DNS server %q, use an IP address (e.g. 1.1.1.1 or 1.1.1.1:53)", server)
+			}
+		}
+	}
+	return nil
+}
+
+// scanOptions builds the scanner options from the flags and the configuration,
+// words are the hostnames of -subdomain-words
+func scanOptions(tmpl *modules.RequestTemplate, words []string) scanner.Options {
+	opts := scanner.DefaultOptions()
+	opts.ASN = *asn
+	if *ip != "" {
+		opts.IPBlocks = strings.Split(*ip, ",")
+	}
+	opts.Domain = *domain
+	opts.Timeout = *timeout
+	opts.Continue = *con
+	opts.Workers = config.Workers
+	opts.Rate = config.RateLimit
+	opts.Retries = config.MaxRetries
+	opts.PreScan = config.PreScan
+	opts.PreScanTimeout = config.PreScanTimeout
+	opts.FaviconHash = config.FaviconHash
+	opts.Threshold = config.MatchThreshold
+	opts.ExcludeCDN = config.ExcludeEdges
+	opts.Tech = config.TechFilter
+	opts.FollowRedirects = config.FollowRedirects
+	opts.Request = tmpl
+	opts.DNSServers = config.DNSServers
+	opts.ProgressBar = true
+	opts.Verbose = config.Verbose
+	opts.OnLog = modules.PrintLog
+	if *shard != "" {
+		opts.Shard, _ = modules.ParseShard(*shard)
+	}
+	opts.Subdomains = *subdomains || *subWords != ""
+	opts.SubdomainWords = words
+
+	opts.OnStart = func(start scanner.Start) {
+		header := ""
+		if *asn != "" {
+			header = "ASN:         " + *asn + "\n"
+		}
+		if *shard != "" {
+			header += "Shard:       " + *shard + "\n"
+		}
+		if start.Priority > 0 {
+			header += "Subdomains:  " + strconv.Itoa(start.Priority) + " origin candidates first\n"
+		}
+		fmt.Println(header +
+			"IP Block:    " + strconv.Itoa(len(start.IPBlocks)) +
+			"\nIP Address:  " + strconv.Itoa(start.Addresses) +
+			"\nStart Time:  " + time.Now().Local().String() +
+			"\nWorkers:     " + strconv.Itoa(config.Workers))
+	}
+	opts.OnHit = func(hit scanner.Hit) {
+		modules.PrintSite(hit.Site(), hit.Details)
+	}
+	return opts
+}
+
+func setupInterruptHandler(s *scanner.Scanner, notifier *modules.Notifier) {
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
+
+	go func() {
+		<-sigChan
+		fmt.Println("\n\n[!] Scan interrupted by user")
+		notifier.NotifyScanFailed(*domain, errors.New("scan interrupted by user"))
+
+		// The scanner keeps the hits found so far
+		if data, ok := s.Report("Search Interrupted"); ok && len(data.FoundedWebsites) > 0 {
+			fmt.Printf("\n[*] Found %d websites before interruption\n", len(data.FoundedWebsites))
+			fmt.Print("\nDo you want to export the results? (Y/n): ")
+
+			var response string
+			_, _ = fmt.Scanln(&response)
+
+			if response == "y" || response == "Y" || response == "" {
+				modules.PrintReport(data, true)
+				fmt.Println("\n[✓] Results exported successfully")
+			} else {
+				fmt.Println("\n[✗] Export canceled")
+			}
+		} else {
+			fmt.Println("\n[!] No results to export")
+		}
+
+		flushWebhooks(notifier)
+		os.Exit(exitInterrupted)
+	}()
+}
+
+// reloadSettings applies the rate and worker settings of the -config file to the running scan
+func reloadSettings(s *scanner.Scanner) {
+	if *configFile == "" {
+		config.WarnLog("No config file to reload, start with -config")
+		return
+	}
+
+	settings, err := config.LoadSettings(*configFile)
+	if err != nil {
+		config.ErrorLog("Config reload failed: %v", err)
+		return
+	}
+
+	workers, rate := s.RuntimeSettings()
+	if settings.Workers != nil {
+		workers = *settings.Workers
+	}
+	if settings.Rate != nil {
+		rate = *settings.Rate
+	}
+	s.SetRuntimeSettings(workers, rate)
+	workers, rate = s.RuntimeSettings()
+	config.InfoLog("Config reloaded: %d workers, rate %d/s", workers, rate)
+}
+
+// build loads the -template file and applies the request flags on top of it
+func (o *requestOptions) build() (*modules.RequestTemplate, error) {
+	tmpl := &modules.RequestTemplate{}
+	if *o.template != "" {
+		loaded, err := modules.LoadRequestTemplate(*o.template)
+		if err != nil {
+			return nil, err
+		}
+		tmpl = loaded
+	}
+
+	flags := &modules.RequestTemplate{Method: *o.method, Body: *o.body}
+	if *o.paths != "" {
+		for _, p := range strings.Split(*o.paths, ",") {
+			if p = strings.TrimSpace(p); p != "" {
+				flags.Paths = append(flags.Paths, p)
+			}
+		}
+	}
+	for _, h := range o.headers {
+		name, value, err := modules.ParseHeader(h)
+		if err != nil {
+			return nil, err
+		}
+		if flags.Headers == nil {
+			flags.Headers = map[string]string{}
+		}
+		flags.Headers[name] = value
+	}
+	if *o.cookies != "" {
+		parsed, err := modules.ParseCookies(*o.cookies)
+		if err != nil {
+			return nil, err
+		}
+		flags.Cookies = parsed
+	}
+
+	tmpl.Merge(flags)
+	return tmpl, tmpl.Validate()
+}
@@ -0,0 +1,585 @@
+// Package scanner runs ipmap scans from Go code.
+//
+//	opts := scanner.DefaultOptions()
+//	opts.ASN = "AS13335"
+//	opts.Domain = "example.com"
+//	opts.OnHit = func(hit scanner.Hit) { fmt.Println(hit.URL, hit.Title) }
+//
+//	s, err := scanner.New(opts)
+//	if err != nil {
+//		return err
+//	}
+//	result, err := s.Scan(ctx)
+//
+// Every scan runs on its own modules.Engine, so scans can run side by side
+// in a process. Nothing is printed to stdout: hits go to OnHit, log messages
+// to OnLog and scan events to the webhooks of Notifier. Only the Prometheus
+// metrics are shared by the process.
+package scanner
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"ipmap/modules"
+	"ipmap/tools"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrDomainUnresolved is returned when the searched domain does not answer
+	ErrDomainUnresolved = errors.New("domain could not be resolved")
+	// ErrNoTargets is returned when the ASN announces no IP blocks
+	ErrNoTargets = errors.New("no IP blocks found")
+)
+
+// Options configure a Scanner. Start from DefaultOptions, the zero value is not valid.
+type Options struct {
+	// Targets, exactly one of them is required
+	ASN       string   // ASN whose announced IP blocks are scanned, e.g. AS13335
+	IPBlocks  []string // IP blocks in CIDR notation
+	Addresses []string // addresses scanned as given, "ip" or "ip:port"
+
+	// Shard limits the scan to a deterministic part of the targets, e.g.
+	// {Index: 2, Count: 4}; the zero value scans every address
+	Shard modules.Shard
+
+	Domain   string    // domain whose origin is searched, "" reports every site
+	Timeout  string    // fixed timeout in ms ("300") or adaptive bounds ("200-3000"), adaptive when ""
+	Continue bool      // keep scanning after a domain match
+	Baseline *Baseline // response of the domain from CaptureBaseline, requested by the scan when nil
+
+	// Subdomains resolves DefaultSubdomainWords and SubdomainWords under the
+	// Domain first; their non-CDN addresses are probed before the targets
+	Subdomains     bool
+	SubdomainWords []string // extra subdomain words or hostnames of the domain
+
+	Workers        int  // concurrent workers (1-1000)
+	Rate           int  // requests per second, 0 for unlimited
+	Retries        int  // retries for timeouts and 429/503 responses (0-10)
+	PreScan        bool // TCP connect check on ports 443/80 before HTTP probing
+	PreScanTimeout int  // TCP connect timeout of the pre-scan in ms
+
+	FaviconHash     string                   // favicon hash (mmh3 or sha256) to match, the domain's when ""
+	Threshold       int                      // similarity score (0-100) to report a domain match
+	ExcludeCDN      bool                     // ignore CDN/WAF edges when matching the domain
+	Tech            []string                 // only report sites running one of these technologies
+	TechSignatures  []*modules.TechSignature // technology signatures (see modules.LoadTechSignatures), the built-in ones when nil
+	FollowRedirects bool                     // follow redirects instead of reporting them
+	Request         *modules.RequestTemplate // probe requests, GET / when nil
+	DNSServers      []string                 // servers of the subdomain lookups ("ip" or "ip:port"), the system ones when empty
+
+	ProgressBar      bool                                     // show the progress bar and live statistics on stderr
+	ProgressInterval time.Duration                            // interval of OnProgress, one second when 0
+	Verbose          bool                                     // also pass the verbose messages to OnLog
+	OnStart          func(start Start)                        // called once the targets are known, before probing
+	OnHit            func(hit Hit)                            // called for every reported site, one at a time
+	OnProgress       func(p *Progress)                        // called with the live statistics while probing
+	OnLog            func(level modules.LogLevel, msg string) // called with the log messages, they are dropped when nil
+	Notifier         *modules.Notifier                        // webhooks notified of the hits and the scan end, none when nil
+}
+
+// DefaultOptions returns the defaults of the ipmap command
+func DefaultOptions() Options {
+	return Options{
+		Workers:         100,
+		Retries:         2,
+		PreScanTimeout:  500,
+		Threshold:       75,
+		FollowRedirects: true,
+	}
+}
+
+// Baseline is the response of the searched domain that the sites are
+// compared with. A scan split over several processes captures it once, so
+// every part compares with the same response.
+type Baseline struct {
+	Title        string               `json:"title"`
+	ResponseTime int                  `json:"response_time_ms"`
+	Fingerprint  *modules.Fingerprint `json:"fingerprint"`
+	Sample       modules.PageSample   `json:"sample"` // compared page, not part of the fingerprint JSON
+}
+
+// Start describes a scan about to probe its targets
+type Start struct {
+	IPBlocks    []string // scanned IP blocks, nil when scanning addresses
+	Addresses   int      // number of addresses to probe
+	DomainTitle string   // title of the searched domain
+	Priority    int      // addresses found through subdomains, probed first
+	Timeout     int      // initial probe timeout in ms
+}
+
+// Hit is a reported site
+type Hit struct {
+	Status   string
+	URL      string
+	Title    string
+	Hostname string
+	Details  modules.SiteDetails
+}
+
+// Site returns the hit in the {status, url, title[, hostname]} form of the reports
+func (h Hit) Site() []string {
+	site := []string{h.Status, h.URL, h.Title}
+	if h.Hostname != "" {
+		site = append(site, h.Hostname)
+	}
+	return site
+}
+
+// Progress is a snapshot of the live scan statistics
+type Progress = modules.ScanSummary
+
+// Result is the outcome of a scan
+type Result struct {
+	Hits    []Hit              // reported sites in the order they were found
+	Matched bool               // the scan stopped at a domain match
+	Report  modules.ResultData // the report printed and exported by the command
+}
+
+// Sites returns the hits in the {status, url, title[, hostname]} form of the reports
+func (r *Result) Sites() [][]string {
+	sites := make([][]string, 0, len(r.Hits))
+	for _, hit := range r.Hits {
+		sites = append(sites, hit.Site())
+	}
+	return sites
+}
+
+// Format renders the report as JSON or text
+func (r *Result) Format(isJSON bool) (string, error) {
+	return r.Report.Format(isJSON)
+}
+
+// Scanner runs scans with fixed options. The worker count, rate limit and
+// pause state can be changed while a scan runs.
+type Scanner struct {
+	opts Options
+
+	mu      sync.Mutex
+	workers int
+	rate    int
+	paused  bool
+	current *run // running or last scan
+}
+
+// run is the state of a scan
+type run struct {
+	engine *modules.Engine
+
+	mu      sync.Mutex
+	title   string
+	timeout int
+	blocks  []string
+	sites   [][]string
+}
+
+// New validates the options and creates a Scanner
+func New(opts Options) (*Scanner, error) {
+	if err := opts.validate(); err != nil {
+		return nil, err
+	}
+	return &Scanner{opts: opts, workers: opts.Workers, rate: opts.Rate}, nil
+}
+
+func (o *Options) validate() error {
+	targets := 0
+	for _, set := range []bool{o.ASN != "", len(o.IPBlocks) > 0, len(o.Addresses) > 0} {
+		if set {
+			targets++
+		}
+	}
+	if targets != 1 {
+		return errors.New("exactly one of ASN, IP blocks and addresses is required")
+	}
+
+	if o.ASN != "" && !modules.ValidateASN(o.ASN) {
+		return fmt.Errorf("invalid ASN %q, use the AS prefix and number (e.g. AS13335)", o.ASN)
+	}
+	if len(o.IPBlocks) > 0 {
+		if _, err := modules.ValidateCIDRList(strings.Join(o.IPBlocks, ",")); err != nil {
+			return fmt.Errorf("invalid IP block: %v, use CIDR notation (e.g. 103.21.244.0/22)", err)
+		}
+	}
+	for _, addr := range o.Addresses {
+		host := addr
+		if h, _, err := net.SplitHostPort(addr); err == nil {
+			host = h
+		}
+		if net.ParseIP(host) == nil {
+			return fmt.Errorf("invalid address %q, use ip or ip:port", addr)
+		}
+	}
+	if err := o.Shard.Validate(); err != nil {
+		return err
+	}
+	if o.Domain != "" {
+		if err := modules.ValidateHostname(o.Domain); err != nil {
+			return err
+		}
+	}
+	if o.Baseline != nil && (o.Domain == "" || o.Baseline.Fingerprint == nil) {
+		return errors.New("a baseline needs the domain and its fingerprint")
+	}
+	if o.Subdomains {
+		if o.Domain == "" {
+			return errors.New("subdomain discovery needs the domain")
+		}
+		for _, name := range modules.SubdomainNames(o.Domain, o.SubdomainWords) {
+			if err := modules.ValidateHostname(name); err != nil {
+				return fmt.Errorf("invalid subdomain word: %v", err)
+			}
+		}
+	}
+
+	if o.Timeout != "" {
+		if err := modules.ValidateTimeoutRange(o.Timeout); err != nil {
+			return fmt.Errorf("invalid timeout: %v", err)
+		}
+	}
+	if o.Workers < 1 || o.Workers > 1000 {
+		return fmt.Errorf("invalid workers %d, it must be between 1 and 1000", o.Workers)
+	}
+	if o.Rate < 0 {
+		return fmt.Errorf("invalid rate %d, it must not be negative", o.Rate)
+	}
+	if o.Retries < 0 || o.Retries > 10 {
+		return fmt.Errorf("invalid retries %d, it must be between 0 and 10", o.Retries)
+	}
+	if o.PreScanTimeout <= 0 {
+		return fmt.Errorf("invalid pre-scan timeout %d, it must be greater than 0", o.PreScanTimeout)
+	}
+	if o.Threshold < 0 || o.Threshold > 100 {
+		return fmt.Errorf("invalid threshold %d, it must be between 0 and 100", o.Threshold)
+	}
+	if o.FaviconHash != "" && !modules.ValidateFaviconHash(o.FaviconHash) {
+		return errors.New("invalid favicon hash, use the mmh3 (e.g. -1234567890) or sha256 form")
+	}
+	if o.Request != nil {
+		if err := o.Request.Validate(); err != nil {
+			return fmt.Errorf("invalid request template: %v", err)
+		}
+	}
+	return nil
+}
+
+// Scan runs the scan. When ctx is cancelled before the scan ends, the sites
+// found so far are returned with the context error.
+func (s *Scanner) Scan(ctx context.Context) (*Result, error) {
+	result, err := s.scan(ctx, s.start())
+	if err != nil && ctx.Err() == nil {
+		s.opts.Notifier.NotifyScanFailed(s.opts.Domain, err)
+	}
+	return result, err
+}
+
+// CaptureBaseline requests the domain of the options like a scan does and
+// returns its response, to be passed to other scans as Options.Baseline
+func (s *Scanner) CaptureBaseline(ctx context.Context) (*Baseline, error) {
+	if s.opts.Domain == "" {
+		return nil, errors.New("a baseline needs the domain")
+	}
+	return captureBaseline(s.opts.engine(s.opts.Workers, s.opts.Rate), s.opts.Domain)
+}
+
+// SetRuntimeSettings changes the worker count and rate limit (0 for
+// unlimited) of the running scan and of the scans started later
+func (s *Scanner) SetRuntimeSettings(workers int, rate int) {
+	s.mu.Lock()
+	s.workers, s.rate = modules.ValidateWorkerCount(workers), rate
+	r := s.current
+	s.mu.Unlock()
+
+	if r != nil {
+		r.engine.SetRuntimeSettings(workers, rate)
+	}
+}
+
+// RuntimeSettings returns the worker count and rate limit in effect
+func (s *Scanner) RuntimeSettings() (workers int, rate int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.current != nil {
+		return s.current.engine.RuntimeSettings()
+	}
+	return s.workers, s.rate
+}
+
+// SetPaused pauses or resumes dispatching. Addresses already being probed are finished.
+func (s *Scanner) SetPaused(paused bool) {
+	s.mu.Lock()
+	s.paused = paused
+	r := s.current
+	s.mu.Unlock()
+
+	if r != nil {
+		r.engine.SetPaused(paused)
+	}
+}
+
+// TogglePause pauses a running scan or resumes a paused one and returns the new state
+func (s *Scanner) TogglePause() bool {
+	s.mu.Lock()
+	paused := !s.paused
+	s.mu.Unlock()
+
+	s.SetPaused(paused)
+	return paused
+}
+
+// Progress returns the live statistics of the running scan, nil before probing
+func (s *Scanner) Progress() *Progress {
+	r := s.run()
+	if r == nil {
+		return nil
+	}
+	if stats := r.engine.ScanStats(); stats != nil {
+		return stats.Summary()
+	}
+	return nil
+}
+
+// PrintStatus writes the state and progress of the running scan and its hits to w
+func (s *Scanner) PrintStatus(w io.Writer) {
+	r := s.run()
+	if r == nil {
+		fmt.Fprintln(w, "\n[STATUS] no scan started")
+		return
+	}
+	r.mu.Lock()
+	sites := append([][]string(nil), r.sites...)
+	r.mu.Unlock()
+	r.engine.PrintStatus(w, sites)
+}
+
+// Report returns the report of the running or last scan with the hits found
+// so far, e.g. to export them when the scan is interrupted. It reports false
+// before a scan started probing.
+func (s *Scanner) Report(method string) (modules.ResultData, bool) {
+	r := s.run()
+	if r == nil {
+		return modules.ResultData{}, false
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.blocks == nil {
+		return modules.ResultData{}, false
+	}
+	return r.engine.NewResultData(method, r.title, r.timeout, r.blocks, append([][]string(nil), r.sites...)), true
+}
+
+// start creates the engine of a new scan with the current runtime settings
+func (s *Scanner) start() *run {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	r := &run{engine: s.opts.engine(s.workers, s.rate)}
+	if s.paused {
+		r.engine.SetPaused(true)
+	}
+	s.current = r
+	return r
+}
+
+func (s *Scanner) run() *run {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.current
+}
+
+// engine creates an engine with the settings of the options
+func (o *Options) engine(workers int, rate int) *modules.Engine {
+	return modules.NewEngine(modules.EngineSettings{
+		Workers:         workers,
+		Rate:            rate,
+		Retries:         o.Retries,
+		PreScan:         o.PreScan,
+		PreScanTimeout:  o.PreScanTimeout,
+		FaviconHash:     o.FaviconHash,
+		Threshold:       o.Threshold,
+		ExcludeEdges:    o.ExcludeCDN,
+		TechFilter:      o.Tech,
+		TechSignatures:  o.TechSignatures,
+		FollowRedirects: o.FollowRedirects,
+		Template:        o.Request,
+		DNSServers:      o.DNSServers,
+		Notifier:        o.Notifier,
+		Verbose:         o.Verbose,
+		Log:             o.OnLog,
+	})
+}
+
+// logf passes a message to OnLog
+func (o *Options) logf(level modules.LogLevel, format string, args ...interface{}) {
+	if o.OnLog != nil && (level != modules.LogVerbose || o.Verbose) {
+		o.OnLog(level, fmt.Sprintf(format, args...))
+	}
+}
+
+// captureBaseline requests the domain and installs its fingerprint in the engine
+func captureBaseline(e *modules.Engine, domain string) (*Baseline, error) {
+	resp := e.GetDomainTitle(domain)
+	if len(resp) == 0 {
+		return nil, fmt.Errorf("%w: %s", ErrDomainUnresolved, domain)
+	}
+	fp := e.DomainBaseline()
+	b := &Baseline{Title: resp[0], Fingerprint: fp, Sample: fp.Sample}
+	b.ResponseTime, _ = strconv.Atoi(resp[1])
+	return b, nil
+}
+
+func (s *Scanner) scan(ctx context.Context, r *run) (*Result, error) {
+	opts := s.opts
+	e := r.engine
+
+	title, domainTime := "", 0
+	if opts.Domain != "" {
+		baseline := opts.Baseline
+		if baseline == nil {
+			var err error
+			if baseline, err = captureBaseline(e, opts.Domain); err != nil {
+				return nil, err
+			}
+		} else {
+			fp := *baseline.Fingerprint
+			fp.Sample = baseline.Sample
+			e.SetDomainBaseline(&fp)
+		}
+		title = baseline.Title
+		// The adaptive timeout starts from the domain response time
+		domainTime = baseline.ResponseTime
+
+		if fp := baseline.Fingerprint; e.FaviconHash() == "" && fp.FaviconMMH3 != "" {
+			e.SetFaviconHash(fp.FaviconMMH3)
+			opts.logf(modules.LogInfo, "Domain favicon hash: %s (sha256: %s)", fp.FaviconMMH3, fp.FaviconSHA256)
+		}
+	}
+
+	timeout, err := e.ConfigureTimeout(opts.Timeout, domainTime)
+	if err != nil {
+		return nil, err
+	}
+
+	blocks, ips, err := opts.targets()
+	if err != nil {
+		return nil, err
+	}
+
+	var subdomains []modules.SubdomainRecord
+	priority := 0
+	if opts.Subdomains {
+		words := append(append([]string(nil), modules.DefaultSubdomainWords...), opts.SubdomainWords...)
+		subdomains = e.DiscoverSubdomains(ctx, opts.Domain, modules.SubdomainNames(opts.Domain, words))
+		origins := opts.Shard.Filter(modules.SubdomainOrigins(subdomains))
+		opts.logf(modules.LogInfo, "Subdomains: %d addresses resolved, %d origin candidates probed first", len(subdomains), len(origins))
+		ips = prioritize(origins, ips)
+		priority = len(origins)
+	}
+	r.mu.Lock()
+	r.title, r.timeout, r.blocks = title, timeout, blocks
+	if r.blocks == nil {
+		r.blocks = ips
+	}
+	r.mu.Unlock()
+	if opts.OnStart != nil {
+		opts.OnStart(Start{IPBlocks: blocks, Addresses: len(ips), DomainTitle: title, Timeout: timeout, Priority: priority})
+	}
+
+	result := &Result{}
+	found, matched := e.ScanSites(ctx, ips, modules.ScanOptions{
+		DomainTitle: title,
+		Domain:      opts.Domain,
+		Continue:    opts.Continue,
+		Timeout:     timeout,
+		Quiet:       !opts.ProgressBar,
+		OnHit: func(site []string, details modules.SiteDetails) {
+			hit := Hit{Details: details}
+			fields := []*string{&hit.Status, &hit.URL, &hit.Title, &hit.Hostname}
+			for i := 0; i < len(site) && i < len(fields); i++ {
+				*fields[i] = site[i]
+			}
+			result.Hits = append(result.Hits, hit)
+			r.mu.Lock()
+			r.sites = append(r.sites, site)
+			r.mu.Unlock()
+			if opts.OnHit != nil {
+				opts.OnHit(hit)
+			}
+		},
+		OnProgress:       opts.OnProgress,
+		ProgressInterval: opts.ProgressInterval,
+	})
+	result.Matched = matched
+
+	method := "Search All ASN/IP"
+	if matched {
+		method = "Search Domain by ASN"
+	}
+	if len(blocks) == 0 {
+		blocks = ips
+	}
+	result.Report = e.NewResultData(method, title, timeout, blocks, found)
+	if shard := opts.Shard.String(); shard != "" {
+		result.Report.Shards = []string{shard}
+	}
+	if len(subdomains) > 0 {
+		details := make([]modules.SiteDetails, 0, len(result.Hits))
+		for _, hit := range result.Hits {
+			details = append(details, hit.Details)
+		}
+		modules.MarkSubdomainEdges(subdomains, details)
+	}
+	result.Report.Subdomains = subdomains
+
+	if ctx.Err() != nil && !matched {
+		return result, ctx.Err()
+	}
+	return result, nil
+}
+
+// targets returns the scanned IP blocks and the addresses to probe
+func (o *Options) targets() ([]string, []string, error) {
+	if len(o.Addresses) > 0 {
+		return nil, o.Shard.Filter(o.Addresses), nil
+	}
+
+	blocks, err := modules.ValidateCIDRList(strings.Join(o.IPBlocks, ","))
+	if err != nil {
+		return nil, nil, err
+	}
+	if o.ASN != "" {
+		if blocks, err = tools.ASNBlocks(o.ASN); err != nil {
+			return nil, nil, fmt.Errorf("IP blocks of %s could not be queried: %w", o.ASN, err)
+		}
+		if len(blocks) == 0 {
+			return nil, nil, fmt.Errorf("%w for %s", ErrNoTargets, o.ASN)
+		}
+	}
+	ips, err := tools.ExpandBlocks(blocks)
+	if err != nil {
+		return nil, nil, err
+	}
+	return blocks, o.Shard.Filter(ips), nil
+}
+
+// prioritize returns the first addresses followed by the others that are not among them
+func prioritize(first []string, ips []string) []string {
+	seen := make(map[string]bool, len(first))
+	result := make([]string, 0, len(first)+len(ips))
+	for _, ip := range first {
+		seen[ip] = true
+		result = append(result, ip)
+	}
+	for _, ip := range ips {
+		if !seen[ip] {
+			result = append(result, ip)
+		}
+	}
+	return result
+}
@@ -0,0 +1,341 @@
+package scanner
+
+import (
+	"context"
+	"errors"
+	"ipmap/config"
+	"ipmap/modules"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// newTarget starts a site answering with the title and returns its address
+func newTarget(t *testing.T, title string, delay time.Duration) string {
+	t.Helper()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(delay)
+		_, _ = w.Write([]byte("<title>" + title + "</title>"))
+	}))
+	t.Cleanup(server.Close)
+	return strings.TrimPrefix(server.URL, "http://")
+}
+
+func TestNewValidatesOptions(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(o *Options)
+		valid  bool
+	}{
+		{"ASN", func(o *Options) { o.ASN = "AS13335" }, true},
+		{"IP blocks", func(o *Options) { o.IPBlocks = []string{"1.1.1.0/24"} }, true},
+		{"Addresses", func(o *Options) { o.Addresses = []string{"1.1.1.1:8080"} }, true},
+		{"No targets", func(o *Options) {}, false},
+		{"Two targets", func(o *Options) { o.ASN, o.IPBlocks = "AS13335", []string{"1.1.1.0/24"} }, false},
+		{"Adaptive timeout", func(o *Options) { o.ASN, o.Timeout = "AS13335", "200-3000" }, true},
+		{"Invalid timeout", func(o *Options) { o.ASN, o.Timeout = "AS13335", "fast" }, false},
+		{"Timeout out of range", func(o *Options) { o.ASN, o.Timeout = "AS13335", "20" }, false},
+		{"ASN without prefix", func(o *Options) { o.ASN = "13335" }, false},
+		{"Invalid IP block", func(o *Options) { o.IPBlocks = []string{"1.1.1.0/24", "1.1.1.0/33"} }, false},
+		{"Invalid address", func(o *Options) { o.Addresses = []string{"example.com:80"} }, false},
+		{"Shard", func(o *Options) { o.ASN, o.Shard = "AS13335", modules.Shard{Index: 2, Count: 4} }, true},
+		{"Shard out of range", func(o *Options) { o.ASN, o.Shard = "AS13335", modules.Shard{Index: 5, Count: 4} }, false},
+		{"Domain with scheme", func(o *Options) { o.ASN, o.Domain = "AS13335", "https://example.com" }, false},
+		{"No workers", func(o *Options) { o.ASN, o.Workers = "AS13335", 0 }, false},
+		{"Too many retries", func(o *Options) { o.ASN, o.Retries = "AS13335", 11 }, false},
+		{"Threshold out of range", func(o *Options) { o.ASN, o.Threshold = "AS13335", 101 }, false},
+		{"Invalid favicon hash", func(o *Options) { o.ASN, o.FaviconHash = "AS13335", "abc" }, false},
+		{"Subdomains", func(o *Options) { o.ASN, o.Domain, o.Subdomains = "AS13335", "example.com", true }, true},
+		{"Subdomains without domain", func(o *Options) { o.ASN, o.Subdomains = "AS13335", true }, false},
+		{"Invalid subdomain word", func(o *Options) {
+			o.ASN, o.Domain, o.Subdomains, o.SubdomainWords = "AS13335", "example.com", true, []string{"dev/admin"}
+		}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := DefaultOptions()
+			tt.modify(&opts)
+			if _, err := New(opts); (err == nil) != tt.valid {
+				t.Errorf("New() error = %v, want valid %v", err, tt.valid)
+			}
+		})
+	}
+}
+
+func TestPrioritize(t *testing.T) {
+	got := prioritize([]string{"10.0.0.9", "192.0.2.1"}, []string{"10.0.0.8", "10.0.0.9", "10.0.0.10"})
+	want := []string{"10.0.0.9", "192.0.2.1", "10.0.0.8", "10.0.0.10"}
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("prioritize() = %v, want %v", got, want)
+	}
+}
+
+func TestScan(t *testing.T) {
+	addr := newTarget(t, "Library Target", 0)
+	workers := config.Workers
+
+	var start Start
+	var hits []Hit
+	opts := DefaultOptions()
+	opts.Addresses = []string{addr}
+	opts.Timeout = "2000"
+	opts.Workers = 7
+	opts.OnStart = func(s Start) { start = s }
+	opts.OnHit = func(hit Hit) { hits = append(hits, hit) }
+
+	s, err := New(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err := s.Scan(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if start.Addresses != 1 || start.Timeout != 2000 {
+		t.Errorf("OnStart got %+v", start)
+	}
+	if len(hits) != 1 || hits[0].Title != "Library Target" || hits[0].URL != "http://"+addr {
+		t.Fatalf("OnHit got %+v", hits)
+	}
+	if len(result.Hits) != 1 || result.Matched {
+		t.Errorf("Result hits %+v, matched %v", result.Hits, result.Matched)
+	}
+	if sites := result.Sites(); len(sites) != 1 || sites[0][2] != "Library Target" {
+		t.Errorf("Sites() = %v", sites)
+	}
+	if result.Report.Summary == nil || result.Report.Summary.Hits != 1 {
+		t.Errorf("Report summary = %+v", result.Report.Summary)
+	}
+
+	text, err := result.Format(false)
+	if err != nil || !strings.Contains(text, "Library Target") || !strings.Contains(text, "Method:        Search All ASN/IP") {
+		t.Errorf("Format() = %s, %v", text, err)
+	}
+
+	if config.Workers != workers {
+		t.Errorf("Scan left config.Workers at %d, want %d", config.Workers, workers)
+	}
+}
+
+func TestScanShards(t *testing.T) {
+	var addrs []string
+	for _, title := range []string{"One", "Two", "Three", "Four", "Five"} {
+		addrs = append(addrs, newTarget(t, title, 0))
+	}
+
+	// The shards split the addresses without overlap
+	seen := map[string]bool{}
+	for i := 1; i <= 2; i++ {
+		opts := DefaultOptions()
+		opts.Addresses = addrs
+		opts.Timeout = "2000"
+		opts.Shard = modules.Shard{Index: i, Count: 2}
+
+		s, err := New(opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		result, err := s.Scan(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(result.Report.Shards) != 1 || result.Report.Shards[0] != opts.Shard.String() {
+			t.Errorf("Report shards = %v", result.Report.Shards)
+		}
+		for _, hit := range result.Hits {
+			if seen[hit.URL] {
+				t.Errorf("%s was scanned by two shards", hit.URL)
+			}
+			seen[hit.URL] = true
+		}
+	}
+	if len(seen) != len(addrs) {
+		t.Errorf("Shards found %d of %d sites", len(seen), len(addrs))
+	}
+}
+
+func TestScanCancelled(t *testing.T) {
+	opts := DefaultOptions()
+	opts.Addresses = []string{newTarget(t, "Cancelled", 0)}
+	opts.Timeout = "2000"
+
+	s, err := New(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	result, err := s.Scan(ctx)
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("Scan() error = %v, want context.Canceled", err)
+	}
+	if result == nil || len(result.Hits) != 0 {
+		t.Errorf("Cancelled scan returned %+v", result)
+	}
+}
+
+func TestScanProgress(t *testing.T) {
+	var calls int32
+	opts := DefaultOptions()
+	opts.Addresses = []string{newTarget(t, "Slow", 200*time.Millisecond)}
+	opts.Timeout = "2000"
+	opts.ProgressInterval = 20 * time.Millisecond
+	opts.OnProgress = func(p *Progress) {
+		if p.Addresses == 1 {
+			atomic.AddInt32(&calls, 1)
+		}
+	}
+
+	s, err := New(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Scan(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if atomic.LoadInt32(&calls) == 0 {
+		t.Error("OnProgress was not called during the scan")
+	}
+}
+
+func TestConcurrentScanners(t *testing.T) {
+	titles := []string{"First Service", "Second Service"}
+
+	var wg sync.WaitGroup
+	results := make([]*Result, len(titles))
+	for i, title := range titles {
+		opts := DefaultOptions()
+		opts.Addresses = []string{newTarget(t, title, 20*time.Millisecond)}
+		opts.Timeout = "2000"
+		opts.Workers = i + 1
+		s, err := New(opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		wg.Add(1)
+		go func(i int, s *Scanner) {
+			defer wg.Done()
+			results[i], _ = s.Scan(context.Background())
+		}(i, s)
+	}
+	wg.Wait()
+
+	// Every scan reports only its own site
+	for i, result := range results {
+		if result == nil || len(result.Report.FoundedWebsites) != 1 || result.Report.FoundedWebsites[0][2] != titles[i] {
+			t.Errorf("Scan %d returned %+v", i, result)
+			continue
+		}
+		for _, details := range result.Report.Details {
+			if details.IP != result.Report.FoundedWebsites[0][1] {
+				t.Errorf("Scan %d report has details of another scan: %+v", i, details)
+			}
+		}
+	}
+}
+
+func TestScanLogs(t *testing.T) {
+	type entry struct {
+		level modules.LogLevel
+		msg   string
+	}
+	tests := []struct {
+		name    string
+		verbose bool
+		want    []string // messages that must be logged
+		hidden  []string // messages that must not be logged
+	}{
+		{"Info", false, []string{"Adaptive timeout: 200-3000ms"}, []string{"Starting scan with 3 concurrent workers"}},
+		{"Verbose", true, []string{"Adaptive timeout: 200-3000ms", "Starting scan with 3 concurrent workers"}, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var mu sync.Mutex
+			var logs []entry
+			opts := DefaultOptions()
+			opts.Addresses = []string{newTarget(t, "Logged", 0)}
+			opts.Timeout = "200-3000"
+			opts.Workers = 3
+			opts.Verbose = tt.verbose
+			opts.OnLog = func(level modules.LogLevel, msg string) {
+				mu.Lock()
+				defer mu.Unlock()
+				logs = append(logs, entry{level, msg})
+			}
+
+			s, err := New(opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := s.Scan(context.Background()); err != nil {
+				t.Fatal(err)
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			logged := func(prefix string) bool {
+				for _, e := range logs {
+					if strings.HasPrefix(e.msg, prefix) {
+						return true
+					}
+				}
+				return false
+			}
+			for _, msg := range tt.want {
+				if !logged(msg) {
+					t.Errorf("%q was not logged, got %+v", msg, logs)
+				}
+			}
+			for _, msg := range tt.hidden {
+				if logged(msg) {
+					t.Errorf("%q was logged without Verbose", msg)
+				}
+			}
+		})
+	}
+}
+
+func TestRuntimeSettings(t *testing.T) {
+	opts := DefaultOptions()
+	opts.Addresses = []string{newTarget(t, "Controlled", 0)}
+	opts.Timeout = "2000"
+	opts.Workers = 4
+	opts.Rate = 10
+
+	s, err := New(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if workers, rate := s.RuntimeSettings(); workers != 4 || rate != 10 {
+		t.Errorf("RuntimeSettings() = %d, %d, want 4, 10", workers, rate)
+	}
+	if _, ok := s.Report("Search Interrupted"); ok {
+		t.Error("Report() before the scan reported a result")
+	}
+
+	s.SetRuntimeSettings(6, 0)
+	if _, err := s.Scan(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if workers, rate := s.RuntimeSettings(); workers != 6 || rate != 0 {
+		t.Errorf("RuntimeSettings() after the scan = %d, %d, want 6, 0", workers, rate)
+	}
+	if !s.TogglePause() || s.TogglePause() {
+		t.Error("TogglePause() did not alternate the pause state")
+	}
+
+	data, ok := s.Report("Search Interrupted")
+	if !ok || data.Method != "Search Interrupted" || len(data.FoundedWebsites) != 1 {
+		t.Errorf("Report() = %+v, %v", data, ok)
+	}
+}
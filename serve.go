@@ -0,0 +1,52 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"ipmap/config"
+	"ipmap/modules"
+	"ipmap/server"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// runServe starts the REST API: ipmap serve [-addr 127.0.0.1:8090] [-data ipmap-jobs]
+func runServe(cmd *command, args []string) int {
+	fs := newFlagSet(cmd)
+	addr := fs.String("addr", "127.0.0.1:8090", "listen address of the API")
+	data := fs.String("data", "ipmap-jobs", "directory the jobs and results are stored in")
+	verbose := fs.Bool("v", false, "verbose mode")
+	workers := fs.Int("workers", 100, "default number of concurrent workers per job")
+	metricsAddr := fs.String("metrics-addr", "", "serve Prometheus metrics on this address")
+	webhooks := addWebhookFlags(fs)
+	if code, ok := parseFlags(fs, args); !ok {
+		return code
+	}
+
+	config.Verbose = *verbose
+	config.Workers = *workers
+
+	if *metricsAddr != "" {
+		if err := modules.StartMetricsServer(*metricsAddr); err != nil {
+			fmt.Fprintln(os.Stderr, "Metrics server could not be started:", err)
+			return exitError
+		}
+	}
+
+	notifier, err := webhooks.notifier()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Webhook configuration error:", err)
+		return exitUsage
+	}
+	defer flushWebhooks(notifier)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if err := server.ListenAndServe(ctx, *addr, *data, notifier); err != nil {
+		fmt.Fprintln(os.Stderr, "Server error:", err)
+		return exitError
+	}
+	return exitOK
+}
@@ -0,0 +1,131 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"ipmap/modules"
+	"strings"
+	"time"
+)
+
+// Status is the state of a job
+type Status string
+
+const (
+	StatusQueued    Status = "queued"
+	StatusRunning   Status = "running"
+	StatusDone      Status = "done"
+	StatusFailed    Status = "failed"
+	StatusCancelled Status = "cancelled"
+)
+
+// Finished reports whether the job will not change anymore
+func (s Status) Finished() bool {
+	return s == StatusDone || s == StatusFailed || s == StatusCancelled
+}
+
+// ScanRequest describes a scan submitted to the API, with the options of the scan command
+type ScanRequest struct {
+	ASN            string                   `json:"asn,omitempty"`
+	IPBlocks       []string                 `json:"ip_blocks,omitempty"`
+	Domain         string                   `json:"domain,omitempty"`
+	Timeout        string                   `json:"timeout,omitempty"` // "300" or "200-3000", adaptive when empty
+	Continue       bool                     `json:"continue,omitempty"`
+	Workers        int                      `json:"workers,omitempty"`
+	PreScan        bool                     `json:"prescan,omitempty"`
+	Rate           int                      `json:"rate,omitempty"`      // requests per second, 0 for unlimited
+	Retries        *int                     `json:"retries,omitempty"`   // the server default when absent
+	Threshold      int                      `json:"threshold,omitempty"` // the default when 0
+	FaviconHash    string                   `json:"favicon_hash,omitempty"`
+	ExcludeCDN     bool                     `json:"exclude_cdn,omitempty"`
+	Tech           []string                 `json:"tech,omitempty"`
+	NoRedirect     bool                     `json:"no_redirect,omitempty"`
+	Request        *modules.RequestTemplate `json:"request,omitempty"`
+	Subdomains     bool                     `json:"subdomains,omitempty"`
+	SubdomainWords []string                 `json:"subdomain_words,omitempty"` // implies subdomains
+	Shard          string                   `json:"shard,omitempty"`           // "i/n"
+}
+
+// Validate checks the targets and options of the request
+func (r *ScanRequest) Validate() error {
+	if (r.ASN == "") == (len(r.IPBlocks) == 0) {
+		return errors.New("either asn or ip_blocks is required")
+	}
+	if r.ASN != "" && !modules.ValidateASN(r.ASN) {
+		return fmt.Errorf("invalid asn: %q", r.ASN)
+	}
+	if len(r.IPBlocks) > 0 {
+		if _, err := modules.ValidateCIDRList(strings.Join(r.IPBlocks, ",")); err != nil {
+			return fmt.Errorf("invalid ip_blocks: %v", err)
+		}
+	}
+	if r.Domain != "" {
+		if err := modules.ValidateHostname(r.Domain); err != nil {
+			return err
+		}
+	}
+	if r.Timeout != "" {
+		if err := modules.ValidateTimeoutRange(r.Timeout); err != nil {
+			return err
+		}
+	}
+	if r.Workers < 0 || r.Workers > 1000 {
+		return fmt.Errorf("workers must be between 1 and 1000, or 0 for the default, got %d", r.Workers)
+	}
+	if r.Rate < 0 {
+		return fmt.Errorf("rate must be 0 or more, got %d", r.Rate)
+	}
+	if r.Retries != nil && (*r.Retries < 0 || *r.Retries > 10) {
+		return fmt.Errorf("retries must be between 0 and 10, got %d", *r.Retries)
+	}
+	if r.Threshold < 0 || r.Threshold > 100 {
+		return fmt.Errorf("threshold must be between 1 and 100, or 0 for the default, got %d", r.Threshold)
+	}
+	if r.FaviconHash != "" && !modules.ValidateFaviconHash(r.FaviconHash) {
+		return fmt.Errorf("invalid favicon_hash: %q", r.FaviconHash)
+	}
+	for _, tech := range r.Tech {
+		if strings.TrimSpace(tech) == "" {
+			return errors.New("tech must not contain empty names")
+		}
+	}
+	if r.Request != nil {
+		if err := r.Request.Validate(); err != nil {
+			return fmt.Errorf("invalid request: %v", err)
+		}
+	}
+	if (r.Subdomains || len(r.SubdomainWords) > 0) && r.Domain == "" {
+		return errors.New("subdomains needs the domain")
+	}
+	for _, word := range r.SubdomainWords {
+		if err := modules.ValidateHostname(word + "." + r.Domain); err != nil {
+			return fmt.Errorf("invalid subdomain_words entry %q", word)
+		}
+	}
+	if r.Shard != "" {
+		if _, err := modules.ParseShard(r.Shard); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Job is a submitted scan and its progress
+type Job struct {
+	ID       string               `json:"id"`
+	Request  ScanRequest          `json:"request"`
+	Status   Status               `json:"status"`
+	Error    string               `json:"error,omitempty"`
+	Created  time.Time            `json:"created"`
+	Started  *time.Time           `json:"started,omitempty"`
+	Finished *time.Time           `json:"finished,omitempty"`
+	Hits     [][]string           `json:"hits"`
+	Progress *modules.ScanSummary `json:"progress,omitempty"`
+}
+
+// clone returns a copy that can be used without the store lock
+func (j *Job) clone() Job {
+	c := *j
+	c.Hits = append([][]string{}, j.Hits...)
+	return c
+}
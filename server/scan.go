@@ -0,0 +1,89 @@
+package server
+
+import (
+	"context"
+	"ipmap/config"
+	"ipmap/modules"
+	"ipmap/scanner"
+)
+
+// Result is the outcome of a finished scan
+type Result struct {
+	Formats map[string]string    // rendered result per format ("json", "text")
+	Summary *modules.ScanSummary // final scan statistics
+}
+
+// ScanEvents receive the progress of a job's scan
+type ScanEvents struct {
+	OnHit      func(site []string)                // called for every reported site
+	OnProgress func(summary *modules.ScanSummary) // called with the live statistics
+	Notifier   *modules.Notifier                  // webhooks notified of the scan events, none when nil
+}
+
+// ScanFunc runs the scan of a job, passing its hits and statistics to events
+type ScanFunc func(ctx context.Context, req ScanRequest, events ScanEvents) (*Result, error)
+
+// RunScan runs a job with the scanner of the CLI
+func RunScan(ctx context.Context, req ScanRequest, events ScanEvents) (*Result, error) {
+	opts := req.options()
+	opts.OnHit = func(hit scanner.Hit) { events.OnHit(hit.Site()) }
+	opts.OnProgress = events.OnProgress
+	opts.Notifier = events.Notifier
+
+	s, err := scanner.New(opts)
+	if err != nil {
+		return nil, err
+	}
+	result, err := s.Scan(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	out := &Result{Formats: map[string]string{}, Summary: result.Report.Summary}
+	for format := range resultFormats {
+		data, err := result.Format(format == "json")
+		if err != nil {
+			return nil, err
+		}
+		out.Formats[format] = data
+	}
+	return out, nil
+}
+
+// options maps the request onto the scanner options, the server settings
+// fill in what the request leaves out
+func (r *ScanRequest) options() scanner.Options {
+	opts := scanner.DefaultOptions()
+	opts.ASN = r.ASN
+	opts.IPBlocks = r.IPBlocks
+	opts.Domain = r.Domain
+	opts.Timeout = r.Timeout
+	opts.Continue = r.Continue
+	opts.Workers = config.Workers
+	if r.Workers > 0 {
+		opts.Workers = r.Workers
+	}
+	opts.PreScan = config.PreScan || r.PreScan
+	opts.Rate = r.Rate
+	opts.Retries = config.MaxRetries
+	if r.Retries != nil {
+		opts.Retries = *r.Retries
+	}
+	if r.Threshold > 0 {
+		opts.Threshold = r.Threshold
+	}
+	opts.FaviconHash = r.FaviconHash
+	opts.ExcludeCDN = r.ExcludeCDN
+	opts.Tech = r.Tech
+	opts.FollowRedirects = !r.NoRedirect
+	opts.Request = r.Request
+	opts.Subdomains = r.Subdomains || len(r.SubdomainWords) > 0
+	opts.SubdomainWords = r.SubdomainWords
+	if r.Shard != "" {
+		opts.Shard, _ = modules.ParseShard(r.Shard)
+	}
+	opts.DNSServers = config.DNSServers
+	opts.Verbose = config.Verbose
+	opts.OnLog = modules.PrintLog
+	return opts
+}
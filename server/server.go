@@ -0,0 +1,378 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"ipmap/config"
+	"ipmap/modules"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// hitPollInterval is how often a hit stream checks the job for new hits
+const hitPollInterval = 500 * time.Millisecond
+
+// Server exposes the scan engine through a REST API. Submitted jobs are
+// queued and executed one at a time by Run.
+type Server struct {
+	Notifier *modules.Notifier // webhooks notified of the job scans, none when nil
+
+	store *Store
+	scan  ScanFunc
+	wake  chan struct{}
+
+	mu      sync.Mutex
+	running map[string]*runningJob
+}
+
+// runningJob is the cancel handle and live statistics of the job being executed
+type runningJob struct {
+	cancel    context.CancelFunc
+	requested bool                 // cancelled through the API, not by a shutdown
+	progress  *modules.ScanSummary // last statistics of the scan
+}
+
+// New creates a server for the jobs in store
+func New(store *Store) *Server {
+	return &Server{
+		store:   store,
+		scan:    RunScan,
+		wake:    make(chan struct{}, 1),
+		running: map[string]*runningJob{},
+	}
+}
+
+// ListenAndServe serves the API on addr with jobs persisted in dir until ctx
+// is done, notifying the webhooks of notifier (none when nil) of the scans
+func ListenAndServe(ctx context.Context, addr string, dir string, notifier *modules.Notifier) error {
+	store, err := OpenStore(dir)
+	if err != nil {
+		return err
+	}
+
+	srv := New(store)
+	srv.Notifier = notifier
+	go srv.Run(ctx)
+
+	httpServer := &http.Server{Addr: addr, Handler: srv.Handler()}
+	go func() {
+		<-ctx.Done()
+		_ = httpServer.Shutdown(context.Background())
+	}()
+
+	config.InfoLog("API listening on http://%s (jobs in %s)", addr, dir)
+	if err := httpServer.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+// Run executes queued jobs one at a time until ctx is done
+func (s *Server) Run(ctx context.Context) {
+	for {
+		job, ok := s.store.NextQueued()
+		if !ok {
+			select {
+			case <-s.wake:
+				continue
+			case <-ctx.Done():
+				return
+			}
+		}
+		s.runJob(ctx, job)
+		if ctx.Err() != nil {
+			return
+		}
+	}
+}
+
+// notify wakes the runner after a job was queued
+func (s *Server) notify() {
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (s *Server) runJob(ctx context.Context, job Job) {
+	jobCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	handle := &runningJob{cancel: cancel}
+	s.mu.Lock()
+	s.running[job.ID] = handle
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		delete(s.running, job.ID)
+		s.mu.Unlock()
+	}()
+
+	// The job may have been cancelled after it was picked
+	job, err := s.store.Update(job.ID, func(j *Job) {
+		if j.Status == StatusQueued {
+			now := time.Now().UTC()
+			j.Status = StatusRunning
+			j.Started = &now
+		}
+	})
+	if err != nil || job.Status != StatusRunning {
+		return
+	}
+	config.InfoLog("Job %s started", job.ID)
+
+	var result *Result
+	result, err = s.scan(jobCtx, job.Request, ScanEvents{
+		OnHit: func(site []string) {
+			if err := s.store.AddHit(job.ID, site); err != nil {
+				config.ErrorLog("Job %s: %v", job.ID, err)
+			}
+		},
+		OnProgress: func(summary *modules.ScanSummary) {
+			s.mu.Lock()
+			handle.progress = summary
+			s.mu.Unlock()
+		},
+		Notifier: s.Notifier,
+	})
+
+	s.mu.Lock()
+	requested := handle.requested
+	s.mu.Unlock()
+
+	// A shutdown interrupts the job, it is queued again on the next start
+	if ctx.Err() != nil && !requested {
+		_, _ = s.store.Update(job.ID, func(j *Job) {
+			j.Status = StatusQueued
+			j.Started = nil
+			j.Hits = [][]string{}
+		})
+		return
+	}
+
+	if err == nil {
+		for format, data := range result.Formats {
+			if err = s.store.SaveResult(job.ID, format, data); err != nil {
+				break
+			}
+		}
+	}
+
+	_, _ = s.store.Update(job.ID, func(j *Job) {
+		now := time.Now().UTC()
+		j.Finished = &now
+		switch {
+		case requested:
+			j.Status = StatusCancelled
+		case err != nil:
+			j.Status = StatusFailed
+			j.Error = err.Error()
+		default:
+			j.Status = StatusDone
+			j.Progress = result.Summary
+		}
+	})
+	config.InfoLog("Job %s finished", job.ID)
+}
+
+// Handler returns the HTTP handler of the API:
+//
+//	POST /jobs                  submit a scan
+//	GET  /jobs                  list jobs
+//	GET  /jobs/{id}             job status and progress
+//	GET  /jobs/{id}/hits        stream hits as NDJSON (?follow=false for a snapshot)
+//	POST /jobs/{id}/cancel      cancel a job
+//	GET  /jobs/{id}/result      download the result (?format=json|text)
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/jobs", s.handleJobs)
+	mux.HandleFunc("/jobs/", s.handleJob)
+	return mux
+}
+
+func (s *Server) handleJobs(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		writeJSON(w, http.StatusOK, s.store.List())
+	case http.MethodPost:
+		var req ScanRequest
+		decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20))
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(&req); err != nil {
+			writeError(w, http.StatusBadRequest, "invalid request body: "+err.Error())
+			return
+		}
+		if err := req.Validate(); err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		job, err := s.store.Create(req)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		s.notify()
+		w.Header().Set("Location", "/jobs/"+job.ID)
+		writeJSON(w, http.StatusCreated, job)
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
+
+func (s *Server) handleJob(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, "/jobs/"), "/"), "/")
+	id, action := parts[0], ""
+	if len(parts) > 2 {
+		writeError(w, http.StatusNotFound, "not found")
+		return
+	}
+	if len(parts) == 2 {
+		action = parts[1]
+	}
+
+	job, ok := s.store.Get(id)
+	if !ok {
+		writeError(w, http.StatusNotFound, "job not found")
+		return
+	}
+
+	method := http.MethodGet
+	if action == "cancel" {
+		method = http.MethodPost
+	}
+	if r.Method != method {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	switch action {
+	case "":
+		if job.Status == StatusRunning {
+			s.mu.Lock()
+			if handle, ok := s.running[id]; ok {
+				job.Progress = handle.progress
+			}
+			s.mu.Unlock()
+		}
+		writeJSON(w, http.StatusOK, job)
+	case "hits":
+		s.streamHits(w, r, id)
+	case "cancel":
+		s.cancelJob(w, job)
+	case "result":
+		s.serveResult(w, r, job)
+	default:
+		writeError(w, http.StatusNotFound, "not found")
+	}
+}
+
+// streamHits writes the hits of the job as NDJSON, following new hits until the job finishes
+func (s *Server) streamHits(w http.ResponseWriter, r *http.Request, id string) {
+	follow := r.URL.Query().Get("follow") != "false"
+	flusher, _ := w.(http.Flusher)
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.WriteHeader(http.StatusOK)
+
+	encoder := json.NewEncoder(w)
+	sent := 0
+	for {
+		job, _ := s.store.Get(id)
+		for ; sent < len(job.Hits); sent++ {
+			if err := encoder.Encode(job.Hits[sent]); err != nil {
+				return
+			}
+		}
+		if flusher != nil {
+			flusher.Flush()
+		}
+		if !follow || job.Status.Finished() {
+			return
+		}
+
+		select {
+		case <-time.After(hitPollInterval):
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+func (s *Server) cancelJob(w http.ResponseWriter, job Job) {
+	if job.Status.Finished() {
+		writeError(w, http.StatusConflict, fmt.Sprintf("job is already %s", job.Status))
+		return
+	}
+
+	s.mu.Lock()
+	handle, running := s.running[job.ID]
+	if running {
+		handle.requested = true
+		handle.cancel()
+	}
+	s.mu.Unlock()
+
+	if !running {
+		updated, err := s.store.Update(job.ID, func(j *Job) {
+			// The runner may have picked the job up in the meantime
+			if j.Status == StatusQueued {
+				now := time.Now().UTC()
+				j.Status = StatusCancelled
+				j.Finished = &now
+			}
+		})
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		job = updated
+	}
+	writeJSON(w, http.StatusAccepted, job)
+}
+
+func (s *Server) serveResult(w http.ResponseWriter, r *http.Request, job Job) {
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = "json"
+	}
+	path := s.store.ResultPath(job.ID, format)
+	if path == "" {
+		writeError(w, http.StatusBadRequest, "unsupported format, use json or text")
+		return
+	}
+	if job.Status != StatusDone {
+		writeError(w, http.StatusConflict, fmt.Sprintf("job is %s, results are available when it is done", job.Status))
+		return
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	contentType, ext := "application/json", ".json"
+	if format == "text" {
+		contentType, ext = "text/plain; charset=utf-8", ".txt"
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", `attachment; filename="ipmap_`+job.ID+ext+`"`)
+	_, _ = w.Write(data)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	_ = encoder.Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, map[string]string{"error": message})
+}
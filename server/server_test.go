@@ -0,0 +1,301 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"ipmap/config"
+	"ipmap/modules"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newTestServer starts the API with a stubbed scan engine
+func newTestServer(t *testing.T, scan ScanFunc) (*httptest.Server, *Store) {
+	t.Helper()
+
+	store, err := OpenStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := New(store)
+	srv.scan = scan
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go srv.Run(ctx)
+
+	ts := httptest.NewServer(srv.Handler())
+	t.Cleanup(func() {
+		ts.Close()
+		cancel()
+	})
+	return ts, store
+}
+
+func submit(t *testing.T, ts *httptest.Server, body string) (Job, int) {
+	t.Helper()
+
+	resp, err := http.Post(ts.URL+"/jobs", "application/json", strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	var job Job
+	_ = json.NewDecoder(resp.Body).Decode(&job)
+	return job, resp.StatusCode
+}
+
+func waitStatus(t *testing.T, ts *httptest.Server, id string, want Status) Job {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		resp, err := http.Get(ts.URL + "/jobs/" + id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var job Job
+		_ = json.NewDecoder(resp.Body).Decode(&job)
+		resp.Body.Close()
+
+		if job.Status == want {
+			return job
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Job status = %s, want %s", job.Status, want)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+func get(t *testing.T, url string) (string, int) {
+	t.Helper()
+
+	resp, err := http.Get(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	return string(body), resp.StatusCode
+}
+
+func TestSubmitAndRunJob(t *testing.T) {
+	ts, _ := newTestServer(t, func(ctx context.Context, req ScanRequest, events ScanEvents) (*Result, error) {
+		events.OnHit([]string{"200 OK", "https://10.0.0.1", "One"})
+		events.OnHit([]string{"200 OK", "https://10.0.0.2", "Two"})
+		return &Result{Formats: map[string]string{"json": `{"method":"test"}`, "text": "RESULT"}}, nil
+	})
+
+	job, status := submit(t, ts, `{"ip_blocks": ["10.0.0.0/30"], "domain": "example.com"}`)
+	if status != http.StatusCreated || job.Status != StatusQueued {
+		t.Fatalf("Submit = %d %+v", status, job)
+	}
+
+	done := waitStatus(t, ts, job.ID, StatusDone)
+	if len(done.Hits) != 2 || done.Started == nil || done.Finished == nil {
+		t.Errorf("Finished job = %+v", done)
+	}
+
+	hits, _ := get(t, ts.URL+"/jobs/"+job.ID+"/hits")
+	if lines := strings.Split(strings.TrimSpace(hits), "\n"); len(lines) != 2 || !strings.Contains(lines[1], "10.0.0.2") {
+		t.Errorf("Hit stream = %q", hits)
+	}
+
+	if body, code := get(t, ts.URL+"/jobs/"+job.ID+"/result"); code != http.StatusOK || body != `{"method":"test"}` {
+		t.Errorf("JSON result = %d %q", code, body)
+	}
+	if body, code := get(t, ts.URL+"/jobs/"+job.ID+"/result?format=text"); code != http.StatusOK || body != "RESULT" {
+		t.Errorf("Text result = %d %q", code, body)
+	}
+	if _, code := get(t, ts.URL+"/jobs/"+job.ID+"/result?format=xml"); code != http.StatusBadRequest {
+		t.Errorf("Unsupported format status = %d, want 400", code)
+	}
+
+	list, _ := get(t, ts.URL+"/jobs")
+	if !strings.Contains(list, job.ID) {
+		t.Errorf("Job list does not contain %s: %s", job.ID, list)
+	}
+}
+
+func TestSubmitValidation(t *testing.T) {
+	ts, _ := newTestServer(t, nil)
+
+	for _, body := range []string{
+		`{}`,
+		`{"asn": "AS13335", "ip_blocks": ["10.0.0.0/24"]}`,
+		`{"asn": "13335"}`,
+		`{"ip_blocks": ["10.0.0.0/33"]}`,
+		`{"ip_blocks": ["10.0.0.0/24"], "timeout": "fast"}`,
+		`{"ip_blocks": ["10.0.0.0/24"], "rate": -1}`,
+		`{"ip_blocks": ["10.0.0.0/24"], "retries": 11}`,
+		`{"ip_blocks": ["10.0.0.0/24"], "threshold": 101}`,
+		`{"ip_blocks": ["10.0.0.0/24"], "favicon_hash": "abc"}`,
+		`{"ip_blocks": ["10.0.0.0/24"], "tech": [""]}`,
+		`{"ip_blocks": ["10.0.0.0/24"], "request": {"method": "GET /"}}`,
+		`{"ip_blocks": ["10.0.0.0/24"], "subdomains": true}`,
+		`{"ip_blocks": ["10.0.0.0/24"], "domain": "example.com", "subdomain_words": ["dev/admin"]}`,
+		`{"ip_blocks": ["10.0.0.0/24"], "shard": "5/4"}`,
+		`{"ip_blocks": ["10.0.0.0/24"], "unknown": true}`,
+		`not json`,
+	} {
+		if _, status := submit(t, ts, body); status != http.StatusBadRequest {
+			t.Errorf("Submit(%s) status = %d, want 400", body, status)
+		}
+	}
+
+	if _, code := get(t, ts.URL+"/jobs/missing"); code != http.StatusNotFound {
+		t.Errorf("Unknown job status = %d, want 404", code)
+	}
+}
+
+func TestCancelRunningJob(t *testing.T) {
+	started := make(chan struct{})
+	ts, _ := newTestServer(t, func(ctx context.Context, req ScanRequest, events ScanEvents) (*Result, error) {
+		events.OnHit([]string{"200 OK", "https://10.0.0.1", "One"})
+		close(started)
+		<-ctx.Done()
+		return nil, ctx.Err()
+	})
+
+	job, _ := submit(t, ts, `{"asn": "AS13335"}`)
+	<-started
+
+	resp, err := http.Post(ts.URL+"/jobs/"+job.ID+"/cancel", "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusAccepted {
+		t.Errorf("Cancel status = %d, want 202", resp.StatusCode)
+	}
+
+	cancelled := waitStatus(t, ts, job.ID, StatusCancelled)
+	if len(cancelled.Hits) != 1 {
+		t.Errorf("Hits found before the cancel should be kept, got %v", cancelled.Hits)
+	}
+	if _, code := get(t, ts.URL+"/jobs/"+job.ID+"/result"); code != http.StatusConflict {
+		t.Errorf("Result of a cancelled job status = %d, want 409", code)
+	}
+}
+
+func TestStoreRequeuesRunningJobs(t *testing.T) {
+	dir := t.TempDir()
+	store, err := OpenStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	job, _ := store.Create(ScanRequest{ASN: "AS13335"})
+	_, _ = store.Update(job.ID, func(j *Job) {
+		j.Status = StatusRunning
+		j.Hits = append(j.Hits, []string{"200 OK", "https://10.0.0.1", "One"})
+	})
+	done, _ := store.Create(ScanRequest{ASN: "AS15169"})
+	_, _ = store.Update(done.ID, func(j *Job) { j.Status = StatusDone })
+
+	reopened, err := OpenStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if jobs := reopened.List(); len(jobs) != 2 {
+		t.Fatalf("Reopened store has %d jobs, want 2", len(jobs))
+	}
+
+	requeued, _ := reopened.Get(job.ID)
+	if requeued.Status != StatusQueued || requeued.Hits == nil || len(requeued.Hits) != 0 {
+		t.Errorf("Interrupted job = %+v, want queued without hits", requeued)
+	}
+	if next, ok := reopened.NextQueued(); !ok || next.ID != job.ID {
+		t.Errorf("NextQueued() = %s, want %s", next.ID, job.ID)
+	}
+	if kept, _ := reopened.Get(done.ID); kept.Status != StatusDone {
+		t.Errorf("Finished job status = %s, want done", kept.Status)
+	}
+}
+
+func TestStoreAppendsHits(t *testing.T) {
+	dir := t.TempDir()
+	store, err := OpenStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	job, _ := store.Create(ScanRequest{ASN: "AS13335"})
+	_, _ = store.Update(job.ID, func(j *Job) { j.Status = StatusRunning })
+	before, _ := os.ReadFile(filepath.Join(dir, job.ID+".job.json"))
+	for i := 1; i <= 3; i++ {
+		if err := store.AddHit(job.ID, []string{"200 OK", fmt.Sprintf("https://10.0.0.%d", i), "Site"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Hits leave the job file alone, they go to the NDJSON file
+	if after, _ := os.ReadFile(filepath.Join(dir, job.ID+".job.json")); string(after) != string(before) {
+		t.Errorf("Job file changed with the hits:\n%s", after)
+	}
+	_, _ = store.Update(job.ID, func(j *Job) { j.Status = StatusDone })
+	data, _ := os.ReadFile(filepath.Join(dir, job.ID+".hits.ndjson"))
+	if lines := strings.Count(string(data), "\n"); lines != 3 {
+		t.Errorf("Hits file has %d lines, want 3", lines)
+	}
+
+	// A cut off last line is dropped
+	file, _ := os.OpenFile(filepath.Join(dir, job.ID+".hits.ndjson"), os.O_WRONLY|os.O_APPEND, 0o644)
+	_, _ = file.WriteString(`["200 OK","https://10.0`)
+	file.Close()
+
+	reopened, err := OpenStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, _ := reopened.Get(job.ID)
+	if len(got.Hits) != 3 || got.Hits[2][1] != "https://10.0.0.3" {
+		t.Errorf("Reopened hits = %v, want the 3 hits", got.Hits)
+	}
+}
+
+func TestScanRequestOptions(t *testing.T) {
+	retries := 0
+	req := ScanRequest{
+		IPBlocks:       []string{"10.0.0.0/24"},
+		Domain:         "example.com",
+		Rate:           20,
+		Retries:        &retries,
+		Threshold:      60,
+		FaviconHash:    "-1234567890",
+		ExcludeCDN:     true,
+		Tech:           []string{"nginx"},
+		NoRedirect:     true,
+		Request:        &modules.RequestTemplate{Method: "HEAD"},
+		SubdomainWords: []string{"origin"},
+		Shard:          "2/4",
+	}
+	if err := req.Validate(); err != nil {
+		t.Fatalf("Validate() = %v", err)
+	}
+
+	opts := req.options()
+	if opts.Rate != 20 || opts.Retries != 0 || opts.Threshold != 60 || opts.FaviconHash != "-1234567890" {
+		t.Errorf("options() rate %d, retries %d, threshold %d, favicon %q", opts.Rate, opts.Retries, opts.Threshold, opts.FaviconHash)
+	}
+	if !opts.ExcludeCDN || len(opts.Tech) != 1 || opts.FollowRedirects || opts.Request.Method != "HEAD" {
+		t.Errorf("options() = %+v", opts)
+	}
+	if !opts.Subdomains || len(opts.SubdomainWords) != 1 || opts.Shard != (modules.Shard{Index: 2, Count: 4}) {
+		t.Errorf("options() subdomains %v %v, shard %+v", opts.Subdomains, opts.SubdomainWords, opts.Shard)
+	}
+
+	// Absent settings keep the defaults
+	defaults := (&ScanRequest{ASN: "AS13335"}).options()
+	if defaults.Threshold != 75 || !defaults.FollowRedirects || defaults.Retries != config.MaxRetries {
+		t.Errorf("Default options() = %+v", defaults)
+	}
+}
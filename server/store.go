@@ -0,0 +1,246 @@
+package server
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Result formats stored for every finished job
+var resultFormats = map[string]string{
+	"json": ".result.json",
+	"text": ".result.txt",
+}
+
+// Store keeps the jobs in memory and persists each of them in dir, so they
+// survive a server restart. The job state is a JSON file rewritten on every
+// update, hits are appended to an NDJSON file next to it.
+type Store struct {
+	mu   sync.Mutex
+	dir  string
+	jobs map[string]*Job
+}
+
+// OpenStore loads the jobs persisted in dir. Jobs that were running when the
+// server stopped are queued again and start over.
+func OpenStore(dir string) (*Store, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+
+	s := &Store{dir: dir, jobs: map[string]*Job{}}
+	files, err := filepath.Glob(filepath.Join(dir, "*.job.json"))
+	if err != nil {
+		return nil, err
+	}
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		job := &Job{}
+		if err := json.Unmarshal(data, job); err != nil {
+			return nil, fmt.Errorf("%s: %v", file, err)
+		}
+		if err := s.loadHits(job); err != nil {
+			return nil, err
+		}
+
+		if job.Status == StatusRunning {
+			job.Status = StatusQueued
+			job.Started = nil
+			job.Hits = [][]string{}
+			job.Progress = nil
+			if err := s.save(job); err != nil {
+				return nil, err
+			}
+		}
+		s.jobs[job.ID] = job
+	}
+	return s, nil
+}
+
+// Create adds a queued job for the request
+func (s *Store) Create(req ScanRequest) (Job, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	job := &Job{
+		ID:      newJobID(),
+		Request: req,
+		Status:  StatusQueued,
+		Created: time.Now().UTC(),
+		Hits:    [][]string{},
+	}
+	if err := s.save(job); err != nil {
+		return Job{}, err
+	}
+	s.jobs[job.ID] = job
+	return job.clone(), nil
+}
+
+// Get returns a copy of the job
+func (s *Store) Get(id string) (Job, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	job, ok := s.jobs[id]
+	if !ok {
+		return Job{}, false
+	}
+	return job.clone(), true
+}
+
+// List returns copies of all jobs, oldest first
+func (s *Store) List() []Job {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	jobs := make([]Job, 0, len(s.jobs))
+	for _, job := range s.jobs {
+		jobs = append(jobs, job.clone())
+	}
+	sort.Slice(jobs, func(i, j int) bool {
+		if jobs[i].Created.Equal(jobs[j].Created) {
+			return jobs[i].ID < jobs[j].ID
+		}
+		return jobs[i].Created.Before(jobs[j].Created)
+	})
+	return jobs
+}
+
+// NextQueued returns the oldest queued job
+func (s *Store) NextQueued() (Job, bool) {
+	for _, job := range s.List() {
+		if job.Status == StatusQueued {
+			return job, true
+		}
+	}
+	return Job{}, false
+}
+
+// Update changes the job with fn and persists it
+func (s *Store) Update(id string, fn func(*Job)) (Job, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	job, ok := s.jobs[id]
+	if !ok {
+		return Job{}, fmt.Errorf("job %s not found", id)
+	}
+	fn(job)
+	if err := s.save(job); err != nil {
+		return Job{}, err
+	}
+	return job.clone(), nil
+}
+
+// AddHit appends a hit to the job without rewriting the job file
+func (s *Store) AddHit(id string, site []string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	job, ok := s.jobs[id]
+	if !ok {
+		return fmt.Errorf("job %s not found", id)
+	}
+	line, err := json.Marshal(site)
+	if err != nil {
+		return err
+	}
+	file, err := os.OpenFile(s.hitsPath(id), os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	if _, err := file.Write(append(line, '\n')); err != nil {
+		return err
+	}
+	job.Hits = append(job.Hits, site)
+	return nil
+}
+
+// SaveResult stores the result of a job in the given format
+func (s *Store) SaveResult(id string, format string, data string) error {
+	return writeFile(s.ResultPath(id, format), []byte(data))
+}
+
+// ResultPath returns the file of a job result, "" for an unknown format
+func (s *Store) ResultPath(id string, format string) string {
+	ext, ok := resultFormats[format]
+	if !ok {
+		return ""
+	}
+	return filepath.Join(s.dir, id+ext)
+}
+
+// save writes the job file without the hits, must be called with the lock
+// held. A job without hits also loses its hits file.
+func (s *Store) save(job *Job) error {
+	state := *job
+	state.Hits = nil
+	data, err := json.MarshalIndent(&state, "", "  ")
+	if err != nil {
+		return err
+	}
+	if len(job.Hits) == 0 {
+		if err := os.Remove(s.hitsPath(job.ID)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return writeFile(filepath.Join(s.dir, job.ID+".job.json"), data)
+}
+
+// loadHits reads the hits file of a job. Job files written before the hits
+// had their own file keep the hits they contain.
+func (s *Store) loadHits(job *Job) error {
+	data, err := os.ReadFile(s.hitsPath(job.ID))
+	if os.IsNotExist(err) {
+		if job.Hits == nil {
+			job.Hits = [][]string{}
+		}
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	// A crash can cut the last line short, only complete lines are read
+	lines := strings.Split(string(data), "\n")
+	job.Hits = [][]string{}
+	for n, line := range lines[:len(lines)-1] {
+		var site []string
+		if err := json.Unmarshal([]byte(line), &site); err != nil {
+			return fmt.Errorf("%s line %d: %v", s.hitsPath(job.ID), n+1, err)
+		}
+		job.Hits = append(job.Hits, site)
+	}
+	return nil
+}
+
+func (s *Store) hitsPath(id string) string {
+	return filepath.Join(s.dir, id+".hits.ndjson")
+}
+
+// writeFile replaces path atomically so a crash never leaves a partial file
+func writeFile(path string, data []byte) error {
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// newJobID returns a sortable, unique job ID
+func newJobID() string {
+	b := make([]byte, 4)
+	_, _ = rand.Read(b)
+	return strings.ToLower(time.Now().UTC().Format("20060102T150405")) + "-" + hex.EncodeToString(b)
+}
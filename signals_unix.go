@@ -0,0 +1,31 @@
+//go:build !windows
+
+package main
+
+import (
+	"ipmap/scanner"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// setupControlHandler handles the runtime control signals:
+// SIGUSR1 prints the progress and hits, SIGUSR2 pauses or resumes
+// dispatching and SIGHUP reloads the rate and worker settings
+func setupControlHandler(s *scanner.Scanner) {
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, syscall.SIGUSR1, syscall.SIGUSR2, syscall.SIGHUP)
+
+	go func() {
+		for sig := range sigChan {
+			switch sig {
+			case syscall.SIGUSR1:
+				s.PrintStatus(os.Stderr)
+			case syscall.SIGUSR2:
+				s.TogglePause()
+			case syscall.SIGHUP:
+				reloadSettings(s)
+			}
+		}
+	}()
+}
@@ -0,0 +1,9 @@
+//go:build windows
+
+package main
+
+import "ipmap/scanner"
+
+// setupControlHandler is a no-op on Windows, which has no SIGUSR1/SIGUSR2/SIGHUP.
+// Use -control-file to pause and resume the scan.
+func setupControlHandler(s *scanner.Scanner) {}
@@ -0,0 +1,41 @@
+package tools
+
+import (
+	"errors"
+	"ipmap/modules"
+	"regexp"
+	"strings"
+)
+
+var routeRe = regexp.MustCompile(`(?m)route:\s+([0-9\.\/]+)$`)
+
+// ErrRADbUnreachable is returned when the IP blocks of an ASN could not be queried
+var ErrRADbUnreachable = errors.New("RADb could not be reached")
+
+// ASNBlocks returns the IP blocks announced by the ASN. An ASN without
+// announced blocks returns no blocks and no error.
+func ASNBlocks(asn string) ([]string, error) {
+	output := modules.FindIPBlocks(strings.ToUpper(asn))
+	if output == "" {
+		return nil, ErrRADbUnreachable
+	}
+
+	var blocks []string
+	for _, match := range routeRe.FindAllStringSubmatch(output, -1) {
+		blocks = append(blocks, match[1])
+	}
+	return blocks, nil
+}
+
+// ExpandBlocks returns the addresses of the IP blocks
+func ExpandBlocks(blocks []string) ([]string, error) {
+	var ips []string
+	for _, block := range blocks {
+		addresses, err := modules.CalcIPAddress(block)
+		if err != nil {
+			return nil, err
+		}
+		ips = append(ips, addresses...)
+	}
+	return ips, nil
+}
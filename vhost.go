@@ -0,0 +1,170 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"ipmap/config"
+	"ipmap/modules"
+	"ipmap/tools"
+	"net"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+)
+
+// maxVhostAddresses limits vhost to a small range, every address gets every hostname
+const maxVhostAddresses = 256
+
+// runVhost finds the virtual hosts of addresses:
+// ipmap vhost -ip 203.0.113.10 -w words.txt -d example.com
+func runVhost(cmd *command, args []string) int {
+	fs := newFlagSet(cmd)
+	ip := fs.String("ip", "", "addresses to probe (comma-separated IPs, ip:port or CIDRs up to 256 addresses)")
+	wordlist := fs.String("w", "", "wordlist of hostnames, or of subdomain words with -d")
+	domain := fs.String("d", "", "domain the words of the wordlist are prefixed to (e.g. example.com)")
+	timeout := fs.Int("t", 3000, "request timeout in ms (100-60000)")
+	workers := fs.Int("workers", 20, "number of concurrent requests (1-1000)")
+	rate := fs.Int("rate", 0, "requests per second (0 = unlimited)")
+	retries := fs.Int("retries", 1, "retries for timeouts and 429/503 responses (0-10)")
+	threshold := fs.Int("threshold", modules.DefaultVhostThreshold, "similarity score (0-100) to the catch-all response at which a hostname is ignored")
+	format := fs.String("format", "text", "output format (text/json)")
+	verbose := fs.Bool("v", false, "verbose mode")
+	if code, ok := parseFlags(fs, args); !ok {
+		return code
+	}
+	if *ip == "" || *wordlist == "" || fs.NArg() > 0 {
+		fs.Usage()
+		return exitUsage
+	}
+	if !validFormat(*format) {
+		return exitUsage
+	}
+	if err := validateVhostFlags(*domain, *timeout, *workers, *rate, *retries, *threshold); err != nil {
+		fmt.Fprintln(os.Stderr, "Invalid parameters:", err)
+		return exitUsage
+	}
+
+	targets, err := vhostTargets(*ip)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Invalid parameters:", err)
+		return exitUsage
+	}
+	hosts, err := modules.LoadHostnames(*wordlist, *domain)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid wordlist %s: %v\n", *wordlist, err)
+		return exitUsage
+	}
+	if len(hosts) == 0 {
+		fmt.Fprintln(os.Stderr, "Nothing to probe: the wordlist has no hostnames")
+		return exitUsage
+	}
+	config.Verbose = *verbose
+	config.Format = *format
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if *format == "text" {
+		config.InfoLog("Probing %d hostnames on %d addresses over HTTPS and HTTP", len(hosts), len(targets))
+	}
+	hits := modules.EnumerateVhosts(ctx, targets, hosts, modules.VhostOptions{
+		Timeout:   *timeout,
+		Workers:   *workers,
+		Rate:      *rate,
+		Retries:   *retries,
+		Threshold: *threshold,
+		Verbose:   *verbose,
+		Log:       modules.PrintLog,
+	})
+
+	if *format == "json" {
+		if hits == nil {
+			hits = []modules.VhostHit{}
+		}
+		writeJSON(os.Stdout, hits)
+	} else {
+		for _, hit := range hits {
+			fmt.Printf("%s  %s  [%d] %s (%d bytes)\n", hit.URL, hit.Hostname, hit.Status, hit.Title, hit.Length)
+		}
+	}
+
+	switch {
+	case ctx.Err() != nil:
+		return exitInterrupted
+	case len(hits) == 0:
+		return exitNoResults
+	}
+	return exitOK
+}
+
+// validateVhostFlags checks the vhost inputs before any request
+func validateVhostFlags(domain string, timeout, workers, rate, retries, threshold int) error {
+	if domain != "" {
+		if err := modules.ValidateHostname(domain); err != nil {
+			return err
+		}
+	}
+	if modules.ValidateTimeout(timeout) != timeout {
+		return fmt.Errorf("timeout %dms is out of range, use 100-60000", timeout)
+	}
+	if modules.ValidateWorkerCount(workers) != workers {
+		return fmt.Errorf("invalid worker count %d, use 1-1000", workers)
+	}
+	if rate < 0 {
+		return fmt.Errorf("invalid rate %d, use 0 for unlimited or more", rate)
+	}
+	if retries < 0 || retries > 10 {
+		return fmt.Errorf("invalid retry count %d, use 0-10", retries)
+	}
+	if threshold < 1 || threshold > 100 {
+		return fmt.Errorf("invalid threshold %d, use 1-100", threshold)
+	}
+	return nil
+}
+
+// vhostTargets expands the -ip list into addresses, keeping given ports
+func vhostTargets(list string) ([]string, error) {
+	var targets []string
+	for _, item := range strings.Split(list, ",") {
+		item = strings.TrimSpace(item)
+		switch {
+		case item == "":
+			continue
+		case strings.Contains(item, "/"):
+			_, block, err := net.ParseCIDR(item)
+			if err != nil {
+				return nil, fmt.Errorf("invalid IP block %q, use CIDR notation (e.g. 203.0.113.0/28)", item)
+			}
+			if ones, bits := block.Mask.Size(); bits-ones > 8 {
+				return nil, fmt.Errorf("IP block %s is too large, vhost probes at most a /24", item)
+			}
+			ips, err := tools.ExpandBlocks([]string{item})
+			if err != nil {
+				return nil, err
+			}
+			targets = append(targets, ips...)
+		default:
+			host, _, err := net.SplitHostPort(item)
+			if err != nil {
+				host = item
+			}
+			if net.ParseIP(host) == nil {
+				return nil, fmt.Errorf("invalid address %q, use an IP, ip:port or CIDR block", item)
+			}
+			// A bare IPv6 address needs brackets in a URL
+			if host == item && strings.Contains(item, ":") {
+				item = "[" + item + "]"
+			}
+			targets = append(targets, item)
+		}
+	}
+
+	if len(targets) == 0 {
+		return nil, fmt.Errorf("no addresses in -ip")
+	}
+	if len(targets) > maxVhostAddresses {
+		return nil, fmt.Errorf("%d addresses given, vhost probes at most %d (e.g. a /24)", len(targets), maxVhostAddresses)
+	}
+	return targets, nil
+}
@@ -0,0 +1,244 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"ipmap/config"
+	"ipmap/modules"
+	"ipmap/scanner"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// watchOptions configure the scan repeated by ipmap watch
+type watchOptions struct {
+	asn     string
+	ips     string
+	domain  string
+	timeout string
+	workers int
+	rate    int
+	preScan bool
+
+	notifier *modules.Notifier // webhooks of the changes, none when nil
+}
+
+// runWatch re-runs a scan on a schedule and reports the changes between runs:
+// ipmap watch -asn AS13335 -d example.com -interval 6h
+func runWatch(cmd *command, args []string) int {
+	fs := newFlagSet(cmd)
+	asn := fs.String("asn", "", "ASN to watch")
+	ip := fs.String("ip", "", "IP blocks to watch (comma-separated)")
+	domain := fs.String("d", "", "domain whose new origins are reported")
+	timeout := fs.String("t", "", "timeout in ms (300) or adaptive bounds (200-3000)")
+	interval := fs.Duration("interval", time.Hour, "time between the starts of two runs")
+	runs := fs.Int("runs", 0, "number of runs before exiting (0 = until interrupted)")
+	data := fs.String("data", "ipmap-watch", "directory the runs are stored in")
+	out := fs.String("out", "", "append the changes to this file instead of stdout")
+	format := fs.String("format", "text", "change output format (text/json)")
+	workers := fs.Int("workers", 100, "number of concurrent workers")
+	rate := fs.Int("rate", 0, "requests per second (0 = unlimited)")
+	preScan := fs.Bool("prescan", false, "TCP connect check on ports 443/80 before HTTP probing")
+	verbose := fs.Bool("v", false, "verbose mode")
+	webhooks := addWebhookFlags(fs)
+	if code, ok := parseFlags(fs, args); !ok {
+		return code
+	}
+
+	if (*asn == "") == (*ip == "") {
+		fmt.Fprintln(os.Stderr, "Use exactly one of -asn and -ip")
+		return exitUsage
+	}
+	if *interval < time.Second {
+		fmt.Fprintln(os.Stderr, "Invalid interval. It must be at least 1s.")
+		return exitUsage
+	}
+	if *format != "text" && *format != "json" {
+		fmt.Fprintln(os.Stderr, "Invalid format. Use text or json.")
+		return exitUsage
+	}
+
+	config.Verbose = *verbose
+
+	opts := watchOptions{asn: *asn, ips: *ip, domain: *domain, timeout: *timeout, workers: *workers, rate: *rate, preScan: *preScan}
+	if _, err := scanner.New(opts.scanOptions()); err != nil {
+		fmt.Fprintln(os.Stderr, "Invalid parameters:", err)
+		return exitUsage
+	}
+
+	// Only the changes are sent unless other events are asked for
+	notifier, err := webhooks.notifier(modules.EventChanges)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Webhook configuration error:", err)
+		return exitUsage
+	}
+	defer flushWebhooks(notifier)
+	opts.notifier = notifier
+
+	store, err := modules.OpenWatchStore(*data)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Run directory could not be created:", err)
+		return exitError
+	}
+
+	var w io.Writer = os.Stdout
+	if *out != "" {
+		file, err := os.OpenFile(*out, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Output file could not be opened:", err)
+			return exitError
+		}
+		defer file.Close()
+		w = file
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	config.InfoLog("Watching %s every %v, runs are stored in %s", opts.targets(), *interval, *data)
+
+	for n := 1; *runs == 0 || n <= *runs; n++ {
+		start := time.Now()
+		watchRun(ctx, opts, store, w, *format == "json")
+		if ctx.Err() != nil || n == *runs {
+			break
+		}
+
+		// Runs start on the interval, a run longer than that is followed right away
+		wait := time.Until(start.Add(*interval))
+		config.VerboseLog("Next run in %v", wait.Round(time.Second))
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	return exitOK
+}
+
+// watchRun runs one scan, stores it and writes the changes since the previous run
+func watchRun(ctx context.Context, opts watchOptions, store *modules.WatchStore, w io.Writer, isJSON bool) {
+	prev, err := store.Latest(opts.key())
+	if err != nil {
+		config.ErrorLog("Previous run could not be loaded: %v", err)
+		return
+	}
+
+	run, err := opts.scan(ctx)
+	if err != nil {
+		if ctx.Err() == nil {
+			config.ErrorLog("Run failed: %v", err)
+		}
+		return
+	}
+	// A run that reached nothing would report every site as gone
+	if run.Degraded() {
+		config.WarnLog("Run skipped: no sites, %d addresses scanned with %d errors; the previous run stays the baseline", run.Scanned, run.Errors)
+		return
+	}
+	if _, err := store.Save(run); err != nil {
+		config.ErrorLog("Run could not be stored: %v", err)
+		return
+	}
+
+	if prev == nil {
+		config.InfoLog("Baseline run stored with %d sites", len(run.Sites))
+		return
+	}
+
+	changes := modules.DiffRuns(prev, run)
+	config.InfoLog("Run finished with %d sites, %d changes", len(run.Sites), len(changes))
+	writeChanges(w, run, changes, isJSON)
+	opts.notifier.NotifyWatchChanges(opts.domain, changes)
+}
+
+// writeChanges writes one line per change, prefixed with the run time in text mode
+func writeChanges(w io.Writer, run *modules.WatchRun, changes []modules.WatchChange, isJSON bool) {
+	for _, change := range changes {
+		if !isJSON {
+			fmt.Fprintln(w, run.Time.Local().Format(time.RFC3339)+" "+change.String())
+			continue
+		}
+
+		line, _ := json.Marshal(struct {
+			Time   time.Time `json:"time"`
+			Domain string    `json:"domain,omitempty"`
+			modules.WatchChange
+		}{run.Time, run.Domain, change})
+		fmt.Fprintln(w, string(line))
+	}
+}
+
+// targets describes the watched addresses
+func (o watchOptions) targets() string {
+	if o.asn != "" {
+		return o.asn
+	}
+	return o.ips
+}
+
+// key identifies the runs of this watch in the data directory
+func (o watchOptions) key() string {
+	return modules.WatchKey(strings.Split(o.targets(), ","), o.domain)
+}
+
+// scanOptions returns the options of the watched scan, a domain match does not stop it
+func (o watchOptions) scanOptions() scanner.Options {
+	opts := scanner.DefaultOptions()
+	opts.ASN = o.asn
+	if o.ips != "" {
+		opts.IPBlocks = strings.Split(o.ips, ",")
+	}
+	opts.Domain = o.domain
+	opts.Timeout = o.timeout
+	opts.Continue = true
+	opts.Workers = o.workers
+	opts.Rate = o.rate
+	opts.PreScan = o.preScan
+	opts.Verbose = config.Verbose
+	opts.OnLog = modules.PrintLog
+	opts.Notifier = o.notifier
+	return opts
+}
+
+// scan runs the watched scan to completion
+func (o watchOptions) scan(ctx context.Context) (*modules.WatchRun, error) {
+	s, err := scanner.New(o.scanOptions())
+	if err != nil {
+		return nil, err
+	}
+	result, err := s.Scan(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return newWatchRun(o.key(), o.domain, result), nil
+}
+
+// newWatchRun records the hits of a scan for the comparison with the next run
+func newWatchRun(key string, domain string, result *scanner.Result) *modules.WatchRun {
+	run := &modules.WatchRun{Time: time.Now().UTC(), Key: key, Domain: domain, Targets: result.Report.IPBlocks, Sites: []modules.WatchSite{}}
+	if summary := result.Report.Summary; summary != nil {
+		run.Scanned = summary.Scanned
+		for _, n := range summary.Errors {
+			run.Errors += n
+		}
+	}
+	for _, hit := range result.Hits {
+		run.Sites = append(run.Sites, modules.WatchSite{
+			Status:      hit.Status,
+			URL:         hit.URL,
+			Title:       hit.Title,
+			Hostname:    hit.Hostname,
+			DomainMatch: hit.Details.DomainMatch,
+			Score:       hit.Details.Score,
+		})
+	}
+	return run
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"ipmap/config"
+	"ipmap/modules"
+	"os"
+	"time"
+)
+
+// webhookFlushTimeout bounds the wait for queued notifications before exiting
+const webhookFlushTimeout = 30 * time.Second
+
+// webhookOptions are the webhook flags shared by the scan and serve commands
+type webhookOptions struct {
+	urls     headerFlags
+	events   *string
+	template *string
+	secret   *string
+	retries  *int
+}
+
+// addWebhookFlags registers the webhook flags on fs
+func addWebhookFlags(fs *flag.FlagSet) *webhookOptions {
+	o := &webhookOptions{
+		events:   fs.String("webhook-events", "", "webhook events to send (hit,domain_match,scan_complete,scan_failed; default all)"),
+		template: fs.String("webhook-template", "", "webhook request body template file"),
+		secret:   fs.String("webhook-secret", "", "HMAC-SHA256 key signing webhook bodies (or IPMAP_WEBHOOK_SECRET)"),
+		retries:  fs.Int("webhook-retries", 3, "retries of a failed webhook delivery"),
+	}
+	fs.Var(&o.urls, "webhook", "webhook URL notified with a JSON POST, can be repeated")
+	return o
+}
+
+// notifier builds the webhooks from the flags and starts their notifier, nil
+// without -webhook. Without -webhook-events the webhooks get the defaults, or
+// all events when none are given.
+func (o *webhookOptions) notifier(defaults ...modules.WebhookEvent) (*modules.Notifier, error) {
+	if len(o.urls) == 0 {
+		return nil, nil
+	}
+
+	events, err := modules.ParseWebhookEvents(*o.events)
+	if err != nil {
+		return nil, err
+	}
+	if len(events) == 0 {
+		events = defaults
+	}
+	if *o.retries < 0 || *o.retries > 10 {
+		return nil, fmt.Errorf("webhook retries must be between 0 and 10")
+	}
+
+	secret := *o.secret
+	if secret == "" {
+		secret = os.Getenv("IPMAP_WEBHOOK_SECRET")
+	}
+
+	hook := modules.Webhook{Events: events, Secret: secret, Retries: *o.retries}
+	if *o.template != "" {
+		data, err := os.ReadFile(*o.template)
+		if err != nil {
+			return nil, err
+		}
+		if hook.Template, err = modules.ParseWebhookTemplate(string(data)); err != nil {
+			return nil, fmt.Errorf("invalid webhook template: %v", err)
+		}
+	}
+
+	hooks := make([]modules.Webhook, 0, len(o.urls))
+	for _, url := range o.urls {
+		if !modules.ValidateWebhookURL(url) {
+			return nil, fmt.Errorf("invalid webhook URL: %s", url)
+		}
+		h := hook
+		h.URL = url
+		hooks = append(hooks, h)
+	}
+	return modules.NewNotifier(hooks, webhookLog), nil
+}
+
+// webhookLog prints the notifier messages, the verbose ones only with -v
+func webhookLog(level modules.LogLevel, msg string) {
+	if level != modules.LogVerbose || config.Verbose {
+		modules.PrintLog(level, msg)
+	}
+}
+
+// flushWebhooks waits for the queued notifications before the process exits
+func flushWebhooks(n *modules.Notifier) {
+	if !n.Close(webhookFlushTimeout) {
+		config.WarnLog("Not all webhook notifications could be delivered")
+	}
+}